@@ -6,6 +6,7 @@ REM 设置 Go bin 路径
 set PATH=%PATH%;%USERPROFILE%\go\bin
 
 REM 生成 protobuf 文件
+cd /d %~dp0manifest
 protoc --go_out=. --go-vtproto_out=. --go-vtproto_opt=features=marshal+unmarshal+size *.proto
 
 if %errorlevel% neq 0 (
@@ -1,4 +1,5 @@
 #!/usr/bin/env bash
 set -euxo pipefail
 
+cd "$(dirname "$0")/manifest"
 protoc --go_out=. --go-vtproto_out=. --go-vtproto_opt=features=marshal+unmarshal+size *.proto
@@ -19,7 +19,7 @@
 // 	protoc        v6.32.0--rc2
 // source: Resources.proto
 
-package main
+package manifest
 
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
@@ -2,7 +2,7 @@
 // protoc-gen-go-vtproto version: v0.6.0
 // source: Resources.proto
 
-package main
+package manifest
 
 import (
 	binary "encoding/binary"
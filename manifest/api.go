@@ -0,0 +1,122 @@
+// Package manifest edits the AndroidManifest.xml of AABs, APKs and aapt2 proto manifests. It
+// implements the androidmanifest-changer command, whose Main runs it, and exposes the common edits
+// for Go programs via UpdateAAB, UpdateAPK, UpdateManifest and UpdateManifestBytes.
+package manifest
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Config is the set of edits to apply via UpdateAAB, UpdateAPK, UpdateManifest or
+// UpdateManifestBytes. The zero values keep the manifest's values.
+type Config struct {
+	VersionCode      int32
+	VersionName      string
+	PackageName      string
+	MinSdkVersion    int32
+	TargetSdkVersion int32
+	// The attributes to set, in the syntax of -set, e.g. debuggable=false or
+	// application/@android:allowBackup=false.
+	Set []string
+	// The uses-permission entries to add and remove, e.g. android.permission.CAMERA.
+	AddPermissions    []string
+	RemovePermissions []string
+	// If set, an unchanged file isn't rewritten.
+	SkipUnchanged bool
+	// If set, the written manifest is read back and checked against the edits.
+	Verify bool
+}
+
+// editConfig validates c and converts it to the config the command line builds from its flags.
+func (c Config) editConfig() (*editConfig, error) {
+	if c.VersionCode < 0 {
+		return nil, fmt.Errorf("invalid VersionCode %d: expected a non-negative number", c.VersionCode)
+	}
+	if c.PackageName != "" {
+		if err := checkPackageName(c.PackageName); err != nil {
+			return nil, fmt.Errorf("invalid PackageName: %w", err)
+		}
+	}
+	config := &editConfig{
+		versionCode:       c.VersionCode,
+		versionName:       c.VersionName,
+		packageName:       c.PackageName,
+		addPermissions:    c.AddPermissions,
+		removePermissions: c.RemovePermissions,
+		skipUnchanged:     c.SkipUnchanged,
+		verify:            c.Verify,
+	}
+	for _, sdk := range []struct {
+		name  string
+		value int32
+	}{{"MinSdkVersion", c.MinSdkVersion}, {"TargetSdkVersion", c.TargetSdkVersion}} {
+		if sdk.value < 0 {
+			return nil, fmt.Errorf("invalid %s %d: expected a positive number", sdk.name, sdk.value)
+		}
+	}
+	if c.MinSdkVersion > 0 && c.TargetSdkVersion > 0 && c.TargetSdkVersion < c.MinSdkVersion {
+		return nil, fmt.Errorf("TargetSdkVersion %d is lower than MinSdkVersion %d", c.TargetSdkVersion, c.MinSdkVersion)
+	}
+	if c.MinSdkVersion > 0 {
+		config.attrSets = append(config.attrSets, androidAttr("minSdkVersion", fmt.Sprint(c.MinSdkVersion)))
+	}
+	if c.TargetSdkVersion > 0 {
+		config.attrSets = append(config.attrSets, androidAttr("targetSdkVersion", fmt.Sprint(c.TargetSdkVersion)))
+	}
+	for _, s := range c.Set {
+		set, err := parseSet(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Set %q: %w", s, err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	return config, nil
+}
+
+// UpdateAAB applies c to the manifests of the AAB at path in place.
+func UpdateAAB(path string, c Config) error {
+	config, err := c.editConfig()
+	if err != nil {
+		return err
+	}
+	_, _, err = updateAab(path, config)
+	return err
+}
+
+var resolveAapt2Once sync.Once
+
+// UpdateAPK applies c to the manifest of the APK at path in place. Unless the APK is in aapt2's
+// proto format, aapt2 is needed, found like the command line does without -aapt2.
+func UpdateAPK(path string, c Config) error {
+	config, err := c.editConfig()
+	if err != nil {
+		return err
+	}
+	resolveAapt2Once.Do(resolveAapt2Path)
+	_, _, err = updateApk(path, config)
+	return err
+}
+
+// UpdateManifest applies c to the APK, AAB or proto manifest at path in place, like a run of the
+// command line tool without any of the printing or dry-run modes.
+func UpdateManifest(path string, c Config) error {
+	config, err := c.editConfig()
+	if err != nil {
+		return err
+	}
+	resolveAapt2Once.Do(resolveAapt2Path)
+	_, _, err = updateFile(path, config)
+	return err
+}
+
+// UpdateManifestBytes applies c to data, an AndroidManifest.xml in aapt2's proto format like the
+// one of an AAB's base/manifest/, and returns the edited manifest.
+func UpdateManifestBytes(data []byte, c Config) ([]byte, error) {
+	config, err := c.editConfig()
+	if err != nil {
+		return nil, err
+	}
+	_, out, err := editManifest(data, config)
+	return out, err
+}
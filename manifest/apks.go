@@ -0,0 +1,122 @@
+package manifest
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// tocPath is the entry of an APK set holding bundletool's BuildApksResult message, which lists the
+// variants and their APKs.
+const tocPath = "toc.pb"
+
+// tocPackageNameField is BuildApksResult.package_name in bundletool's commands.proto.
+const tocPackageNameField = 4
+
+// apkSetEntries returns the names of the APKs in the APK set, in archive order.
+func apkSetEntries(path string) ([]string, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer reader.Close()
+	var names []string
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, ".apk") {
+			names = append(names, file.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("%s has no APKs", path))
+	}
+	return names, nil
+}
+
+// apkSetBase returns the APK whose manifest stands for the whole set: the base module's master
+// split of build-apks, the universal APK of --mode=universal or else the first APK.
+func apkSetBase(names []string) string {
+	for _, base := range []string{"splits/base-master.apk", "universal.apk"} {
+		if slices.Contains(names, base) {
+			return base
+		}
+	}
+	return names[0]
+}
+
+// updateApkSet applies the changes to every APK in a bundletool APK set (.apks), i.e. all splits
+// and standalone APKs. Each APK is edited like a single APK, including re-signing, and the set is
+// rewritten with the edited ones. The returned changes are those of the base APK. If the package
+// changes, toc.pb gets the new package name too.
+func updateApkSet(path string, config *editConfig) ([]change, bool, error) {
+	names, err := apkSetEntries(path)
+	if err != nil {
+		return nil, false, err
+	}
+	base := apkSetBase(names)
+	extra := map[string][]byte{}
+	var changes []change
+	for _, name := range names {
+		fmt.Println("Editing", name)
+		apkChanges, written, err := updateApkSetEntry(path, name, config)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", name, err)
+		}
+		if name == base {
+			changes = apkChanges
+		}
+		if written != nil {
+			extra[name] = written
+		}
+	}
+	fmt.Printf("Changed %d of %d APKs\n", len(extra), len(names))
+	if len(extra) == 0 {
+		return changes, false, nil
+	}
+	if config.packageName != "" {
+		toc, err := readFromZipIfExists(path, tocPath)
+		if err != nil {
+			return nil, false, err
+		}
+		if toc != nil {
+			updated, old, err := setStringField(toc, tocPackageNameField, config.packageName)
+			if err != nil {
+				return nil, false, fmt.Errorf("invalid %s: %w", tocPath, err)
+			}
+			if old != config.packageName {
+				fmt.Printf("Changing the package of %s from %s to %s\n", tocPath, old, config.packageName)
+				extra[tocPath] = updated
+			}
+		}
+	}
+	if err := addToZipNative(path, "", nil, nil, extra); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// updateApkSetEntry edits a copy of the APK called name and returns the edited APK, or nil if it
+// wasn't written.
+func updateApkSetEntry(path string, name string, config *editConfig) ([]change, []byte, error) {
+	apk, err := createTemp(tmpDir, "*.apk")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer removeTemp(apk)
+	if err := extractFromZip(path, name, apk); err != nil {
+		return nil, nil, err
+	}
+	if err := apk.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed writing temp file: %w", err)
+	}
+	changes, written, err := updateApk(apk.Name(), config)
+	if err != nil || !written {
+		return changes, nil, err
+	}
+	data, err := os.ReadFile(apk.Name())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed reading temp file: %w", err)
+	}
+	return changes, data, nil
+}
@@ -0,0 +1,120 @@
+package manifest
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Resource IDs of the intent filter attributes -add-app-link sets.
+const (
+	autoVerifyAttrID = 0x010104ee
+	schemeAttrID     = 0x01010027
+	hostAttrID       = 0x01010028
+	pathPrefixAttrID = 0x0101002b
+)
+
+// appLink is an -add-app-link intent filter for an activity.
+type appLink struct {
+	activity   componentSelector
+	scheme     string
+	host       string
+	pathPrefix string
+}
+
+// parseAppLink parses activity=scheme://host[/pathPrefix], where activity is the activity's
+// android:name, e.g. .MainActivity=https://links.example.com/open.
+func parseAppLink(s string) (appLink, error) {
+	name, link, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return appLink{}, fmt.Errorf("expected activity=https://host but got %q", s)
+	}
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return appLink{}, fmt.Errorf("expected a URL like https://links.example.com but got %q", link)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return appLink{}, fmt.Errorf("%q: app links can only match the scheme, host and path", link)
+	}
+	path := u.EscapedPath()
+	if path == "/" {
+		path = ""
+	}
+	return appLink{activity: componentSelector{name: name, index: -1}, scheme: u.Scheme, host: u.Host, pathPrefix: path}, nil
+}
+
+func (l appLink) String() string {
+	return l.scheme + "://" + l.host + l.pathPrefix
+}
+
+// addAppLink appends an intent filter for the link to the activity: ACTION_VIEW with the DEFAULT
+// and BROWSABLE categories and android:autoVerify="true", so the platform verifies the domain for
+// http and https links. Nothing is added if the activity already has a VIEW filter with the same
+// data.
+func (e *manifestEditor) addAppLink(l appLink) error {
+	activity, err := selectComponent(e.root, e.inputPackage, l.activity)
+	if err != nil {
+		return err
+	}
+	if activity.GetName() != "activity" && activity.GetName() != "activity-alias" {
+		return fmt.Errorf("-add-app-link: %s is a %s, not an activity", l.activity, activity.GetName())
+	}
+	for _, child := range activity.GetChild() {
+		if filter := child.GetElement(); filter.GetName() == "intent-filter" && hasAppLink(filter, l) {
+			notef("%s already handles %s", l.activity, l)
+			return nil
+		}
+	}
+
+	filter := &XmlElement{Name: "intent-filter"}
+	activity.Child = append(activity.Child, &XmlNode{Node: &XmlNode_Element{Element: filter}})
+	fmt.Printf("Adding the app link %s to %s\n", l, l.activity)
+	label := fmt.Sprintf("app link %s", l)
+	if l.scheme == "http" || l.scheme == "https" {
+		if err := e.setAttr(filter, namespace, "autoVerify", autoVerifyAttrID, boolAttr, "true", label+" android:autoVerify"); err != nil {
+			return err
+		}
+	}
+	children := []struct {
+		element string
+		name    string
+		id      uint32
+		value   string
+	}{
+		{"action", "name", nameAttrID, "android.intent.action.VIEW"},
+		{"category", "name", nameAttrID, "android.intent.category.DEFAULT"},
+		{"category", "name", nameAttrID, "android.intent.category.BROWSABLE"},
+		{"data", "scheme", schemeAttrID, l.scheme},
+		{"data", "host", hostAttrID, l.host},
+		{"data", "pathPrefix", pathPrefixAttrID, l.pathPrefix},
+	}
+	for _, c := range children {
+		if c.value == "" {
+			continue
+		}
+		element := &XmlElement{Name: c.element}
+		filter.Child = append(filter.Child, &XmlNode{Node: &XmlNode_Element{Element: element}})
+		if err := e.setAttr(element, namespace, c.name, c.id, stringAttr, c.value, fmt.Sprintf("%s <%s android:%s>", label, c.element, c.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasAppLink reports whether the intent filter handles ACTION_VIEW for the link's scheme, host and
+// path prefix.
+func hasAppLink(filter *XmlElement, l appLink) bool {
+	values := map[string]bool{}
+	for _, child := range filter.GetChild() {
+		element := child.GetElement()
+		for _, attr := range element.GetAttribute() {
+			if attr.GetNamespaceUri() == namespace {
+				values[element.GetName()+"/"+attr.GetName()+"="+attrValue(attr)] = true
+			}
+		}
+	}
+	return values["action/name=android.intent.action.VIEW"] &&
+		values["data/scheme="+l.scheme] &&
+		values["data/host="+l.host] &&
+		(l.pathPrefix == "" || values["data/pathPrefix="+l.pathPrefix])
+}
@@ -0,0 +1,748 @@
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type attrType int
+
+const (
+	// untypedAttr takes the type of the existing compiled value and falls back to a string.
+	untypedAttr attrType = iota
+	stringAttr
+	intAttr
+	hexAttr
+	boolAttr
+	floatAttr
+	refAttr
+	// refOrBoolAttr is a reference that may also be set to true or false, like fullBackupContent.
+	refOrBoolAttr
+	// refOrStringAttr is a reference if the value starts with @ and a literal string otherwise, like
+	// android:label.
+	refOrStringAttr
+	// enumAttr is an integer set by one of the names in attrEnums.
+	enumAttr
+	// flagsAttr is a hexadecimal integer set by |-separated names from attrFlags.
+	flagsAttr
+)
+
+// attrInfo describes a well-known android attribute: its public resource ID (required by aapt2 and
+// the platform to recognize newly added attributes), its value type and the element it lives on.
+// An ID of 0 means we don't know it, so adding the attribute prints a warning.
+type attrInfo struct {
+	id      uint32
+	typ     attrType
+	element string
+}
+
+var androidAttrs = map[string]attrInfo{
+	"versionCode":               {0x0101021b, intAttr, "manifest"},
+	"versionName":               {0x0101021c, stringAttr, "manifest"},
+	"revisionCode":              {0x010104d5, intAttr, "manifest"},
+	"sharedUserId":              {0x0101000b, stringAttr, "manifest"},
+	"compileSdkVersion":         {0x01010572, intAttr, "manifest"},
+	"compileSdkVersionCodename": {0x01010573, stringAttr, "manifest"},
+	"sharedUserMaxSdkVersion":   {0x0101064d, intAttr, "manifest"},
+	"requiredSplitTypes":        {0x0101064e, stringAttr, "manifest"},
+	"splitTypes":                {0x0101064f, stringAttr, "manifest"},
+	"installLocation":           {0x010102b7, enumAttr, "manifest"},
+	"targetSandboxVersion":      {0x0101054c, intAttr, "manifest"},
+
+	"minSdkVersion":    {0x0101020c, intAttr, "uses-sdk"},
+	"targetSdkVersion": {0x01010270, intAttr, "uses-sdk"},
+	"maxSdkVersion":    {0x01010271, intAttr, "uses-sdk"},
+
+	"debuggable":                   {0x0101000f, boolAttr, "application"},
+	"hasCode":                      {0x0101000c, boolAttr, "application"},
+	"testOnly":                     {0x01010272, boolAttr, "application"},
+	"allowBackup":                  {0x01010280, boolAttr, "application"},
+	"backupAgent":                  {0x0101027f, stringAttr, "application"},
+	"appComponentFactory":          {0x0101057a, stringAttr, "application"},
+	"restoreAnyVersion":            {0x010102ba, boolAttr, "application"},
+	"hardwareAccelerated":          {0x010102d3, boolAttr, "application"},
+	"largeHeap":                    {0x0101035a, boolAttr, "application"},
+	"supportsRtl":                  {0x010103af, boolAttr, "application"},
+	"extractNativeLibs":            {0x010104ea, boolAttr, "application"},
+	"usesCleartextTraffic":         {0x010104ec, boolAttr, "application"},
+	"requestLegacyExternalStorage": {0x01010603, boolAttr, "application"},
+	"usesNonSdkApi":                {0x0101058e, boolAttr, "application"},
+	"enabled":                      {0x0101000e, boolAttr, "application"},
+	"persistent":                   {0x0101000d, boolAttr, "application"},
+	"fullBackupContent":            {0x010104eb, refOrBoolAttr, "application"},
+	"dataExtractionRules":          {0x0101063e, refAttr, "application"},
+	"networkSecurityConfig":        {0x01010527, refAttr, "application"},
+	"directBootAware":              {0x01010505, boolAttr, "application"},
+	"maxAspectRatio":               {0x01010560, floatAttr, "application"},
+	"enableOnBackInvokedCallback":  {0x0101066c, boolAttr, "application"},
+	"gwpAsanMode":                  {0x01010616, enumAttr, "application"},
+	"memtagMode":                   {0x01010624, enumAttr, "application"},
+	"label":                        {0x01010001, refOrStringAttr, "application"},
+	"icon":                         {0x01010002, refAttr, "application"},
+	"roundIcon":                    {0x0101052c, refAttr, "application"},
+
+	"exported":            {0x01010010, boolAttr, "component"},
+	"grantUriPermissions": {0x0101001b, boolAttr, "provider"},
+	"taskAffinity":        {0x01010012, stringAttr, "activity"},
+
+	"usesPermissionFlags": {0x01010644, flagsAttr, "uses-permission"},
+}
+
+// attrEnums maps the value names of enumAttr attributes to their values, as defined in the
+// platform's attrs.xml.
+var attrEnums = map[string]map[string]int32{
+	"gwpAsanMode": {"default": -1, "never": 0, "always": 1},
+	"memtagMode":  {"default": -1, "off": 0, "async": 1, "sync": 2},
+
+	"installLocation": {"auto": 0, "internalOnly": 1, "preferExternal": 2},
+}
+
+// attrFlags maps the flag names of flagsAttr attributes to their bits, as defined in the platform's
+// attrs.xml.
+var attrFlags = map[string]map[string]uint32{
+	"usesPermissionFlags": {"neverForLocation": 0x10000},
+}
+
+// parseFlags combines |-separated flag names (or plain numbers) of the flags attribute.
+func parseFlags(name string, value string) (uint32, error) {
+	var v uint32
+	for _, flag := range strings.Split(value, "|") {
+		flag = strings.TrimSpace(flag)
+		if bits, ok := attrFlags[name][flag]; ok {
+			v |= bits
+			continue
+		}
+		bits, err := strconv.ParseUint(flag, 0, 32)
+		if err != nil {
+			var names []string
+			for n := range attrFlags[name] {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return 0, fmt.Errorf("android:%s takes |-separated flags out of %s but got %q", name, strings.Join(names, ", "), value)
+		}
+		v |= uint32(bits)
+	}
+	return v, nil
+}
+
+// checkEnum validates value against the names of the enum attribute.
+func checkEnum(name string, value string) error {
+	if _, ok := attrEnums[name][value]; ok {
+		return nil
+	}
+	var names []string
+	for n := range attrEnums[name] {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool { return attrEnums[name][names[i]] < attrEnums[name][names[j]] })
+	return fmt.Errorf("android:%s must be one of %s but got %q", name, strings.Join(names, ", "), value)
+}
+
+// attrSet is a generic attribute assignment like android:debuggable=true.
+type attrSet struct {
+	prefix string
+	name   string
+	value  string
+	// If set, the attribute is applied to this component instead of its well-known element.
+	component *componentSelector
+	// If set, the attribute is applied to the <uses-permission> with this android:name.
+	permission string
+	// If set, these override the element and type from androidAttrs, e.g. for unknown attributes.
+	element string
+	typ     attrType
+	// If set, the attribute is removed instead and value is ignored.
+	remove bool
+	// If set, the attribute is applied to the element at this element path, e.g.
+	// manifest/application/activity[1].
+	path string
+}
+
+// androidAttr returns an assignment of the android attribute on its well-known element.
+func androidAttr(name string, value string) attrSet {
+	return attrSet{prefix: "android", name: name, value: value}
+}
+
+func (s attrSet) String() string {
+	name := s.name
+	if s.prefix != "" {
+		name = s.prefix + ":" + s.name
+	}
+	if s.path != "" {
+		return s.path + "/@" + name
+	}
+	if s.permission != "" {
+		return fmt.Sprintf("uses-permission[%s]/@%s", s.permission, name)
+	}
+	return name
+}
+
+// parseAttrSet parses "namespace:name=value" where the namespace prefix is optional (e.g. for package).
+// An element path can come first, e.g. application/@android:allowBackup=false.
+func parseAttrSet(s string) (attrSet, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok {
+		return attrSet{}, fmt.Errorf("expected namespace:name=value but got %q", s)
+	}
+	path, key, err := cutElementPath(strings.TrimSpace(key))
+	if err != nil {
+		return attrSet{}, err
+	}
+	prefix, name, ok := strings.Cut(key, ":")
+	if !ok {
+		prefix, name = "", prefix
+	}
+	if name == "" {
+		return attrSet{}, fmt.Errorf("missing attribute name in %q", s)
+	}
+	return attrSet{prefix: prefix, name: name, value: value, path: path}, nil
+}
+
+// cutElementPath splits "path/@name" into the element path, with the root element manifest
+// added if it's left out, and the attribute name. Without a path, key is returned as it is.
+func cutElementPath(key string) (string, string, error) {
+	path, name, ok := strings.Cut(key, "/@")
+	if !ok {
+		return "", key, nil
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return "", "", fmt.Errorf("missing element path in %q", key)
+	}
+	if path != "manifest" && !strings.HasPrefix(path, "manifest/") {
+		path = "manifest/" + path
+	}
+	return path, name, nil
+}
+
+// parseSet parses a -set assignment. It has the syntax of an -attrs-file line, but well-known
+// android attributes don't need the android: prefix, e.g. debuggable=true.
+func parseSet(s string) (attrSet, error) {
+	set, err := parseAttrSet(s)
+	if err != nil {
+		return attrSet{}, err
+	}
+	if _, ok := androidAttrs[set.name]; ok && set.prefix == "" {
+		set.prefix = "android"
+	}
+	return set, nil
+}
+
+// parseRemoveAttr parses a -removeAttr name. The namespace prefix defaults to android, e.g.
+// testOnly is the same as android:testOnly.
+func parseRemoveAttr(s string) (attrSet, error) {
+	path, key, err := cutElementPath(strings.TrimSpace(s))
+	if err != nil {
+		return attrSet{}, err
+	}
+	prefix, name, ok := strings.Cut(key, ":")
+	if !ok {
+		prefix, name = "android", prefix
+	}
+	if name == "" || strings.Contains(name, "=") {
+		return attrSet{}, fmt.Errorf("expected an attribute name like android:testOnly but got %q", s)
+	}
+	return attrSet{prefix: prefix, name: name, remove: true, path: path}, nil
+}
+
+// readValueFile returns the content of a file holding a single value, like -versionNameFile.
+// Trailing whitespace including CRLF and LF line endings is removed unless keepWhitespace is set.
+func readValueFile(path string, keepWhitespace bool) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed reading value file: %w", err)
+	}
+	if keepWhitespace {
+		return string(content), nil
+	}
+	return strings.TrimRight(string(content), " \t\r\n"), nil
+}
+
+// parseAppBool parses name=true|false for -app-bool, which sets a boolean android attribute on
+// the application element.
+func parseAppBool(s string) (attrSet, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return attrSet{}, fmt.Errorf("expected name=true|false but got %q", s)
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return attrSet{}, fmt.Errorf("android:%s: %q is not a boolean", name, value)
+	}
+	if known, ok := androidAttrs[name]; ok && (known.element != "application" || (known.typ != boolAttr && known.typ != refOrBoolAttr)) {
+		return attrSet{}, fmt.Errorf("android:%s is not a boolean attribute of the application element", name)
+	}
+	return attrSet{prefix: "android", name: name, value: strconv.FormatBool(b), element: "application", typ: boolAttr}, nil
+}
+
+// parseGrantUri parses provider=true|false for -set-grant-uri, where provider is the provider's
+// android:name.
+func parseGrantUri(s string) (attrSet, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return attrSet{}, fmt.Errorf("expected provider=true|false but got %q", s)
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return attrSet{}, fmt.Errorf("android:grantUriPermissions: %q is not a boolean", value)
+	}
+	set := androidAttr("grantUriPermissions", strconv.FormatBool(b))
+	set.component = &componentSelector{name: name, index: -1}
+	return set, nil
+}
+
+// parseExported parses component=true|false for -set-exported, where component is the
+// component's android:name, which may be relative to the package like .MainActivity.
+func parseExported(s string) (attrSet, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return attrSet{}, fmt.Errorf("expected component=true|false but got %q", s)
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return attrSet{}, fmt.Errorf("android:exported: %q is not a boolean", value)
+	}
+	set := androidAttr("exported", strconv.FormatBool(b))
+	set.component = &componentSelector{name: name, index: -1}
+	return set, nil
+}
+
+// parseTaskAffinity parses activity=affinity for -set-task-affinity, where activity is the
+// activity's android:name. An empty affinity is kept, it makes the activity prefer no task.
+func parseTaskAffinity(s string) (attrSet, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || name == "" {
+		return attrSet{}, fmt.Errorf("expected activity=affinity but got %q", s)
+	}
+	set := androidAttr("taskAffinity", value)
+	set.component = &componentSelector{name: name, index: -1}
+	return set, nil
+}
+
+// parsePermissionFlags parses permission=flags for -set-permission-flags, e.g.
+// android.permission.BLUETOOTH_SCAN=neverForLocation.
+func parsePermissionFlags(s string) (attrSet, error) {
+	permission, value, ok := strings.Cut(s, "=")
+	if !ok || permission == "" {
+		return attrSet{}, fmt.Errorf("expected permission=flags but got %q", s)
+	}
+	if _, err := parseFlags("usesPermissionFlags", value); err != nil {
+		return attrSet{}, err
+	}
+	set := androidAttr("usesPermissionFlags", value)
+	set.permission = permission
+	return set, nil
+}
+
+// parsePermissionMaxSdk parses permission=level for -permission-max-sdk, e.g.
+// android.permission.WRITE_EXTERNAL_STORAGE=28. The level none removes the cap.
+func parsePermissionMaxSdk(s string) (attrSet, error) {
+	permission, value, ok := strings.Cut(s, "=")
+	if !ok || permission == "" {
+		return attrSet{}, fmt.Errorf("expected permission=level but got %q", s)
+	}
+	set := androidAttr("maxSdkVersion", value)
+	set.permission = permission
+	if value == "none" {
+		set.value, set.remove = "", true
+		return set, nil
+	}
+	if level, err := strconv.Atoi(value); err != nil || level < 1 {
+		return attrSet{}, fmt.Errorf("android:maxSdkVersion: expected an API level like 28 or none but got %q", value)
+	}
+	return set, nil
+}
+
+// findPermission returns the <uses-permission> element requesting the permission.
+func findPermission(root *XmlElement, permission string) *XmlElement {
+	for _, child := range root.GetChild() {
+		element := child.GetElement()
+		if element.GetName() == "uses-permission" && componentName(element) == permission {
+			return element
+		}
+	}
+	return nil
+}
+
+// parseDirectBoot parses selector=true|false for -set-directboot, where the selector is
+// "application" or a component selector.
+func parseDirectBoot(s string) (attrSet, error) {
+	selector, value, ok := strings.Cut(s, "=")
+	if !ok || selector == "" {
+		return attrSet{}, fmt.Errorf("expected selector=true|false but got %q", s)
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return attrSet{}, fmt.Errorf("android:directBootAware: %q is not a boolean", value)
+	}
+	set := androidAttr("directBootAware", strconv.FormatBool(b))
+	if selector != "application" {
+		sel, err := parseComponentSelector(selector)
+		if err != nil {
+			return attrSet{}, err
+		}
+		set.component = &sel
+	}
+	return set, nil
+}
+
+// readAttrsFile reads the assignments of an -attrs-file. Trailing whitespace of values is removed
+// unless keepWhitespace is set. Line endings (LF or CRLF) are never part of a value.
+func readAttrsFile(path string, keepWhitespace bool) ([]attrSet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening attrs file: %w", err)
+	}
+	defer file.Close()
+
+	var sets []attrSet
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimLeft(scanner.Text(), " \t")
+		if !keepWhitespace {
+			text = strings.TrimRight(text, " \t")
+		}
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		set, err := parseAttrSet(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		sets = append(sets, set)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading attrs file: %w", err)
+	}
+	return sets, nil
+}
+
+// namespaceURI resolves a prefix via the root element's namespace declarations.
+func namespaceURI(root *XmlElement, prefix string) (string, error) {
+	if prefix == "" {
+		return "", nil
+	}
+	for _, decl := range root.GetNamespaceDeclaration() {
+		if decl.GetPrefix() == prefix {
+			return decl.GetUri(), nil
+		}
+	}
+	if prefix == "android" {
+		return namespace, nil
+	}
+	return "", fmt.Errorf("undeclared namespace prefix %q", prefix)
+}
+
+func (e *manifestEditor) applyAttrSet(set attrSet) error {
+	uri, err := namespaceURI(e.root, set.prefix)
+	if err != nil {
+		return err
+	}
+	info := attrInfo{element: "manifest"}
+	if uri == namespace {
+		if known, ok := androidAttrs[set.name]; ok {
+			info = known
+		}
+	}
+	if set.element != "" {
+		info.element = set.element
+	}
+	if set.typ != untypedAttr {
+		info.typ = set.typ
+	}
+	element := e.root
+	switch {
+	case set.path != "":
+		// Missing elements are only created for assignments, like for the well-known elements.
+		if element, err = resolveElementPath(e.root, e.inputPackage, set.path, !set.remove); err != nil {
+			if set.remove && exitCode(err) == exitNotFound {
+				e.skipf("Not removing %s, the manifest has no %s", set, set.path)
+				return nil
+			}
+			return err
+		}
+	case set.component != nil:
+		if element, err = selectComponent(e.root, e.inputPackage, *set.component); err != nil {
+			return err
+		}
+		if isComponentType(info.element) && element.GetName() != info.element {
+			return fmt.Errorf("%s can only be set on a <%s>, but %s is an <%s>", set, info.element, set.component, element.GetName())
+		}
+	case set.permission != "":
+		if element = findPermission(e.root, set.permission); element == nil {
+			return withExitCode(exitNotFound, fmt.Errorf("the manifest has no <uses-permission android:name=%q>", set.permission))
+		}
+	case info.element == "component" || isComponentType(info.element):
+		return fmt.Errorf("%s can only be set on a component, see -component", set)
+	case info.element == "uses-permission":
+		return fmt.Errorf("%s can only be set on a permission, see -set-permission-flags", set)
+	case info.element != "manifest" && set.remove:
+		if element = childElement(e.root, info.element); element == nil {
+			e.skipf("Not removing %s, the manifest has no <%s>", set, info.element)
+			return nil
+		}
+	case info.element != "manifest":
+		element = childElementOrCreate(e.root, info.element)
+	}
+	if set.remove {
+		e.removeAttr(element, uri, set.name, set.String())
+		return nil
+	}
+	return e.setAttr(element, uri, set.name, info.id, info.typ, set.value, set.String())
+}
+
+// setAttr sets the attribute on element, creating it if needed.
+func (e *manifestEditor) setAttr(element *XmlElement, uri string, name string, id uint32, typ attrType, value string, label string) error {
+	attr := findAttr(element, uri, name)
+	if attr == nil {
+		if uri == namespace && id == 0 {
+			e.skipf("%s has no known resource ID. The platform ignores newly added attributes without one.", label)
+		}
+		attr = &XmlAttribute{NamespaceUri: uri, Name: name, ResourceId: id}
+		if err := setAttrValue(attr, typ, value); err != nil {
+			return fmt.Errorf("%s: %w", label, err)
+		}
+		e.resolveReference(attr, label)
+		if uri == namespace {
+			// A minimal manifest may not declare xmlns:android yet.
+			e.mergeNamespace(&XmlNamespace{Prefix: "android", Uri: namespace})
+		}
+		addAttr(element, attr)
+		e.record(label, element, attr, nil)
+		return nil
+	}
+	old := attrValue(attr)
+	if err := setAttrValue(attr, inferAttrType(attr, typ), value); err != nil {
+		return fmt.Errorf("%s: %w", label, err)
+	}
+	e.resolveReference(attr, label)
+	e.record(label, element, attr, &old)
+	return nil
+}
+
+// removeAttr removes the attribute from element. A missing attribute is only a warning, because
+// the goal is already reached.
+func (e *manifestEditor) removeAttr(element *XmlElement, uri string, name string, label string) {
+	attr := findAttr(element, uri, name)
+	if attr == nil {
+		e.skipf("Not removing %s, <%s> doesn't have it", label, element.GetName())
+		return
+	}
+	kept := element.Attribute[:0]
+	for _, a := range element.GetAttribute() {
+		if a != attr {
+			kept = append(kept, a)
+		}
+	}
+	element.Attribute = kept
+	fmt.Println("Removing", label, "with the value", e.reportValue(attrValue(attr)))
+}
+
+// inferAttrType returns the type of the existing compiled value for untyped attributes.
+func inferAttrType(attr *XmlAttribute, typ attrType) attrType {
+	if typ != untypedAttr {
+		return typ
+	}
+	if attr.GetCompiledItem().GetRef() != nil {
+		return refAttr
+	}
+	switch attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+	case *Primitive_IntDecimalValue:
+		return intAttr
+	case *Primitive_IntHexadecimalValue:
+		return hexAttr
+	case *Primitive_BooleanValue:
+		return boolAttr
+	case *Primitive_FloatValue:
+		return floatAttr
+	}
+	return stringAttr
+}
+
+func setAttrValue(attr *XmlAttribute, typ attrType, value string) error {
+	// aapt2's binary->proto conversion drops the string value of compiled attributes, so we only
+	// keep it in sync if it exists (like in AABs) or if we create the attribute.
+	keepValue := attr.Value != "" || attr.CompiledItem == nil
+	switch typ {
+	case intAttr:
+		v, err := strconv.ParseInt(value, 0, 32)
+		if err != nil {
+			return fmt.Errorf("expected an integer but got %q", value)
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_IntDecimalValue{IntDecimalValue: int32(v)}}}}
+	case hexAttr:
+		v, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return fmt.Errorf("expected an integer but got %q", value)
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_IntHexadecimalValue{IntHexadecimalValue: uint32(v)}}}}
+	case boolAttr:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("expected true or false but got %q", value)
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_BooleanValue{BooleanValue: value == "true"}}}}
+	case floatAttr:
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return fmt.Errorf("expected a number but got %q", value)
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_FloatValue{FloatValue: float32(v)}}}}
+	case enumAttr:
+		// Converted APKs lose the names, so the plain integer is accepted as well.
+		v, ok := attrEnums[attr.Name][value]
+		if !ok {
+			n, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return checkEnum(attr.Name, value)
+			}
+			v = int32(n)
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_IntDecimalValue{IntDecimalValue: v}}}}
+	case flagsAttr:
+		v, err := parseFlags(attr.Name, value)
+		if err != nil {
+			return err
+		}
+		attr.CompiledItem = &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_IntHexadecimalValue{IntHexadecimalValue: v}}}}
+	case refOrBoolAttr:
+		if value == "true" || value == "false" {
+			return setAttrValue(attr, boolAttr, value)
+		}
+		return setAttrValue(attr, refAttr, value)
+	case refOrStringAttr:
+		if strings.HasPrefix(value, "@") {
+			return setAttrValue(attr, refAttr, value)
+		}
+		if attr.GetCompiledItem().GetRef() != nil {
+			warnf("Replacing the resource reference %s of android:%s with a literal string, which can't be localized", attrValue(attr), attr.Name)
+		}
+		return setAttrValue(attr, stringAttr, value)
+	case refAttr:
+		ref, err := parseReference(value)
+		if err != nil {
+			return err
+		}
+		attr.CompiledItem = &Item{Value: &Item_Ref{Ref: ref}}
+	default:
+		attr.CompiledItem = nil
+		keepValue = true
+	}
+	if keepValue {
+		attr.Value = value
+	}
+	return nil
+}
+
+// parseReference parses a resource reference by ID, like @0x7f120001, or by name, like @xml/backup_rules.
+// The referenced resource has to exist in the app.
+func parseReference(value string) (*Reference, error) {
+	name, ok := strings.CutPrefix(value, "@")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("expected a resource reference like @xml/name or @0x7f120001 but got %q", value)
+	}
+	if strings.HasPrefix(name, "0x") {
+		id, err := strconv.ParseUint(name, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource ID in %q", value)
+		}
+		return &Reference{Id: uint32(id)}, nil
+	}
+	if !strings.Contains(name, "/") {
+		return nil, fmt.Errorf("expected a resource reference like @xml/name but got %q", value)
+	}
+	return &Reference{Name: name}, nil
+}
+
+// attrValue returns a human-readable representation of the attribute's value.
+func attrValue(attr *XmlAttribute) string {
+	if attr.GetValue() != "" {
+		return attr.GetValue()
+	}
+	if ref := attr.GetCompiledItem().GetRef(); ref != nil {
+		if ref.GetName() != "" {
+			return "@" + ref.GetName()
+		}
+		return fmt.Sprintf("@0x%08x", ref.GetId())
+	}
+	switch x := attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+	case *Primitive_IntDecimalValue:
+		return fmt.Sprint(x.IntDecimalValue)
+	case *Primitive_IntHexadecimalValue:
+		return fmt.Sprintf("0x%x", x.IntHexadecimalValue)
+	case *Primitive_BooleanValue:
+		return strconv.FormatBool(x.BooleanValue)
+	case *Primitive_FloatValue:
+		return fmt.Sprint(x.FloatValue)
+	}
+	return ""
+}
+
+// qualifiedName returns the attribute name with the namespace prefix declared on root, if any.
+func qualifiedName(root *XmlElement, uri string, name string) string {
+	if uri == "" {
+		return name
+	}
+	for _, decl := range root.GetNamespaceDeclaration() {
+		if decl.GetUri() == uri {
+			return decl.GetPrefix() + ":" + name
+		}
+	}
+	if uri == namespace {
+		return "android:" + name
+	}
+	return uri + ":" + name
+}
+
+func findAttr(element *XmlElement, uri string, name string) *XmlAttribute {
+	for _, attr := range element.GetAttribute() {
+		if attr.GetNamespaceUri() == uri && attr.GetName() == name {
+			return attr
+		}
+	}
+	return nil
+}
+
+// addAttr inserts the attribute in the order aapt2's XmlFlattener uses: attributes with a resource ID
+// sorted by ID, followed by the remaining ones sorted by namespace and name.
+func addAttr(element *XmlElement, attr *XmlAttribute) {
+	less := func(a, b *XmlAttribute) bool {
+		if a.GetResourceId() != 0 {
+			return b.GetResourceId() == 0 || a.GetResourceId() < b.GetResourceId()
+		}
+		if b.GetResourceId() != 0 {
+			return false
+		}
+		if a.GetNamespaceUri() != b.GetNamespaceUri() {
+			return a.GetNamespaceUri() < b.GetNamespaceUri()
+		}
+		return a.GetName() < b.GetName()
+	}
+	i := sort.Search(len(element.Attribute), func(i int) bool { return less(attr, element.Attribute[i]) })
+	element.Attribute = append(element.Attribute, nil)
+	copy(element.Attribute[i+1:], element.Attribute[i:])
+	element.Attribute[i] = attr
+}
+
+func childElement(element *XmlElement, name string) *XmlElement {
+	for _, child := range element.GetChild() {
+		if child.GetElement().GetName() == name && child.GetElement().GetNamespaceUri() == "" {
+			return child.GetElement()
+		}
+	}
+	return nil
+}
+
+func childElementOrCreate(element *XmlElement, name string) *XmlElement {
+	if child := childElement(element, name); child != nil {
+		return child
+	}
+	child := &XmlElement{Name: name}
+	element.Child = append(element.Child, &XmlNode{Node: &XmlNode_Element{Element: child}})
+	fmt.Println("Adding missing", name, "element")
+	return child
+}
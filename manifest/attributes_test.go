@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "value.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadValueFile(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		keepWhitespace bool
+		want           string
+	}{
+		{"plain", "1.2.3", false, "1.2.3"},
+		{"trailing newline", "1.2.3\n", false, "1.2.3"},
+		{"CRLF", "1.2.3\r\n", false, "1.2.3"},
+		{"trailing spaces and blank lines", "1.2.3 \t\r\n\r\n", false, "1.2.3"},
+		{"leading whitespace is kept", "  1.2.3\n", false, "  1.2.3"},
+		{"keep whitespace", "1.2.3\r\n", true, "1.2.3\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readValueFile(writeTestFile(t, tt.content), tt.keepWhitespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadAttrsFile(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		keepWhitespace bool
+		want           []string
+	}{
+		{"LF", "android:versionName=1.2.3\nandroid:label=App\n", false, []string{"1.2.3", "App"}},
+		{"CRLF", "android:versionName=1.2.3\r\nandroid:label=App\r\n", false, []string{"1.2.3", "App"}},
+		{"no trailing newline", "android:versionName=1.2.3\r\nandroid:label=App", false, []string{"1.2.3", "App"}},
+		{"trailing spaces", "android:versionName=1.2.3 \t\r\n# comment\r\n\r\nandroid:label=App  \n", false, []string{"1.2.3", "App"}},
+		{"keep whitespace", "android:versionName=1.2.3 \r\nandroid:label=App\t\n", true, []string{"1.2.3 ", "App\t"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sets, err := readAttrsFile(writeTestFile(t, tt.content), tt.keepWhitespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, set := range sets {
+				got = append(got, set.value)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorsUseInputPackage(t *testing.T) {
+	exported, err := parseExported("com.example.app.MainActivity=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative, err := parseExported(".MainActivity=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byPath, err := parseSet("application/activity[.MainActivity]/@android:label=Main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		config editConfig
+	}{
+		{"package", editConfig{packageName: "com.new.app", attrSets: []attrSet{exported, byPath}}},
+		{"rename-package", editConfig{
+			packageName:   "com.new.app",
+			packageRename: &packageRename{old: "com.example.app", new: "com.new.app"},
+			attrSets:      []attrSet{relative, byPath},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, out, err := editManifest(protoManifest(t, patchTestManifest), &tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := manifestAttr(t, out, "", "", "package"); got != "com.new.app" {
+				t.Errorf("package = %q, want com.new.app", got)
+			}
+			activity := childElement(childElement(mustParseManifest(t, out), "application"), "activity")
+			if got := findAttr(activity, namespace, "exported").GetValue(); got != "false" {
+				t.Errorf("android:exported = %q, want false", got)
+			}
+			if got := findAttr(activity, namespace, "label").GetValue(); got != "Main" {
+				t.Errorf("android:label = %q, want Main", got)
+			}
+		})
+	}
+}
+
+func mustParseManifest(t *testing.T, data []byte) *XmlElement {
+	t.Helper()
+	node, err := parseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node.GetElement()
+}
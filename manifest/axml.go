@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// dumpAxml writes the (edited) manifest of the given APK, AAB or proto manifest file to target in
+// the binary XML format. aapt2 only converts whole APKs, so the proto manifest is packed into a
+// temporary proto APK, together with the resource table if there is one.
+func dumpAxml(path string, target string, config *editConfig) error {
+	var in, resources []byte
+	var err error
+	switch {
+	case strings.HasSuffix(path, ".apk"):
+		if err := checkZip(path); err != nil {
+			return err
+		}
+		if proto, err := isProtoApk(path); err != nil {
+			return err
+		} else if proto {
+			if in, err = readFromZip(path, "AndroidManifest.xml"); err != nil {
+				return err
+			}
+			if resources, err = readFromZipIfExists(path, "resources.pb"); err != nil {
+				return err
+			}
+			break
+		}
+		converted, err := createTemp(tmpDir, "*.aar")
+		if err != nil {
+			return err
+		}
+		defer removeTemp(converted)
+		if err := convertApk(path, converted.Name(), "proto"); err != nil {
+			return err
+		}
+		if in, err = readFromZip(converted.Name(), "AndroidManifest.xml"); err != nil {
+			return err
+		}
+		if resources, err = readFromZipIfExists(converted.Name(), "resources.pb"); err != nil {
+			return err
+		}
+	case strings.HasSuffix(path, ".aab"):
+		if err := checkZip(path); err != nil {
+			return err
+		}
+		if in, err = readFromZip(path, aabManifestPath); err != nil {
+			return err
+		}
+		// The resource table is next to the manifest directory of the module.
+		module := strings.TrimSuffix(aabManifestPath, "manifest/AndroidManifest.xml")
+		if resources, err = readFromZipIfExists(path, module+"resources.pb"); err != nil {
+			return err
+		}
+	default:
+		if in, err = readManifestData(path); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(manifest)
+	if _, err := manifest.Write(in); err != nil {
+		return fmt.Errorf("failed writing temp file: %w", err)
+	}
+	if _, _, err := updateManifest(manifest.Name(), config); err != nil {
+		return err
+	}
+	// updateManifest replaces the file, so the edited manifest is read from its path.
+	edited, err := os.ReadFile(manifest.Name())
+	if err != nil {
+		return fmt.Errorf("failed reading temp file: %w", err)
+	}
+
+	protoApk, err := createTemp(tmpDir, "*.aar")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(protoApk)
+	zipWriter := zip.NewWriter(protoApk)
+	if err := writeZipEntry(zipWriter, zip.FileHeader{Name: "AndroidManifest.xml", Method: zip.Deflate}, bytes.NewReader(edited)); err != nil {
+		return err
+	}
+	if resources != nil {
+		if err := writeZipEntry(zipWriter, zip.FileHeader{Name: "resources.pb", Method: zip.Deflate}, bytes.NewReader(resources)); err != nil {
+			return err
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed writing zip file: %w", err)
+	}
+	if err := protoApk.Close(); err != nil {
+		return fmt.Errorf("failed writing zip file: %w", err)
+	}
+
+	binaryApk, err := createTemp(tmpDir, "*.apk")
+	if err != nil {
+		return err
+	}
+	binaryApk.Close()
+	defer removeTemp(binaryApk)
+	if err := convertApk(protoApk.Name(), binaryApk.Name(), "binary"); err != nil {
+		return err
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed creating file: %w", err)
+	}
+	if err := extractFromZip(binaryApk.Name(), "AndroidManifest.xml", out); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed writing file: %w", err)
+	}
+	fmt.Println("Wrote binary XML manifest to", target)
+	return nil
+}
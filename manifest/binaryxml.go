@@ -0,0 +1,698 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"unicode/utf16"
+)
+
+// Chunk types of the binary XML format, see ResourceTypes.h in the Android platform.
+const (
+	resStringPoolType    = 0x0001
+	resXMLType           = 0x0003
+	resXMLStartNamespace = 0x0100
+	resXMLEndNamespace   = 0x0101
+	resXMLStartElement   = 0x0102
+	resXMLEndElement     = 0x0103
+	resXMLCData          = 0x0104
+	resXMLResourceMap    = 0x0180
+)
+
+// Data types of a Res_value.
+const (
+	resValueNull             = 0x00
+	resValueReference        = 0x01
+	resValueAttribute        = 0x02
+	resValueString           = 0x03
+	resValueFloat            = 0x04
+	resValueDimension        = 0x05
+	resValueFraction         = 0x06
+	resValueDynamicReference = 0x07
+	resValueDynamicAttribute = 0x08
+	resValueIntDec           = 0x10
+	resValueIntHex           = 0x11
+	resValueIntBoolean       = 0x12
+	resValueColorARGB8       = 0x1c
+	resValueColorRGB8        = 0x1d
+	resValueColorARGB4       = 0x1e
+	resValueColorRGB4        = 0x1f
+)
+
+// noIndex marks a missing string pool reference, e.g. an attribute without namespace.
+const noIndex = 0xffffffff
+
+const stringPoolUTF8 = 0x100
+
+// decodeBinaryXML converts a binary XML manifest, as found in APKs, to the proto representation
+// aapt2 uses, so it can be edited like any other manifest.
+func decodeBinaryXML(data []byte) (*XmlNode, error) {
+	le := binary.LittleEndian
+	if len(data) < 8 || le.Uint16(data) != resXMLType {
+		return nil, errors.New("not a binary XML file")
+	}
+	if size := int(le.Uint32(data[4:])); size <= len(data) {
+		data = data[:size]
+	}
+	var strs []string
+	var ids []uint32
+	str := func(i uint32) (string, error) {
+		if i == noIndex {
+			return "", nil
+		}
+		if int(i) >= len(strs) {
+			return "", fmt.Errorf("string index %d is out of range", i)
+		}
+		return strs[i], nil
+	}
+
+	var root *XmlNode
+	var stack []*XmlElement
+	var namespaces []*XmlNamespace
+	for offset := int(le.Uint16(data[2:])); offset+8 <= len(data); {
+		typ, headerSize, size := le.Uint16(data[offset:]), int(le.Uint16(data[offset+2:])), int(le.Uint32(data[offset+4:]))
+		if size < 8 || headerSize > size || offset+size > len(data) {
+			return nil, fmt.Errorf("invalid chunk at offset %d", offset)
+		}
+		chunk := data[offset : offset+size]
+		offset += size
+		if typ >= resXMLStartNamespace && typ <= resXMLCData && (headerSize < 16 || size < headerSize+8) {
+			return nil, fmt.Errorf("invalid XML node at offset %d", offset-size)
+		}
+		switch typ {
+		case resStringPoolType:
+			var err error
+			if strs, err = decodeStringPool(chunk); err != nil {
+				return nil, err
+			}
+		case resXMLResourceMap:
+			for i := headerSize; i+4 <= size; i += 4 {
+				ids = append(ids, le.Uint32(chunk[i:]))
+			}
+		case resXMLStartNamespace:
+			prefix, err1 := str(le.Uint32(chunk[headerSize:]))
+			uri, err2 := str(le.Uint32(chunk[headerSize+4:]))
+			if err := errors.Join(err1, err2); err != nil {
+				return nil, err
+			}
+			namespaces = append(namespaces, &XmlNamespace{Prefix: prefix, Uri: uri})
+		case resXMLStartElement:
+			element, err := decodeElement(chunk, headerSize, str, ids)
+			if err != nil {
+				return nil, err
+			}
+			element.NamespaceDeclaration, namespaces = namespaces, nil
+			node := &XmlNode{
+				Node:   &XmlNode_Element{Element: element},
+				Source: sourcePosition(le.Uint32(chunk[8:])),
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Child = append(parent.Child, node)
+			} else if root == nil {
+				root = node
+			} else {
+				return nil, errors.New("the file has more than one root element")
+			}
+			stack = append(stack, element)
+		case resXMLEndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unbalanced end of element")
+			}
+			stack = stack[:len(stack)-1]
+		case resXMLCData:
+			text, err := str(le.Uint32(chunk[headerSize:]))
+			if err != nil {
+				return nil, err
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Child = append(parent.Child, &XmlNode{
+					Node:   &XmlNode_Text{Text: text},
+					Source: sourcePosition(le.Uint32(chunk[8:])),
+				})
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New("the file has no root element")
+	}
+	return root, nil
+}
+
+// sourcePosition returns the position of a node on line, if the encoder recorded one.
+func sourcePosition(line uint32) *SourcePosition {
+	if line == 0 {
+		return nil
+	}
+	return &SourcePosition{LineNumber: line}
+}
+
+// decodeStringPool returns the strings of a string pool chunk, which are either UTF-8 or UTF-16.
+func decodeStringPool(chunk []byte) ([]string, error) {
+	le := binary.LittleEndian
+	if len(chunk) < 28 {
+		return nil, errors.New("invalid string pool")
+	}
+	headerSize := int(le.Uint16(chunk[2:]))
+	count := int(le.Uint32(chunk[8:]))
+	utf8 := le.Uint32(chunk[16:])&stringPoolUTF8 != 0
+	start := int(le.Uint32(chunk[20:]))
+	if headerSize+4*count > len(chunk) || start > len(chunk) {
+		return nil, errors.New("invalid string pool")
+	}
+	strs := make([]string, count)
+	for i := range strs {
+		pos := start + int(le.Uint32(chunk[headerSize+4*i:]))
+		var s string
+		var ok bool
+		if utf8 {
+			s, ok = decodeUTF8String(chunk, pos)
+		} else {
+			s, ok = decodeUTF16String(chunk, pos)
+		}
+		if !ok {
+			return nil, fmt.Errorf("string %d of the string pool is out of range", i)
+		}
+		strs[i] = s
+	}
+	return strs, nil
+}
+
+func decodeUTF8String(chunk []byte, pos int) (string, bool) {
+	// The UTF-16 length comes first and is skipped, then the length in bytes.
+	length := func() (int, bool) {
+		if pos >= len(chunk) {
+			return 0, false
+		}
+		n := int(chunk[pos])
+		pos++
+		if n&0x80 != 0 {
+			if pos >= len(chunk) {
+				return 0, false
+			}
+			n = (n&0x7f)<<8 | int(chunk[pos])
+			pos++
+		}
+		return n, true
+	}
+	if _, ok := length(); !ok {
+		return "", false
+	}
+	n, ok := length()
+	if !ok || pos+n > len(chunk) {
+		return "", false
+	}
+	return string(chunk[pos : pos+n]), true
+}
+
+func decodeUTF16String(chunk []byte, pos int) (string, bool) {
+	le := binary.LittleEndian
+	if pos+2 > len(chunk) {
+		return "", false
+	}
+	n := int(le.Uint16(chunk[pos:]))
+	pos += 2
+	if n&0x8000 != 0 {
+		if pos+2 > len(chunk) {
+			return "", false
+		}
+		n = (n&0x7fff)<<16 | int(le.Uint16(chunk[pos:]))
+		pos += 2
+	}
+	if pos+2*n > len(chunk) {
+		return "", false
+	}
+	units := make([]uint16, n)
+	for i := range units {
+		units[i] = le.Uint16(chunk[pos+2*i:])
+	}
+	return string(utf16.Decode(units)), true
+}
+
+func decodeElement(chunk []byte, headerSize int, str func(uint32) (string, error), ids []uint32) (*XmlElement, error) {
+	le := binary.LittleEndian
+	ext := chunk[headerSize:]
+	if len(ext) < 20 {
+		return nil, errors.New("invalid element")
+	}
+	uri, err1 := str(le.Uint32(ext))
+	name, err2 := str(le.Uint32(ext[4:]))
+	if err := errors.Join(err1, err2); err != nil {
+		return nil, err
+	}
+	element := &XmlElement{NamespaceUri: uri, Name: name}
+	start, stride, count := int(le.Uint16(ext[8:])), int(le.Uint16(ext[10:])), int(le.Uint16(ext[12:]))
+	if stride < 20 || start+stride*count > len(ext) {
+		return nil, fmt.Errorf("invalid attributes of <%s>", name)
+	}
+	for i := 0; i < count; i++ {
+		a := ext[start+stride*i:]
+		nameIndex := le.Uint32(a[4:])
+		attr := &XmlAttribute{}
+		var err error
+		if attr.NamespaceUri, err = str(le.Uint32(a)); err != nil {
+			return nil, err
+		}
+		if attr.Name, err = str(nameIndex); err != nil {
+			return nil, err
+		}
+		if int(nameIndex) < len(ids) {
+			attr.ResourceId = ids[nameIndex]
+		}
+		if attr.Value, err = str(le.Uint32(a[8:])); err != nil {
+			return nil, err
+		}
+		typ, data := a[15], le.Uint32(a[16:])
+		if typ == resValueString {
+			// Plain strings aren't compiled in aapt2's proto format.
+			if attr.Value, err = str(data); err != nil {
+				return nil, err
+			}
+		} else if attr.CompiledItem, err = decodeValue(typ, data); err != nil {
+			return nil, fmt.Errorf("attribute %s of <%s>: %w", attr.Name, name, err)
+		}
+		element.Attribute = append(element.Attribute, attr)
+	}
+	return element, nil
+}
+
+func decodeValue(typ uint8, data uint32) (*Item, error) {
+	prim := func(v isPrimitive_OneofValue) (*Item, error) {
+		return &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: v}}}, nil
+	}
+	ref := func(t Reference_Type, dynamic bool) (*Item, error) {
+		r := &Reference{Type: t, Id: data}
+		if dynamic {
+			r.IsDynamic = &Boolean{Value: true}
+		}
+		return &Item{Value: &Item_Ref{Ref: r}}, nil
+	}
+	switch typ {
+	case resValueNull:
+		if data == 1 {
+			return prim(&Primitive_EmptyValue{EmptyValue: &Primitive_EmptyType{}})
+		}
+		return prim(&Primitive_NullValue{NullValue: &Primitive_NullType{}})
+	case resValueReference:
+		return ref(Reference_REFERENCE, false)
+	case resValueAttribute:
+		return ref(Reference_ATTRIBUTE, false)
+	case resValueDynamicReference:
+		return ref(Reference_REFERENCE, true)
+	case resValueDynamicAttribute:
+		return ref(Reference_ATTRIBUTE, true)
+	case resValueFloat:
+		return prim(&Primitive_FloatValue{FloatValue: math.Float32frombits(data)})
+	case resValueDimension:
+		return prim(&Primitive_DimensionValue{DimensionValue: data})
+	case resValueFraction:
+		return prim(&Primitive_FractionValue{FractionValue: data})
+	case resValueIntDec:
+		return prim(&Primitive_IntDecimalValue{IntDecimalValue: int32(data)})
+	case resValueIntHex:
+		return prim(&Primitive_IntHexadecimalValue{IntHexadecimalValue: data})
+	case resValueIntBoolean:
+		return prim(&Primitive_BooleanValue{BooleanValue: data != 0})
+	case resValueColorARGB8:
+		return prim(&Primitive_ColorArgb8Value{ColorArgb8Value: data})
+	case resValueColorRGB8:
+		return prim(&Primitive_ColorRgb8Value{ColorRgb8Value: data})
+	case resValueColorARGB4:
+		return prim(&Primitive_ColorArgb4Value{ColorArgb4Value: data})
+	case resValueColorRGB4:
+		return prim(&Primitive_ColorRgb4Value{ColorRgb4Value: data})
+	}
+	return nil, fmt.Errorf("unsupported value type 0x%02x", typ)
+}
+
+// binaryXMLEncoder collects the string pool while the element chunks are written.
+type binaryXMLEncoder struct {
+	body    bytes.Buffer
+	strs    []string
+	indices map[string]uint32
+	// attrIndices maps the names of attributes with a resource ID to their string index. These
+	// strings come first, in the order of the resource map.
+	attrIndices map[attrKey]uint32
+	ids         []uint32
+}
+
+type attrKey struct {
+	name string
+	id   uint32
+}
+
+// encodeBinaryXML converts a proto manifest to the binary XML format, like aapt2 convert does.
+// Resource references need their IDs, because binary XML has no way to express names.
+func encodeBinaryXML(node *XmlNode) ([]byte, error) {
+	root := node.GetElement()
+	if root == nil {
+		return nil, errors.New("the manifest has no root element")
+	}
+	e := &binaryXMLEncoder{indices: map[string]uint32{}, attrIndices: map[attrKey]uint32{}}
+	// The resource map covers the first strings, so the attribute names with an ID are added
+	// first, sorted by ID like aapt2 does.
+	var keys []attrKey
+	seen := map[attrKey]bool{}
+	var collect func(element *XmlElement)
+	collect = func(element *XmlElement) {
+		for _, attr := range element.GetAttribute() {
+			key := attrKey{attr.GetName(), attr.GetResourceId()}
+			if key.id != 0 && !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		for _, child := range element.GetChild() {
+			if child.GetElement() != nil {
+				collect(child.GetElement())
+			}
+		}
+	}
+	collect(root)
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].id < keys[j].id })
+	for _, key := range keys {
+		e.attrIndices[key] = uint32(len(e.strs))
+		e.strs = append(e.strs, key.name)
+		e.ids = append(e.ids, key.id)
+	}
+
+	if err := e.writeElement(node); err != nil {
+		return nil, err
+	}
+
+	pool := encodeStringPool(e.strs)
+	resourceMap := make([]byte, 8+4*len(e.ids))
+	putChunkHeader(resourceMap, resXMLResourceMap, 8)
+	for i, id := range e.ids {
+		binary.LittleEndian.PutUint32(resourceMap[8+4*i:], id)
+	}
+	out := make([]byte, 8, 8+len(pool)+len(resourceMap)+e.body.Len())
+	out = append(append(append(out, pool...), resourceMap...), e.body.Bytes()...)
+	putChunkHeader(out, resXMLType, 8)
+	return out, nil
+}
+
+// putChunkHeader writes a chunk header at the start of chunk, whose length is the chunk's size.
+func putChunkHeader(chunk []byte, typ uint16, headerSize uint16) {
+	le := binary.LittleEndian
+	le.PutUint16(chunk, typ)
+	le.PutUint16(chunk[2:], headerSize)
+	le.PutUint32(chunk[4:], uint32(len(chunk)))
+}
+
+// index returns the string pool index of s, adding it if needed. The empty string of a missing
+// namespace is noIndex.
+func (e *binaryXMLEncoder) index(s string) uint32 {
+	if i, ok := e.indices[s]; ok {
+		return i
+	}
+	i := uint32(len(e.strs))
+	e.strs = append(e.strs, s)
+	e.indices[s] = i
+	return i
+}
+
+func (e *binaryXMLEncoder) optionalIndex(s string) uint32 {
+	if s == "" {
+		return noIndex
+	}
+	return e.index(s)
+}
+
+// writeNode writes a node chunk with the line number and no comment, followed by ext.
+func (e *binaryXMLEncoder) writeNode(typ uint16, line uint32, ext ...uint32) {
+	chunk := make([]byte, 16+4*len(ext))
+	le := binary.LittleEndian
+	le.PutUint32(chunk[8:], line)
+	le.PutUint32(chunk[12:], noIndex)
+	for i, v := range ext {
+		le.PutUint32(chunk[16+4*i:], v)
+	}
+	putChunkHeader(chunk, typ, 16)
+	e.body.Write(chunk)
+}
+
+func (e *binaryXMLEncoder) writeElement(node *XmlNode) error {
+	le := binary.LittleEndian
+	element := node.GetElement()
+	line := node.GetSource().GetLineNumber()
+	for _, ns := range element.GetNamespaceDeclaration() {
+		e.writeNode(resXMLStartNamespace, line, e.optionalIndex(ns.GetPrefix()), e.index(ns.GetUri()))
+	}
+
+	attrs := element.GetAttribute()
+	chunk := make([]byte, 16+20+20*len(attrs))
+	le.PutUint32(chunk[8:], line)
+	le.PutUint32(chunk[12:], noIndex)
+	ext := chunk[16:]
+	le.PutUint32(ext, e.optionalIndex(element.GetNamespaceUri()))
+	le.PutUint32(ext[4:], e.index(element.GetName()))
+	le.PutUint16(ext[8:], 20)
+	le.PutUint16(ext[10:], 20)
+	le.PutUint16(ext[12:], uint16(len(attrs)))
+	for i, attr := range attrs {
+		a := ext[20+20*i:]
+		name := e.index(attr.GetName())
+		if attr.GetResourceId() != 0 {
+			name = e.attrIndices[attrKey{attr.GetName(), attr.GetResourceId()}]
+		} else if attr.GetNamespaceUri() == "" {
+			// The 1-based indices of the id, class and style attributes are stored separately.
+			switch attr.GetName() {
+			case "id":
+				le.PutUint16(ext[14:], uint16(i+1))
+			case "class":
+				le.PutUint16(ext[16:], uint16(i+1))
+			case "style":
+				le.PutUint16(ext[18:], uint16(i+1))
+			}
+		}
+		raw, typ, data, err := e.encodeValue(attr)
+		if err != nil {
+			return fmt.Errorf("attribute %s of <%s>: %w", attr.GetName(), element.GetName(), err)
+		}
+		le.PutUint32(a, e.optionalIndex(attr.GetNamespaceUri()))
+		le.PutUint32(a[4:], name)
+		le.PutUint32(a[8:], raw)
+		le.PutUint16(a[12:], 8)
+		a[15] = typ
+		le.PutUint32(a[16:], data)
+	}
+	putChunkHeader(chunk, resXMLStartElement, 16)
+	e.body.Write(chunk)
+
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			if err := e.writeElement(child); err != nil {
+				return err
+			}
+			continue
+		}
+		text := e.index(child.GetText())
+		e.writeNode(resXMLCData, child.GetSource().GetLineNumber(), text, 8|resValueString<<24, text)
+	}
+
+	e.writeNode(resXMLEndElement, line, e.optionalIndex(element.GetNamespaceUri()), e.index(element.GetName()))
+	for i := len(element.GetNamespaceDeclaration()) - 1; i >= 0; i-- {
+		ns := element.GetNamespaceDeclaration()[i]
+		e.writeNode(resXMLEndNamespace, line, e.optionalIndex(ns.GetPrefix()), e.index(ns.GetUri()))
+	}
+	return nil
+}
+
+// encodeValue returns the raw value index and the typed value of attr.
+func (e *binaryXMLEncoder) encodeValue(attr *XmlAttribute) (uint32, uint8, uint32, error) {
+	raw := e.optionalIndex(attr.GetValue())
+	item := attr.GetCompiledItem()
+	switch {
+	case item == nil:
+		i := e.index(attr.GetValue())
+		return i, resValueString, i, nil
+	case item.GetStr() != nil:
+		i := e.index(item.GetStr().GetValue())
+		return i, resValueString, i, nil
+	case item.GetRawStr() != nil:
+		i := e.index(item.GetRawStr().GetValue())
+		return i, resValueString, i, nil
+	case item.GetRef() != nil:
+		ref := item.GetRef()
+		if ref.GetId() == 0 {
+			return 0, 0, 0, fmt.Errorf("the reference @%s has no resource ID, which binary XML requires", ref.GetName())
+		}
+		typ := uint8(resValueReference)
+		switch {
+		case ref.GetType() == Reference_ATTRIBUTE && ref.GetIsDynamic().GetValue():
+			typ = resValueDynamicAttribute
+		case ref.GetType() == Reference_ATTRIBUTE:
+			typ = resValueAttribute
+		case ref.GetIsDynamic().GetValue():
+			typ = resValueDynamicReference
+		}
+		return raw, typ, ref.GetId(), nil
+	case item.GetPrim() != nil:
+		switch x := item.GetPrim().GetOneofValue().(type) {
+		case *Primitive_NullValue:
+			return raw, resValueNull, 0, nil
+		case *Primitive_EmptyValue:
+			return raw, resValueNull, 1, nil
+		case *Primitive_FloatValue:
+			return raw, resValueFloat, math.Float32bits(x.FloatValue), nil
+		case *Primitive_DimensionValue:
+			return raw, resValueDimension, x.DimensionValue, nil
+		case *Primitive_FractionValue:
+			return raw, resValueFraction, x.FractionValue, nil
+		case *Primitive_IntDecimalValue:
+			return raw, resValueIntDec, uint32(x.IntDecimalValue), nil
+		case *Primitive_IntHexadecimalValue:
+			return raw, resValueIntHex, x.IntHexadecimalValue, nil
+		case *Primitive_BooleanValue:
+			if x.BooleanValue {
+				return raw, resValueIntBoolean, 0xffffffff, nil
+			}
+			return raw, resValueIntBoolean, 0, nil
+		case *Primitive_ColorArgb8Value:
+			return raw, resValueColorARGB8, x.ColorArgb8Value, nil
+		case *Primitive_ColorRgb8Value:
+			return raw, resValueColorRGB8, x.ColorRgb8Value, nil
+		case *Primitive_ColorArgb4Value:
+			return raw, resValueColorARGB4, x.ColorArgb4Value, nil
+		case *Primitive_ColorRgb4Value:
+			return raw, resValueColorRGB4, x.ColorRgb4Value, nil
+		}
+	}
+	return 0, 0, 0, errors.New("the compiled value can't be expressed in binary XML")
+}
+
+// encodeStringPool writes the strings as a UTF-16 string pool, which all platform versions read.
+func encodeStringPool(strs []string) []byte {
+	le := binary.LittleEndian
+	var data []byte
+	offsets := make([]byte, 4*len(strs))
+	for i, s := range strs {
+		le.PutUint32(offsets[4*i:], uint32(len(data)))
+		units := utf16.Encode([]rune(s))
+		if len(units) > 0x7fff {
+			data = le.AppendUint16(data, uint16(0x8000|len(units)>>16))
+		}
+		data = le.AppendUint16(data, uint16(len(units)&0xffff))
+		for _, u := range units {
+			data = le.AppendUint16(data, u)
+		}
+		data = le.AppendUint16(data, 0)
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+	header := make([]byte, 28)
+	le.PutUint32(header[8:], uint32(len(strs)))
+	le.PutUint32(header[20:], uint32(28+len(offsets)))
+	chunk := append(append(header, offsets...), data...)
+	putChunkHeader(chunk, resStringPoolType, 28)
+	return chunk
+}
+
+// updateBinaryManifest edits a standalone binary XML manifest with the built-in codec. It's only
+// written if something changed, so an unchanged file keeps aapt2's exact encoding.
+func updateBinaryManifest(path string, config *editConfig) ([]change, bool, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading file: %w", err)
+	}
+	xmlNode, err := decodeBinaryXML(in)
+	if err != nil {
+		return nil, false, withExitCode(exitParse, fmt.Errorf("failed to parse binary XML manifest: %w", err))
+	}
+	changes, edited, err := editDecodedManifest(xmlNode, config)
+	if err != nil || edited == nil {
+		return changes, false, err
+	}
+	out, err := encodeBinaryXML(edited)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed encoding binary XML: %w", err)
+	}
+	if err := replaceFile(path, out); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// editDecodedManifest applies the edits to a manifest read from another format than proto. It
+// returns the edited manifest, or nil if nothing changed.
+func editDecodedManifest(xmlNode *XmlNode, config *editConfig) ([]change, *XmlNode, error) {
+	data, err := xmlNode.MarshalVT()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed marshalling XML: %w", err)
+	}
+	changes, out, err := editManifest(data, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(data, out) {
+		fmt.Println("Manifest unchanged, no write needed")
+		return changes, nil, nil
+	}
+	edited, err := parseManifest(out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return changes, edited, nil
+}
+
+// nativeConvert is aapt2Convert for -native-axml: only the manifest is converted with the built-in
+// binary XML codec and every other entry, including the resource table, is kept as it is.
+func nativeConvert(in string, out string, format string) error {
+	data, err := readFromZip(in, "AndroidManifest.xml")
+	if err != nil {
+		return err
+	}
+	var converted []byte
+	if format == "proto" {
+		xmlNode, err := decodeBinaryXML(data)
+		if err != nil {
+			return withExitCode(exitParse, fmt.Errorf("failed to parse the binary XML manifest: %w", err))
+		}
+		if converted, err = xmlNode.MarshalVT(); err != nil {
+			return fmt.Errorf("failed marshalling XML: %w", err)
+		}
+	} else {
+		xmlNode, err := parseManifest(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if converted, err = encodeBinaryXML(xmlNode); err != nil {
+			return fmt.Errorf("failed encoding binary XML: %w", err)
+		}
+	}
+
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(manifest)
+	if _, err := manifest.Write(converted); err != nil {
+		return fmt.Errorf("failed writing temp file: %w", err)
+	}
+	if err := copyFile(in, out); err != nil {
+		return err
+	}
+	return addToZipNative(out, "AndroidManifest.xml", manifest, nil, nil)
+}
+
+// isBinaryXMLFile reports whether the file at path starts like a binary XML file.
+func isBinaryXMLFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, len(binaryXMLHeader))
+	if _, err := io.ReadFull(file, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, binaryXMLHeader)
+}
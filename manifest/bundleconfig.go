@@ -0,0 +1,292 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// bundleConfigPath is the AAB entry holding bundletool's BundleConfig message.
+const bundleConfigPath = "BundleConfig.pb"
+
+// Field numbers from bundletool's config.proto: BundleConfig.bundletool and Bundletool.version.
+// We don't have generated code for it, so the message is edited on the wire level, which leaves
+// all other fields exactly as they were.
+const (
+	bundleConfigBundletoolField = 1
+	bundletoolVersionField      = 2
+)
+
+var bundletoolVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z.-]+)?$`)
+
+func checkBundletoolVersion(version string) error {
+	if !bundletoolVersionPattern.MatchString(version) {
+		return fmt.Errorf("invalid bundletool version %q, expected MAJOR.MINOR.PATCH like 1.15.6", version)
+	}
+	return nil
+}
+
+// setBundletoolVersion returns the BundleConfig with its bundletool.version set to version and the
+// previous version, which is empty if there was none.
+func setBundletoolVersion(config []byte, version string) ([]byte, string, error) {
+	var out []byte
+	var old string
+	found := false
+	for len(config) > 0 {
+		num, typ, n := protowire.ConsumeField(config)
+		if n < 0 {
+			return nil, "", fmt.Errorf("invalid BundleConfig: %w", protowire.ParseError(n))
+		}
+		field := config[:n]
+		config = config[n:]
+		if num != bundleConfigBundletoolField || typ != protowire.BytesType {
+			out = append(out, field...)
+			continue
+		}
+		_, _, tagLen := protowire.ConsumeTag(field)
+		value, _ := protowire.ConsumeBytes(field[tagLen:])
+		bundletool, prev, err := setStringField(value, bundletoolVersionField, version)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid BundleConfig.bundletool: %w", err)
+		}
+		if !found {
+			old = prev
+		}
+		found = true
+		out = protowire.AppendTag(out, bundleConfigBundletoolField, protowire.BytesType)
+		out = protowire.AppendBytes(out, bundletool)
+	}
+	if !found {
+		bundletool, _, _ := setStringField(nil, bundletoolVersionField, version)
+		out = protowire.AppendTag(out, bundleConfigBundletoolField, protowire.BytesType)
+		out = protowire.AppendBytes(out, bundletool)
+	}
+	return out, old, nil
+}
+
+// setStringField replaces all occurrences of the string field num in msg with a single one set
+// to value, keeping all other fields. It returns the last previous value.
+func setStringField(msg []byte, num protowire.Number, value string) ([]byte, string, error) {
+	var out []byte
+	var old string
+	for len(msg) > 0 {
+		fieldNum, typ, n := protowire.ConsumeField(msg)
+		if n < 0 {
+			return nil, "", protowire.ParseError(n)
+		}
+		if fieldNum == num {
+			if typ != protowire.BytesType {
+				return nil, "", errors.New("unexpected wire type for a string field")
+			}
+			_, _, tagLen := protowire.ConsumeTag(msg)
+			s, _ := protowire.ConsumeString(msg[tagLen:])
+			old = s
+		} else {
+			out = append(out, msg[:n]...)
+		}
+		msg = msg[n:]
+	}
+	out = protowire.AppendTag(out, num, protowire.BytesType)
+	out = protowire.AppendString(out, value)
+	return out, old, nil
+}
+
+// Field numbers of the optimizations in config.proto: BundleConfig.optimizations,
+// Optimizations.splits_config and .uncompress_native_libraries, SplitsConfig.split_dimension,
+// SplitDimension.value and .negate, and UncompressNativeLibraries.enabled.
+const (
+	bundleConfigOptimizationsField = 2
+	splitsConfigField              = 1
+	uncompressNativeLibrariesField = 2
+	splitDimensionField            = 1
+	splitDimensionValueField       = 1
+	splitDimensionNegateField      = 2
+	uncompressEnabledField         = 1
+)
+
+// splitDimensionValues are the values of bundletool's SplitDimension.Value enum.
+var splitDimensionValues = map[string]uint64{
+	"ABI":                        1,
+	"SCREEN_DENSITY":             2,
+	"LANGUAGE":                   3,
+	"TEXTURE_COMPRESSION_FORMAT": 4,
+	"DEVICE_TIER":                6,
+	"COUNTRY_SET":                7,
+}
+
+// splitDimension is a -split-dimension NAME=true|false, which enables or disables the splits of
+// a dimension when bundletool builds the APKs.
+type splitDimension struct {
+	name    string
+	enabled bool
+}
+
+func parseSplitDimension(s string) (splitDimension, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.ToUpper(strings.TrimSpace(name))
+	enabled, err := strconv.ParseBool(value)
+	if !ok || err != nil {
+		return splitDimension{}, fmt.Errorf("expected NAME=true or NAME=false but got %q", s)
+	}
+	if _, ok := splitDimensionValues[name]; !ok {
+		names := slices.Sorted(maps.Keys(splitDimensionValues))
+		return splitDimension{}, fmt.Errorf("unknown split dimension %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return splitDimension{name: name, enabled: enabled}, nil
+}
+
+// setUncompressNativeLibraries returns the BundleConfig with
+// optimizations.uncompress_native_libraries.enabled set and the previous value, if there was one.
+func setUncompressNativeLibraries(config []byte, enabled bool) ([]byte, *bool, error) {
+	var old *bool
+	out, err := editMessageField(config, bundleConfigOptimizationsField, func(optimizations []byte) ([]byte, error) {
+		return editMessageField(optimizations, uncompressNativeLibrariesField, func(uncompress []byte) ([]byte, error) {
+			if v, ok := varintField(uncompress, uncompressEnabledField); ok {
+				prev := v != 0
+				old = &prev
+			}
+			return setVarintField(uncompress, uncompressEnabledField, protowire.EncodeBool(enabled))
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid BundleConfig: %w", err)
+	}
+	return out, old, nil
+}
+
+// setSplitDimension returns the BundleConfig with the dimension's negate flag set in
+// optimizations.splits_config, adding the dimension if it isn't listed, and whether it was enabled
+// before, if it was listed.
+func setSplitDimension(config []byte, dim splitDimension) ([]byte, *bool, error) {
+	value := splitDimensionValues[dim.name]
+	var old *bool
+	out, err := editMessageField(config, bundleConfigOptimizationsField, func(optimizations []byte) ([]byte, error) {
+		return editMessageField(optimizations, splitsConfigField, func(splits []byte) ([]byte, error) {
+			var out []byte
+			found := false
+			for len(splits) > 0 {
+				num, typ, n := protowire.ConsumeField(splits)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				field := splits[:n]
+				splits = splits[n:]
+				if num != splitDimensionField || typ != protowire.BytesType {
+					out = append(out, field...)
+					continue
+				}
+				_, _, tagLen := protowire.ConsumeTag(field)
+				msg, _ := protowire.ConsumeBytes(field[tagLen:])
+				if v, _ := varintField(msg, splitDimensionValueField); v == value {
+					negate, _ := varintField(msg, splitDimensionNegateField)
+					prev := negate == 0
+					old, found = &prev, true
+					var err error
+					if msg, err = setVarintField(msg, splitDimensionNegateField, protowire.EncodeBool(!dim.enabled)); err != nil {
+						return nil, err
+					}
+				}
+				out = protowire.AppendTag(out, splitDimensionField, protowire.BytesType)
+				out = protowire.AppendBytes(out, msg)
+			}
+			if !found {
+				var msg []byte
+				msg = protowire.AppendTag(msg, splitDimensionValueField, protowire.VarintType)
+				msg = protowire.AppendVarint(msg, value)
+				msg = protowire.AppendTag(msg, splitDimensionNegateField, protowire.VarintType)
+				msg = protowire.AppendVarint(msg, protowire.EncodeBool(!dim.enabled))
+				out = protowire.AppendTag(out, splitDimensionField, protowire.BytesType)
+				out = protowire.AppendBytes(out, msg)
+			}
+			return out, nil
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid BundleConfig: %w", err)
+	}
+	return out, old, nil
+}
+
+// editMessageField replaces every occurrence of the message field num in msg with the result of
+// edit, keeping all other fields. If msg doesn't have the field, the result of edit(nil) is appended.
+func editMessageField(msg []byte, num protowire.Number, edit func([]byte) ([]byte, error)) ([]byte, error) {
+	var out []byte
+	found := false
+	for len(msg) > 0 {
+		fieldNum, typ, n := protowire.ConsumeField(msg)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		field := msg[:n]
+		msg = msg[n:]
+		if fieldNum != num || typ != protowire.BytesType {
+			out = append(out, field...)
+			continue
+		}
+		_, _, tagLen := protowire.ConsumeTag(field)
+		value, _ := protowire.ConsumeBytes(field[tagLen:])
+		edited, err := edit(value)
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		out = protowire.AppendTag(out, num, protowire.BytesType)
+		out = protowire.AppendBytes(out, edited)
+	}
+	if !found {
+		edited, err := edit(nil)
+		if err != nil {
+			return nil, err
+		}
+		out = protowire.AppendTag(out, num, protowire.BytesType)
+		out = protowire.AppendBytes(out, edited)
+	}
+	return out, nil
+}
+
+// varintField returns the last value of the varint field num in msg.
+func varintField(msg []byte, num protowire.Number) (uint64, bool) {
+	var value uint64
+	found := false
+	for len(msg) > 0 {
+		fieldNum, typ, n := protowire.ConsumeField(msg)
+		if n < 0 {
+			return 0, false
+		}
+		if fieldNum == num && typ == protowire.VarintType {
+			_, _, tagLen := protowire.ConsumeTag(msg)
+			value, _ = protowire.ConsumeVarint(msg[tagLen:])
+			found = true
+		}
+		msg = msg[n:]
+	}
+	return value, found
+}
+
+// setVarintField is like setStringField for a varint field like a bool or enum.
+func setVarintField(msg []byte, num protowire.Number, value uint64) ([]byte, error) {
+	var out []byte
+	for len(msg) > 0 {
+		fieldNum, typ, n := protowire.ConsumeField(msg)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		if fieldNum == num {
+			if typ != protowire.VarintType {
+				return nil, errors.New("unexpected wire type for a varint field")
+			}
+		} else {
+			out = append(out, msg[:n]...)
+		}
+		msg = msg[n:]
+	}
+	out = protowire.AppendTag(out, num, protowire.VarintType)
+	out = protowire.AppendVarint(out, value)
+	return out, nil
+}
@@ -0,0 +1,2725 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	namespace       = "http://schemas.android.com/apk/res/android"
+	versionCodeAttr = "versionCode"
+	versionNameAttr = "versionName"
+)
+
+// aabManifestPath is the entry of an AAB's canonical manifest, which -manifestPath overrides.
+var aabManifestPath = "base/manifest/AndroidManifest.xml"
+
+// tmpDir holds the intermediate files like converted APKs, set by -tmpdir.
+var tmpDir = defaultTmpDir()
+
+// defaultTmpDir is $TMPDIR if it's set, also on Windows, where os.TempDir only reads TMP and TEMP.
+func defaultTmpDir() string {
+	if dir := os.Getenv("TMPDIR"); dir != "" {
+		return dir
+	}
+	return os.TempDir()
+}
+
+// zipCreatorVersion overrides the "version made by" of rewritten zip entries if not 0.
+var zipCreatorVersion uint16
+
+// verbose enables additional diagnostic output like aapt2's warnings.
+var verbose bool
+
+// aapt2Path is the aapt2 binary, set by -aapt2 or AAPT2_PATH. A plain name is looked up in PATH.
+var aapt2Path = "aapt2"
+
+// nativeAxml makes APKs use the built-in binary XML codec instead of aapt2, set by -native-axml.
+var nativeAxml bool
+
+// The version and commit of the build, recorded in reports and provenance. Set by Main.
+var (
+	version = "dev"
+	commit  = ""
+)
+
+type editConfig struct {
+	versionCode int32
+	// If set and versionCode isn't, the manifest's versionCode is increased by this.
+	versionCodeIncrement int32
+	versionName          string
+	// If set, versionName is derived from the (new) versionCode.
+	versionNamePattern *versionPattern
+	// If set, versionName is formatted from the manifest's values.
+	versionNameTemplate *versionTemplate
+	// Appended to versionName or, if that isn't set, the manifest's current versionName.
+	versionNameSuffix string
+	packageName       string
+	glEsVersion       uint32
+	attrSets          []attrSet
+	// The uses-permission entries to add and remove.
+	addPermissions    []string
+	removePermissions []string
+	// The <uses-feature> elements to add or remove and those to change android:required of.
+	addFeatures     []featureSpec
+	removeFeatures  []string
+	featureRequired []featureSpec
+	// The permissions and components to remove by pattern.
+	stripPermissions []stripPattern
+	stripComponents  []stripPattern
+	// The paths of the elements to remove, like manifest/application/activity[.Ads].
+	removeElements []string
+	patch          []change
+	// The <meta-data> entries to add or update below <application>.
+	metaData []metaData
+	// The intent filters to add for verified app links.
+	appLinks []appLink
+	// The packages and intents to add to <queries> for package visibility.
+	queryPackages []string
+	queryIntents  []queryIntent
+	// Custom rewrites applied after all other edits, e.g. -script commands.
+	transformers []Transformer
+	// If set, packageName is its new package and the names derived from the old one are updated.
+	packageRename *packageRename
+	// The values of ${key} placeholders to substitute in all attributes.
+	placeholders map[string]string
+	// The string resources to change in the resource table next to the manifest.
+	stringSets []stringSet
+	// The app names per locale, set in the string android:label references.
+	labelLocales []labelLocale
+	// The -merge overlay's <manifest> element.
+	merge *XmlElement
+	// Only supported for AABs.
+	renameModule *moduleRename
+	// Only supported for AABs.
+	bundletoolVersion string
+	// The BundleConfig optimizations to set, only supported for AABs. uncompressNativeLibs is nil
+	// if it's kept.
+	uncompressNativeLibs *bool
+	splitDimensions      []splitDimension
+	// The SHA-256 the input must have to be modified, in hex.
+	expectSHA256 string
+	// If set, APKs are re-signed after editing.
+	signing *signingConfig
+
+	skipUnchanged        bool
+	backup               bool
+	preserveSigningBlock bool
+	noReconvert          bool
+	strict               bool
+	verify               bool
+	verifyBadging        bool
+	embedProvenance      bool
+	allManifests         bool
+	emitPatch            string
+	emitDelta            string
+	maxReportLen         int
+	// If set, only the base module's manifest of an AAB is edited.
+	baseOnly bool
+	// If set, only the manifests of these modules of an AAB are edited besides the base module's.
+	modules []string
+	// Set for the manifests besides the canonical one, i.e. the other modules of an AAB and split
+	// APKs, which don't get the package, versionCode or versionName added if they lack them.
+	secondary bool
+	// The resource table of the edited manifest, set per manifest of a zip file.
+	resources *resourceTable
+	// Set for text XML manifests, which keep references by name for aapt2 to resolve.
+	textXML bool
+}
+
+// Main runs the command line in os.Args and exits the process, with the build's version and commit.
+func Main(buildVersion string, buildCommit string) {
+	version, commit = buildVersion, buildCommit
+	command := parseSubcommand()
+	if command != nil && command.name == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
+	if command != nil && command.name == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	versionCode := flag.Uint("versionCode", 0, "The versionCode to set")
+	incrementVersionCode := flag.Bool("incrementVersionCode", false, "Increase the manifest's versionCode by one (-versionCode takes precedence)")
+	versionCodeIncrement := flag.Uint("versionCode-increment", 0, "Increase the manifest's versionCode by this, e.g. 10 (-versionCode takes precedence)")
+	versionName := flag.String("versionName", "", "The versionName to set")
+	versionNameFromCode := flag.String("versionName-from-code", "", "Derive the versionName from the versionCode with this pattern, e.g. #.##.## turns 10203 into 1.2.3")
+	versionNameSuffix := flag.String("versionNameSuffix", "", "Append this to the versionName, e.g. -beta. Without -versionName it's appended to the manifest's current one")
+	versionNameFile := flag.String("versionNameFile", "", "Read the versionName to set from this file")
+	revisionCode := flag.String("revisionCode", "", "The android:revisionCode to set, e.g. for split APKs")
+	minSdkVersion := flag.String("minSdkVersion", "", "The android:minSdkVersion to set on the uses-sdk element")
+	targetSdkVersion := flag.String("targetSdkVersion", "", "The android:targetSdkVersion to set on the uses-sdk element")
+	compileSdkVersion := flag.String("compileSdkVersion", "", "The android:compileSdkVersion to set on the manifest element")
+	compileSdkVersionCodename := flag.String("compileSdkVersionCodename", "", "The android:compileSdkVersionCodename to set on the manifest element, e.g. 14")
+	targetSandboxVersion := flag.String("targetSandboxVersion", "", "The android:targetSandboxVersion to set on the manifest element: 1 or 2")
+	installLocation := flag.String("installLocation", "", "The android:installLocation to set on the manifest element: auto, internalOnly or preferExternal")
+	sharedUserId := flag.String("sharedUserId", "", "The android:sharedUserId to set on the manifest element")
+	platformBuildVersionCode := flag.String("platformBuildVersionCode", "", "The platformBuildVersionCode to set on the manifest element, the SDK level the app was built against")
+	platformBuildVersionName := flag.String("platformBuildVersionName", "", "The platformBuildVersionName to set on the manifest element, e.g. 14")
+	sharedUserMaxSdkVersion := flag.String("sharedUserMaxSdkVersion", "", "The android:sharedUserMaxSdkVersion to set, the last SDK level that uses the sharedUserId")
+	packageName := flag.String("package", "", "The package to set")
+	renamePackage := flag.String("rename-package", "", "Change the package as old=new and update relative class names, authorities, task affinities and permissions that depend on it")
+	requiredSplitTypes := flag.String("requiredSplitTypes", "", "The android:requiredSplitTypes to set")
+	splitTypes := flag.String("splitTypes", "", "The android:splitTypes to set")
+	var applicationEnabled boolFlag
+	flag.Var(&applicationEnabled, "applicationEnabled", "The android:enabled to set on the application element")
+	var appBools listFlag
+	flag.Var(&appBools, "app-bool", "A boolean android attribute to set on the application element as name=true|false (repeatable)")
+	var persistent boolFlag
+	flag.Var(&persistent, "persistent", "The android:persistent to set on the application element")
+	var restoreAnyVersion boolFlag
+	flag.Var(&restoreAnyVersion, "restoreAnyVersion", "The android:restoreAnyVersion to set on the application element")
+	var extractNativeLibs, largeHeap, hardwareAccelerated, requestLegacyExternalStorage boolFlag
+	flag.Var(&extractNativeLibs, "extractNativeLibs", "The android:extractNativeLibs to set on the application element. false needs uncompressed lib/*.so entries")
+	flag.Var(&largeHeap, "largeHeap", "The android:largeHeap to set on the application element")
+	flag.Var(&hardwareAccelerated, "hardwareAccelerated", "The android:hardwareAccelerated to set on the application element")
+	flag.Var(&requestLegacyExternalStorage, "requestLegacyExternalStorage", "The android:requestLegacyExternalStorage to set on the application element, only honored up to targetSdkVersion 29")
+	var debuggable, testOnly, allowBackup boolFlag
+	flag.Var(&debuggable, "debuggable", "The android:debuggable to set on the application element, e.g. =false for a release build")
+	flag.Var(&testOnly, "test-only", "The android:testOnly to set on the application element. Test-only APKs only install with adb install -t")
+	flag.Var(&allowBackup, "allow-backup", "The android:allowBackup to set on the application element")
+	backupAgent := flag.String("backupAgent", "", "The android:backupAgent class to set on the application element, e.g. .MyBackupAgent")
+	appComponentFactory := flag.String("appComponentFactory", "", "The android:appComponentFactory class to set on the application element, e.g. .MyComponentFactory")
+	var usesCleartextTraffic boolFlag
+	flag.Var(&usesCleartextTraffic, "uses-cleartext-traffic", "The android:usesCleartextTraffic to set on the application element, e.g. =true for staging servers without TLS")
+	networkSecurityConfig := flag.String("network-security-config", "", "The android:networkSecurityConfig resource to set on the application element, e.g. @xml/network_security_config")
+	dataExtractionRules := flag.String("dataExtractionRules", "", "The android:dataExtractionRules resource to set, e.g. @xml/data_extraction_rules")
+	fullBackupContent := flag.String("fullBackupContent", "", "The android:fullBackupContent resource (or true/false) to set")
+	var permissionFlags listFlag
+	var permissionMaxSdk listFlag
+	flag.Var(&permissionMaxSdk, "permission-max-sdk", "Set android:maxSdkVersion on a uses-permission as permission=level, e.g. android.permission.WRITE_EXTERNAL_STORAGE=28, or remove it with =none (repeatable)")
+	flag.Var(&permissionFlags, "set-permission-flags", "Set android:usesPermissionFlags on a uses-permission as permission=flags, e.g. android.permission.BLUETOOTH_SCAN=neverForLocation (repeatable)")
+	var grantUri listFlag
+	flag.Var(&grantUri, "set-grant-uri", "Set android:grantUriPermissions on a provider as name=true|false, e.g. androidx.core.content.FileProvider=true (repeatable)")
+	var exported listFlag
+	flag.Var(&exported, "set-exported", "Set android:exported on a component as name=true|false, e.g. .MainActivity=true (repeatable)")
+	var taskAffinity listFlag
+	flag.Var(&taskAffinity, "set-task-affinity", "Set android:taskAffinity on an activity as name=affinity, e.g. com.example.MainActivity=com.example.tasks (repeatable, the affinity may be empty)")
+	var directBoot listFlag
+	flag.Var(&directBoot, "set-directboot", "Set android:directBootAware as selector=true|false, where selector is application or a component selector (repeatable)")
+	var addPermissions listFlag
+	flag.Var(&addPermissions, "addPermission", "Add a uses-permission, e.g. android.permission.CAMERA (repeatable)")
+	flag.Var(&addPermissions, "add-permission", "Same as -addPermission")
+	var removePermissions listFlag
+	var stripPermissionFlags, stripComponentFlags listFlag
+	flag.Var(&stripPermissionFlags, "strip-permission", "Remove the uses-permissions whose name matches this regular expression, e.g. com\\.google\\.android\\.gms\\.permission\\.AD_ID (repeatable)")
+	flag.Var(&stripComponentFlags, "strip-component", "Remove the activities, services, receivers and providers whose class name matches this regular expression, e.g. com\\.adsdk\\..* (repeatable)")
+	var metaDataFlags listFlag
+	var placeholderFlags listFlag
+	flag.Var(&placeholderFlags, "placeholder", "Replace the ${key} placeholder in all attribute values as key=value, like Gradle's manifestPlaceholders (repeatable)")
+	var stringFlags listFlag
+	var labelLocaleFlags listFlag
+	flag.Var(&labelLocaleFlags, "label-locale", "Set the app name of a locale in the string resource android:label references, as locale=label, e.g. es=Mi App (repeatable)")
+	flag.Var(&stringFlags, "set-string", "Change a string resource in the proto resource table as name=value or name[locale]=value, e.g. app_name=Acme (repeatable)")
+	var appLinkFlags listFlag
+	flag.Var(&appLinkFlags, "add-app-link", "Add an autoVerify intent filter to an activity as activity=https://host[/pathPrefix], e.g. .MainActivity=https://links.example.com (repeatable)")
+	var queryPackages, queryIntentFlags listFlag
+	flag.Var(&queryPackages, "add-query-package", "Add a <package> to <queries> to see this app on Android 11+, e.g. com.android.chrome (repeatable)")
+	flag.Var(&queryIntentFlags, "add-query-intent", "Add an <intent> to <queries> as ACTION[;category=NAME][;scheme=S][;host=H][;mimeType=T], e.g. android.intent.action.VIEW;category=android.intent.category.BROWSABLE;scheme=https (repeatable)")
+	flag.Var(&metaDataFlags, "meta-data", "Add or update the application's <meta-data> with this android:name as name=value, e.g. build_id=1234 (repeatable)")
+	flag.Var(&removePermissions, "removePermission", "Remove the uses-permission with this name, e.g. android.permission.READ_PHONE_STATE (repeatable)")
+	flag.Var(&removePermissions, "remove-permission", "Same as -removePermission")
+	var enableOnBackInvokedCallback boolFlag
+	flag.Var(&enableOnBackInvokedCallback, "enableOnBackInvokedCallback", "The android:enableOnBackInvokedCallback to set on the application element")
+	backCallbackComponent := flag.String("back-callback-component", "", "Set -enableOnBackInvokedCallback on the selected activity instead of the application")
+	maxAspectRatio := flag.String("maxAspectRatio", "", "The android:maxAspectRatio to set on the application element, e.g. 2.4")
+	gwpAsanMode := flag.String("gwpAsanMode", "", "The android:gwpAsanMode to set on the application element: default, never or always")
+	label := flag.String("label", "", "The android:label to set on the application element, a literal app name or a reference like @string/app_name")
+	icon := flag.String("icon", "", "The android:icon and android:roundIcon to set on the application element, e.g. @mipmap/ic_launcher_staging")
+	roundIcon := flag.String("round-icon", "", "The android:roundIcon to set instead of the -icon")
+	memtagMode := flag.String("memtagMode", "", "The android:memtagMode to set on the application element: default, off, async or sync")
+	var addFeatureFlags, removeFeatures, featureRequiredFlags listFlag
+	flag.Var(&addFeatureFlags, "add-feature", "Add a uses-feature as name or name=required, e.g. android.hardware.camera=false (repeatable)")
+	flag.Var(&removeFeatures, "remove-feature", "Remove the uses-feature with this name, e.g. android.hardware.telephony (repeatable)")
+	flag.Var(&featureRequiredFlags, "set-feature-required", "Set android:required on a uses-feature as name=true|false, e.g. android.hardware.camera=false (repeatable)")
+	glEsVersion := flag.String("glEsVersion", "", "The OpenGL ES version required via uses-feature, e.g. 3.0")
+	keepWhitespace := flag.Bool("keep-whitespace", false, "Keep trailing whitespace and newlines of values read from -versionNameFile and -attrs-file")
+	var removeAttrs listFlag
+	flag.Var(&removeAttrs, "removeAttr", "Remove an attribute from its well-known element (or the selected -component), e.g. android:testOnly. The prefix defaults to android (repeatable)")
+	flag.Var(&removeAttrs, "remove-attribute", "Same as -removeAttr, e.g. application/@android:usesCleartextTraffic")
+	var removeElementFlags listFlag
+	flag.Var(&removeElementFlags, "remove-element", "Remove the element at this path with its children, e.g. application/activity[com.example.Ads] or application/meta-data[2] (repeatable)")
+	var setFlags listFlag
+	flag.Var(&setFlags, "set", "An attribute assignment as namespace:name=value, e.g. android:debuggable=false. Well-known android attributes don't need the prefix (repeatable)")
+	attrsFile := flag.String("attrs-file", "", "File with one namespace:name=value attribute assignment per line")
+	emitPatch := flag.String("emit-patch", "", "Write the applied attribute changes as a JSON patch to this file")
+	emitDelta := flag.String("emit-delta", "", "Also write the entries of the APK or AAB that this run changed to this zip file")
+	applyPatch := flag.String("apply-patch", "", "Apply the attribute changes from a JSON patch written by -emit-patch")
+	only := flag.String("only", "", "Only apply these comma-separated change categories, e.g. versionCode,package (see the README)")
+	var scripts listFlag
+	flag.Var(&scripts, "script", "Pipe the manifest as text XML through this command after the other edits, e.g. \"python3 rewrite.py\". It prints the rewritten manifest (repeatable, applied in order)")
+	merge := flag.String("merge", "", "Merge the attributes and elements of this overlay manifest (text XML or proto) into the manifest")
+	component := flag.String("component", "", "Apply the -set, -removeAttr and -attrs-file assignments to the selected component instead")
+	backup := flag.Bool("backup", false, "Keep a copy of each edited file as <file>.bak")
+	skipUnchanged := flag.Bool("skipUnchanged", false, "Don't rewrite the file if its content wouldn't change")
+	extract := flag.String("extract", "", "Write the AAB's (edited) base manifest to this path instead of modifying the AAB")
+	printValues := flag.Bool("print", false, "Print the package, versionCode, versionName, minSdkVersion and targetSdkVersion and exit without modifying anything")
+	get := flag.String("get", "", "Print only the value of package, versionCode, versionName, minSdkVersion, targetSdkVersion, compileSdkVersion or maxSdkVersion and exit without modifying anything")
+	printSdk := flag.Bool("print-sdk", false, "Print the SDK versions from the manifest and exit without modifying anything")
+	dumpAxmlPath := flag.String("dump-axml", "", "Write the (edited) manifest in the binary XML format to this path instead of modifying the input (requires aapt2 or -native-axml)")
+	validateOnly := flag.Bool("validate-only", false, "Check the manifest against the -assert assertions without modifying anything and fail if any doesn't pass")
+	var asserts listFlag
+	flag.Var(&asserts, "assert", "An assertion for -validate-only: package=NAME, versionCode>=N, minSdkVersion>=N, targetSdkVersion>=N, not-debuggable or has-launcher (repeatable)")
+	configPath := flag.String("config", "", "Read flags from this JSON file mapping flag names to values, e.g. {\"versionCode\": 42}. Flags on the command line take precedence")
+	inputList := flag.String("input-list", "", "Read additional files to process from this file, one path per line")
+	jobs := flag.Int("jobs", 1, "Process up to this many of the given files at the same time")
+	flag.IntVar(jobs, "parallel", 1, "Same as -jobs")
+	countOnly := flag.Bool("count-only", false, "Only report how many of the given artifacts would change, without modifying them")
+	dryRun := flag.Bool("dryRun", false, "Print the changes the other flags would make without writing anything")
+	flag.BoolVar(dryRun, "dry-run", false, "Same as -dryRun")
+	dump := flag.Bool("dump", false, "Print the whole manifest as XML, or with -json as JSON, and exit without modifying anything")
+	listNamespaces := flag.Bool("list-namespaces", false, "Print the manifest's namespace declarations and exit without modifying anything")
+	jsonOutput := flag.Bool("json", false, "Print -print's, -print-sdk's, -dump's or -list-namespaces' output as JSON. When editing, print a -report style JSON summary instead of the progress messages, which go to stderr")
+	noReconvert := flag.Bool("no-reconvert", false, "Leave APKs in aapt2's proto format instead of converting them back to binary")
+	maxReportLen := flag.Int("max-report-len", 200, "Truncate values longer than this in the printed changes (0 disables truncation)")
+	recursive := flag.Bool("recursive", false, "Process every .apk and .aab file in the given directory and its subdirectories")
+	skipInvalid := flag.Bool("skip-invalid", false, "With -recursive, skip the files with an artifact extension that aren't zip archives instead of failing them")
+	output := flag.String("output", "", "Write the edited file to this path and leave the input untouched (default: edit the input in place)")
+	flag.StringVar(output, "o", "", "Shorthand for -output")
+	expectSHA256 := flag.String("expect-sha256", "", "Refuse to modify the file unless its SHA-256 is this hex digest (exits with code 7)")
+	reportPath := flag.String("report", "", "Write a JSON report with the changes, status and SHA-256 of every processed file to this path")
+	bundletoolVersion := flag.String("bundletool-version", "", "Set the bundletool version recorded in an AAB's BundleConfig.pb, e.g. 1.15.6")
+	var uncompressNativeLibs boolFlag
+	flag.Var(&uncompressNativeLibs, "uncompress-native-libs", "Set optimizations.uncompressNativeLibraries in an AAB's BundleConfig.pb, e.g. -uncompress-native-libs=false")
+	var splitDimensionFlags listFlag
+	flag.Var(&splitDimensionFlags, "split-dimension", "Enable or disable the APK splits of a dimension in an AAB's BundleConfig.pb, e.g. LANGUAGE=false (repeatable)")
+	renameModule := flag.String("rename-module", "", "Experimental: rename an AAB module directory as old=new, e.g. base=app")
+	verify := flag.Bool("verify", false, "Re-parse each edited manifest and fail if it lacks a valid package, versionCode or versionName or uses undeclared namespaces")
+	verifyBadging := flag.Bool("verify-badging", false, "Like -verify, and also run aapt2 dump badging on edited APKs")
+	strict := flag.Bool("strict", false, "Fail if a string value set by this run isn't valid UTF-8, contains control characters or is too long, if the package, versionCode or versionName couldn't be set, or if any other requested change was skipped")
+	keystore := flag.String("ks", "", "Re-sign edited APKs with apksigner using this keystore")
+	keyAlias := flag.String("ks-key-alias", "", "The alias of the signing key in the -ks keystore")
+	ksPass := flag.String("ks-pass", "", "The -ks keystore password as pass:<password>, env:<name>, file:<path> or stdin")
+	keyPass := flag.String("key-pass", "", "The key password if it differs from -ks-pass, in the same forms")
+	signingKey := flag.String("key", "", "Re-sign edited APKs with apksigner using this PKCS#8 private key instead of -ks")
+	signingCert := flag.String("cert", "", "The X.509 certificate (PEM or DER) of the -key")
+	verifySignature := flag.Bool("verify-signature", false, "Run apksigner verify after re-signing with -ks and fail if it doesn't pass")
+	allManifests := flag.Bool("all-manifests", false, "Edit every AndroidManifest.xml entry of an APK or AAB, not just the canonical one")
+	modules := flag.String("modules", "", "Only edit the manifests of these modules of an AAB besides the base module's, comma-separated, e.g. feature1,feature2")
+	baseOnly := flag.Bool("base-only", false, "Only edit the base module's manifest of an AAB, not the manifests of its other modules")
+	embedProvenance := flag.Bool("embed-provenance", false, "Add "+provenancePath+" describing the applied edits to the archive")
+	preserveSigningBlock := flag.Bool("preserve-signing-block", false, "Keep the APK Signing Block (its v2+ signatures become invalid anyway)")
+	flag.BoolVar(&reproducible, "reproducible", false, "Write byte-for-byte reproducible archives: added entries get the time of $SOURCE_DATE_EPOCH or else 1981-01-01 instead of the current time")
+	creatorVersion := flag.String("zip-creator-version", "", "Set the \"version made by\" field of rewritten zip entries, e.g. 0x0314 for Unix and zip 2.0 (default: keep the original)")
+	format := flag.String("format", "", "The format of warnings and errors: text or github (default github in GitHub Actions, otherwise text)")
+	flag.BoolVar(&showProgress, "progress", false, "Print the entries and bytes copied to stderr while an archive is rewritten, about once a second")
+	timeout := flag.Duration("timeout", 0, "Abort the run after this duration, e.g. 5m (exits with code 124)")
+	flag.StringVar(&aapt2Path, "aapt2", "", "The aapt2 binary to use, e.g. /opt/android-sdk/build-tools/34.0.0/aapt2 (default: $AAPT2_PATH, $AAPT2, aapt2 in PATH or in the newest build-tools of $ANDROID_HOME)")
+	flag.StringVar(&buildToolsVersion, "build-tools", "", "Take aapt2 and apksigner from this version of the SDK's build-tools, e.g. 34.0.0 (default: PATH, then the newest)")
+	flag.StringVar(&tmpDir, "tmpdir", tmpDir, "The directory for intermediate files like converted APKs and manifests")
+	flag.StringVar(&aabManifestPath, "manifestPath", aabManifestPath, "The entry of the manifest to edit in an AAB, if it isn't found automatically")
+	flag.BoolVar(&nativeAxml, "native-axml", false, "Convert APK manifests with the built-in binary XML codec instead of aapt2 (experimental)")
+	flag.BoolVar(&verbose, "verbose", false, "Print additional diagnostics like aapt2 warnings")
+	flag.BoolVar(&verbose, "v", false, "Shorthand for -verbose")
+	flag.BoolVar(&quiet, "quiet", false, "Only print warnings and errors when editing, and no notes")
+	flag.BoolVar(&quiet, "q", false, "Shorthand for -quiet")
+	flag.Usage = usage
+	args := os.Args[1:]
+	if command != nil {
+		flag.Usage = command.usage
+		args = os.Args[2:]
+	}
+	flag.CommandLine.Parse(args)
+	if command != nil {
+		command.checkFlags()
+	}
+	recordJobFlags()
+	if *configPath != "" {
+		if err := applyConfigFile(*configPath); err != nil {
+			fatalUsage("Invalid -config:", err)
+		}
+	}
+	if err := setOutputFormat(*format); err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), "Error:", err)
+		exit(exitUsage)
+	}
+	files := flag.Args()
+	// The commands besides set are modes of the flat command line.
+	var verifyCommand, signCommand, checkSignature bool
+	if command != nil {
+		switch command.name {
+		case "get":
+			if len(files) == 2 {
+				*get, files = files[0], files[1:]
+			} else {
+				*printValues = true
+			}
+		case "dump":
+			*dump = true
+		case "verify":
+			// -verify-signature is a check of its own here instead of a step of re-signing.
+			verifyCommand, checkSignature = true, *verifySignature
+			*verifySignature = false
+		case "sign":
+			signCommand = true
+		}
+	}
+	if *inputList != "" {
+		listed, err := readInputList(*inputList)
+		if err != nil {
+			fatalUsage("Invalid -input-list:", err)
+		}
+		files = append(files, listed...)
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(flag.CommandLine.Output(), "Error: File filePath is required.")
+		flag.Usage()
+		exit(exitUsage)
+	}
+	readOnly := verifyCommand || *printValues || *get != "" || *printSdk || *dump || *listNamespaces || *dumpAxmlPath != "" || *countOnly || *dryRun || *validateOnly || *extract != ""
+	// With -json the summary and with the file argument - the manifest is the only output on
+	// stdout, so everything else goes to stderr.
+	stdout := os.Stdout
+	jsonReport := *jsonOutput && (!readOnly || *dryRun)
+	if jsonReport || files[0] == "-" {
+		os.Stdout = os.Stderr
+	}
+	if *verifyBadging && *noReconvert {
+		fatalUsage("-verify-badging can't be combined with -no-reconvert, aapt2 dump badging needs a binary APK")
+	}
+	if quiet && verbose {
+		fatalUsage("-quiet can't be combined with -verbose")
+	}
+	if quiet && !readOnly {
+		devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			fatalUsage(err)
+		}
+		os.Stdout = devNull
+	}
+	if files[0] == "-" && (readOnly || *recursive || *output != "" || *backup || *reportPath != "" || *jsonOutput) {
+		fatalUsage("Reading the manifest from stdin only supports editing, without -output, -backup, -recursive, -report or -json")
+	}
+	if err := checkTmpDir(); err != nil {
+		fatalUsage("Invalid -tmpdir:", err)
+	}
+	if err := checkBuildTools(); err != nil {
+		fatalUsage("Invalid -build-tools:", err)
+	}
+	if *timeout > 0 {
+		startTimeout(*timeout)
+	}
+	removeTempOnInterrupt()
+	resolveAapt2Path()
+	resolveApksignerPath()
+	// Fail before touching any file if one of them needs aapt2. Directories are only checked once
+	// an APK in them is converted.
+	if !*recursive && !signCommand && slices.ContainsFunc(files, needsAapt2) {
+		if err := checkAapt2(); err != nil {
+			log.Println(err)
+			exit(exitCode(err))
+		}
+	}
+	if *creatorVersion != "" {
+		v, err := strconv.ParseUint(*creatorVersion, 0, 16)
+		if err != nil || v == 0 {
+			fatalUsagef("Invalid -zip-creator-version %q: expected a 16-bit number like 0x0314", *creatorVersion)
+		}
+		zipCreatorVersion = uint16(v)
+	}
+	config := &editConfig{
+		versionCode:       int32(*versionCode),
+		versionName:       *versionName,
+		versionNameSuffix: *versionNameSuffix,
+		packageName:       *packageName,
+		addPermissions:    addPermissions,
+		removePermissions: removePermissions,
+
+		skipUnchanged:        *skipUnchanged,
+		backup:               *backup,
+		preserveSigningBlock: *preserveSigningBlock,
+		noReconvert:          *noReconvert,
+		strict:               *strict,
+		verify:               *verify || *verifyBadging,
+		verifyBadging:        *verifyBadging,
+		embedProvenance:      *embedProvenance,
+		allManifests:         *allManifests,
+		baseOnly:             *baseOnly,
+		emitPatch:            *emitPatch,
+		emitDelta:            *emitDelta,
+		maxReportLen:         *maxReportLen,
+	}
+	if *packageName != "" {
+		if err := checkPackageName(*packageName); err != nil {
+			fatalUsage("Invalid -package:", err)
+		}
+	}
+	if *modules != "" {
+		if *baseOnly {
+			fatalUsage("-modules can't be combined with -base-only")
+		}
+		for _, module := range strings.Split(*modules, ",") {
+			if module = strings.TrimSpace(module); module != "" {
+				config.modules = append(config.modules, module)
+			}
+		}
+	}
+	if *renamePackage != "" {
+		r, err := parsePackageRename(*renamePackage)
+		if err != nil {
+			fatalUsage("Invalid -rename-package:", err)
+		}
+		if *packageName != "" && *packageName != r.new {
+			fatalUsage("-package and -rename-package set different packages")
+		}
+		config.packageName, config.packageRename = r.new, &r
+	}
+	if *incrementVersionCode && *versionCodeIncrement > 0 {
+		fatalUsage("-incrementVersionCode can't be combined with -versionCode-increment")
+	}
+	if *versionCodeIncrement > math.MaxInt32 {
+		fatalUsage("-versionCode-increment is too large")
+	}
+	config.versionCodeIncrement = int32(*versionCodeIncrement)
+	if *incrementVersionCode {
+		config.versionCodeIncrement = 1
+	}
+	if config.versionCodeIncrement > 0 && *versionCode > 0 {
+		notef("-versionCode %d takes precedence over -incrementVersionCode and -versionCode-increment", *versionCode)
+	}
+	if *versionNameFromCode != "" {
+		if *versionName != "" || *versionNameFile != "" {
+			fatalUsage("-versionName-from-code can't be combined with -versionName or -versionNameFile")
+		}
+		p, err := parseVersionPattern(*versionNameFromCode)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.versionNamePattern = p
+	}
+	if *versionNameFile != "" {
+		if *versionName != "" {
+			fatalUsage("-versionName and -versionNameFile can't be combined")
+		}
+		v, err := readValueFile(*versionNameFile, *keepWhitespace)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.versionName = v
+	}
+	if strings.Contains(config.versionName, "{") {
+		t, err := parseVersionTemplate(config.versionName)
+		if err != nil {
+			fatalUsage("Invalid -versionName:", err)
+		}
+		config.versionName, config.versionNameTemplate = "", t
+	}
+	single := len(files) == 1
+	if *recursive && !single {
+		fatalUsage("-recursive takes a single directory")
+	}
+	if *skipInvalid && !*recursive {
+		fatalUsage("-skip-invalid only applies with -recursive")
+	}
+	if *jobs < 1 {
+		fatalUsagef("Invalid -jobs %d: expected at least 1", *jobs)
+	}
+	if *jobs > 1 && (*ksPass == "stdin" || *keyPass == "stdin") {
+		fatalUsage("-jobs can't be combined with passwords read from stdin, use env: or file: instead")
+	}
+	if *emitPatch != "" && (*recursive || !single) {
+		fatalUsage("-emit-patch only applies to a single file")
+	}
+	if *emitPatch != "" && (*merge != "" || len(scripts) > 0) {
+		fatalUsage("-emit-patch can't be combined with -merge or -script, a patch can't describe the elements they add")
+	}
+	if isFlagSet("manifestPath") && !*recursive && !slices.ContainsFunc(files, func(p string) bool { return strings.HasSuffix(p, ".aab") }) {
+		fatalUsage("-manifestPath only applies to AABs")
+	}
+	// Zip entries always use forward slashes, also when the entry is typed with backslashes on Windows.
+	aabManifestPath = filepath.ToSlash(aabManifestPath)
+	if *emitDelta != "" {
+		if *recursive || !single || !isArtifact(files[0]) {
+			fatalUsage("-emit-delta is only supported for a single .apk or .aab file")
+		}
+		if *renameModule != "" {
+			fatalUsage("-emit-delta can't be combined with -rename-module, which changes every entry's name")
+		}
+	}
+	if *bundletoolVersion != "" {
+		if *recursive || !single || !strings.HasSuffix(files[0], ".aab") {
+			fatalUsage("-bundletool-version is only supported for a single .aab file")
+		}
+		if err := checkBundletoolVersion(*bundletoolVersion); err != nil {
+			fatalUsage(err)
+		}
+		config.bundletoolVersion = *bundletoolVersion
+	}
+	if uncompressNativeLibs.set || len(splitDimensionFlags) > 0 {
+		if *recursive || !single || !strings.HasSuffix(files[0], ".aab") {
+			fatalUsage("-uncompress-native-libs and -split-dimension are only supported for a single .aab file")
+		}
+		if uncompressNativeLibs.set {
+			config.uncompressNativeLibs = &uncompressNativeLibs.value
+		}
+		for _, s := range splitDimensionFlags {
+			dim, err := parseSplitDimension(s)
+			if err != nil {
+				fatalUsage("Invalid -split-dimension:", err)
+			}
+			config.splitDimensions = append(config.splitDimensions, dim)
+		}
+	}
+	if *renameModule != "" {
+		if *recursive || !single || !strings.HasSuffix(files[0], ".aab") {
+			fatalUsage("-rename-module is only supported for a single .aab file")
+		}
+		r, err := parseModuleRename(*renameModule)
+		if err != nil {
+			fatalUsage(err)
+		}
+		warnf("-rename-module is experimental. bundletool expects the base module to be called base and module names to match their manifests.")
+		config.renameModule = r
+	}
+	if *signingKey != "" || *signingCert != "" {
+		switch {
+		case *keystore != "":
+			fatalUsage("-key and -cert can't be combined with -ks")
+		case *signingKey == "" || *signingCert == "":
+			fatalUsage("-key and -cert must be given together")
+		case *noReconvert:
+			fatalUsage("-key can't be combined with -no-reconvert, proto APKs can't be signed")
+		case *ksPass != "" || *keyAlias != "":
+			fatalUsage("-ks-pass and -ks-key-alias require -ks")
+		}
+		signing := &signingConfig{key: *signingKey, cert: *signingCert, verify: *verifySignature}
+		if *keyPass != "" {
+			var err error
+			if signing.keyPass, err = readSecret(*keyPass); err != nil {
+				fatalUsage("Invalid -key-pass:", err)
+			}
+		}
+		config.signing = signing
+	} else if *keystore != "" {
+		if *noReconvert {
+			fatalUsage("-ks can't be combined with -no-reconvert, proto APKs can't be signed")
+		}
+		if *ksPass == "" {
+			fatalUsage("-ks requires -ks-pass")
+		}
+		signing := &signingConfig{keystore: *keystore, keyAlias: *keyAlias, verify: *verifySignature}
+		var err error
+		if signing.ksPass, err = readSecret(*ksPass); err != nil {
+			fatalUsage("Invalid -ks-pass:", err)
+		}
+		if *keyPass != "" {
+			if signing.keyPass, err = readSecret(*keyPass); err != nil {
+				fatalUsage("Invalid -key-pass:", err)
+			}
+		}
+		config.signing = signing
+	} else if *ksPass != "" || *keyPass != "" || *keyAlias != "" || *verifySignature {
+		fatalUsage("-ks-pass, -key-pass, -ks-key-alias and -verify-signature require -ks or -key")
+	}
+	if *applyPatch != "" {
+		changes, err := readPatch(*applyPatch)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.patch = changes
+	}
+	if *merge != "" {
+		overlay, err := readOverlay(*merge)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.merge = overlay
+	}
+	for _, s := range addFeatureFlags {
+		f, err := parseFeature(s, false)
+		if err != nil {
+			fatalUsage("Invalid -add-feature:", err)
+		}
+		config.addFeatures = append(config.addFeatures, f)
+	}
+	for _, name := range removeFeatures {
+		if err := checkDottedName(name, 2); err != nil {
+			fatalUsage("Invalid -remove-feature:", err)
+		}
+	}
+	config.removeFeatures = removeFeatures
+	for _, s := range featureRequiredFlags {
+		f, err := parseFeature(s, true)
+		if err != nil {
+			fatalUsage("Invalid -set-feature-required:", err)
+		}
+		config.featureRequired = append(config.featureRequired, f)
+	}
+	if *glEsVersion != "" {
+		v, err := parseGlEsVersion(*glEsVersion)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.glEsVersion = v
+	}
+	if *revisionCode != "" {
+		if v, err := strconv.ParseInt(*revisionCode, 10, 32); err != nil || v < 0 {
+			fatalUsagef("Invalid -revisionCode %q: expected a non-negative 32-bit integer", *revisionCode)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("revisionCode", *revisionCode))
+	}
+	for _, sdk := range []struct{ name, value string }{{"minSdkVersion", *minSdkVersion}, {"targetSdkVersion", *targetSdkVersion}, {"compileSdkVersion", *compileSdkVersion}} {
+		if sdk.value == "" {
+			continue
+		}
+		if v, err := strconv.ParseInt(sdk.value, 10, 32); err != nil || v <= 0 {
+			fatalUsagef("Invalid -%s %q: expected a positive 32-bit integer", sdk.name, sdk.value)
+		}
+		config.attrSets = append(config.attrSets, androidAttr(sdk.name, sdk.value))
+	}
+	if *minSdkVersion != "" && *targetSdkVersion != "" {
+		minSdk, _ := strconv.Atoi(*minSdkVersion)
+		targetSdk, _ := strconv.Atoi(*targetSdkVersion)
+		if targetSdk < minSdk {
+			fatalUsagef("-targetSdkVersion %d is lower than -minSdkVersion %d", targetSdk, minSdk)
+		}
+	}
+	if *compileSdkVersionCodename != "" {
+		config.attrSets = append(config.attrSets, androidAttr("compileSdkVersionCodename", *compileSdkVersionCodename))
+	}
+	if *targetSandboxVersion != "" {
+		if *targetSandboxVersion != "1" && *targetSandboxVersion != "2" {
+			fatalUsagef("Invalid -targetSandboxVersion %q: expected 1 or 2", *targetSandboxVersion)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("targetSandboxVersion", *targetSandboxVersion))
+	}
+	if *installLocation != "" {
+		if err := checkEnum("installLocation", *installLocation); err != nil {
+			fatalUsagef("Invalid -installLocation: %v", err)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("installLocation", *installLocation))
+	}
+	if *sharedUserId != "" {
+		if err := checkPackageName(*sharedUserId); err != nil {
+			fatalUsagef("Invalid -sharedUserId: %v", err)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("sharedUserId", *sharedUserId))
+	}
+	// platformBuildVersionCode and platformBuildVersionName aren't in the android namespace.
+	if *platformBuildVersionCode != "" {
+		if v, err := strconv.ParseInt(*platformBuildVersionCode, 10, 32); err != nil || v <= 0 {
+			fatalUsagef("Invalid -platformBuildVersionCode %q: expected a positive 32-bit integer", *platformBuildVersionCode)
+		}
+		config.attrSets = append(config.attrSets, attrSet{name: "platformBuildVersionCode", value: *platformBuildVersionCode, typ: intAttr})
+	}
+	if *platformBuildVersionName != "" {
+		config.attrSets = append(config.attrSets, attrSet{name: "platformBuildVersionName", value: *platformBuildVersionName, typ: stringAttr})
+	}
+	if *sharedUserMaxSdkVersion != "" {
+		if v, err := strconv.ParseInt(*sharedUserMaxSdkVersion, 10, 32); err != nil || v <= 0 {
+			fatalUsagef("Invalid -sharedUserMaxSdkVersion %q: expected a positive 32-bit integer", *sharedUserMaxSdkVersion)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("sharedUserMaxSdkVersion", *sharedUserMaxSdkVersion))
+	}
+	if *requiredSplitTypes != "" {
+		config.attrSets = append(config.attrSets, androidAttr("requiredSplitTypes", *requiredSplitTypes))
+	}
+	if *splitTypes != "" {
+		config.attrSets = append(config.attrSets, androidAttr("splitTypes", *splitTypes))
+	}
+	if usesCleartextTraffic.set {
+		if usesCleartextTraffic.value && *networkSecurityConfig != "" {
+			notef("On Android 7+ the -network-security-config takes precedence over -uses-cleartext-traffic")
+		}
+		config.attrSets = append(config.attrSets, androidAttr("usesCleartextTraffic", usesCleartextTraffic.String()))
+	}
+	if *networkSecurityConfig != "" {
+		config.attrSets = append(config.attrSets, androidAttr("networkSecurityConfig", *networkSecurityConfig))
+	}
+	if *dataExtractionRules != "" {
+		config.attrSets = append(config.attrSets, androidAttr("dataExtractionRules", *dataExtractionRules))
+	}
+	if *fullBackupContent != "" {
+		config.attrSets = append(config.attrSets, androidAttr("fullBackupContent", *fullBackupContent))
+	}
+	if applicationEnabled.set {
+		notef("android:enabled on the application element applies to all components that don't set it themselves")
+		config.attrSets = append(config.attrSets, androidAttr("enabled", applicationEnabled.String()))
+	}
+	if persistent.set {
+		if persistent.value {
+			warnf("android:persistent is only honored for apps signed with the platform key or installed as system apps")
+		}
+		config.attrSets = append(config.attrSets, androidAttr("persistent", persistent.String()))
+	}
+	if restoreAnyVersion.set {
+		config.attrSets = append(config.attrSets, androidAttr("restoreAnyVersion", restoreAnyVersion.String()))
+	}
+	if debuggable.set && debuggable.value {
+		warnf("Google Play rejects uploads with android:debuggable=true")
+	}
+	if testOnly.set && testOnly.value {
+		warnf("Google Play rejects uploads with android:testOnly=true, and adb only installs them with -t")
+	}
+	if extractNativeLibs.set && !extractNativeLibs.value {
+		notef("With android:extractNativeLibs=false the lib/*.so entries of an APK have to be stored uncompressed, or the installation fails")
+	}
+	for _, b := range []struct {
+		name  string
+		value boolFlag
+	}{{"extractNativeLibs", extractNativeLibs}, {"largeHeap", largeHeap}, {"hardwareAccelerated", hardwareAccelerated}, {"requestLegacyExternalStorage", requestLegacyExternalStorage}, {"debuggable", debuggable}, {"testOnly", testOnly}, {"allowBackup", allowBackup}} {
+		if b.value.set {
+			config.attrSets = append(config.attrSets, androidAttr(b.name, b.value.String()))
+		}
+	}
+	if *label != "" {
+		config.attrSets = append(config.attrSets, androidAttr("label", *label))
+	}
+	if *icon != "" {
+		config.attrSets = append(config.attrSets, androidAttr("icon", *icon))
+		if *roundIcon == "" {
+			*roundIcon = *icon
+		}
+	}
+	if *roundIcon != "" {
+		config.attrSets = append(config.attrSets, androidAttr("roundIcon", *roundIcon))
+	}
+	if *backupAgent != "" {
+		config.attrSets = append(config.attrSets, androidAttr("backupAgent", *backupAgent))
+	}
+	if isFlagSet("appComponentFactory") {
+		if err := checkClassName(*appComponentFactory); err != nil {
+			fatalUsage("Invalid -appComponentFactory:", err)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("appComponentFactory", *appComponentFactory))
+	}
+	for _, s := range permissionFlags {
+		set, err := parsePermissionFlags(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range permissionMaxSdk {
+		set, err := parsePermissionMaxSdk(s)
+		if err != nil {
+			fatalUsage("Invalid -permission-max-sdk:", err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range grantUri {
+		set, err := parseGrantUri(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range exported {
+		set, err := parseExported(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range taskAffinity {
+		set, err := parseTaskAffinity(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range directBoot {
+		set, err := parseDirectBoot(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	if enableOnBackInvokedCallback.set {
+		set := androidAttr("enableOnBackInvokedCallback", enableOnBackInvokedCallback.String())
+		if *backCallbackComponent != "" {
+			sel, err := parseComponentSelector(*backCallbackComponent)
+			if err != nil {
+				fatalUsage(err)
+			}
+			set.component = &sel
+		}
+		config.attrSets = append(config.attrSets, set)
+	} else if *backCallbackComponent != "" {
+		fatalUsage("-back-callback-component requires -enableOnBackInvokedCallback")
+	}
+	if *maxAspectRatio != "" {
+		v, err := strconv.ParseFloat(*maxAspectRatio, 32)
+		if err != nil || math.IsInf(v, 0) || !(v >= 1) {
+			fatalUsagef("Invalid -maxAspectRatio %q: expected a number of at least 1.0", *maxAspectRatio)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("maxAspectRatio", *maxAspectRatio))
+	}
+	if *gwpAsanMode != "" {
+		if err := checkEnum("gwpAsanMode", *gwpAsanMode); err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("gwpAsanMode", *gwpAsanMode))
+	}
+	if *memtagMode != "" {
+		if err := checkEnum("memtagMode", *memtagMode); err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, androidAttr("memtagMode", *memtagMode))
+	}
+	for _, s := range appBools {
+		set, err := parseAppBool(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		config.attrSets = append(config.attrSets, set)
+	}
+	for _, s := range metaDataFlags {
+		m, err := parseMetaData(s)
+		if err != nil {
+			fatalUsage("Invalid -meta-data:", err)
+		}
+		config.metaData = append(config.metaData, m)
+	}
+	for _, s := range stripPermissionFlags {
+		p, err := parseStripPattern(s)
+		if err != nil {
+			fatalUsage("Invalid -strip-permission:", err)
+		}
+		config.stripPermissions = append(config.stripPermissions, p)
+	}
+	for _, s := range stripComponentFlags {
+		p, err := parseStripPattern(s)
+		if err != nil {
+			fatalUsage("Invalid -strip-component:", err)
+		}
+		config.stripComponents = append(config.stripComponents, p)
+	}
+	for _, s := range appLinkFlags {
+		l, err := parseAppLink(s)
+		if err != nil {
+			fatalUsage("Invalid -add-app-link:", err)
+		}
+		config.appLinks = append(config.appLinks, l)
+	}
+	for _, name := range queryPackages {
+		if err := checkPackageName(name); err != nil {
+			fatalUsage("Invalid -add-query-package:", err)
+		}
+	}
+	config.queryPackages = queryPackages
+	for _, s := range queryIntentFlags {
+		q, err := parseQueryIntent(s)
+		if err != nil {
+			fatalUsage("Invalid -add-query-intent:", err)
+		}
+		config.queryIntents = append(config.queryIntents, q)
+	}
+	for _, s := range scripts {
+		script, err := parseScript(s)
+		if err != nil {
+			fatalUsage("Invalid -script:", err)
+		}
+		config.transformers = append(config.transformers, script)
+	}
+	for _, s := range placeholderFlags {
+		key, value, err := parsePlaceholder(s)
+		if err != nil {
+			fatalUsage("Invalid -placeholder:", err)
+		}
+		if config.placeholders == nil {
+			config.placeholders = map[string]string{}
+		}
+		config.placeholders[key] = value
+	}
+	for _, s := range stringFlags {
+		set, err := parseStringSet(s)
+		if err != nil {
+			fatalUsage("Invalid -set-string:", err)
+		}
+		config.stringSets = append(config.stringSets, set)
+	}
+	for _, s := range labelLocaleFlags {
+		label, err := parseLabelLocale(s)
+		if err != nil {
+			fatalUsage("Invalid -label-locale:", err)
+		}
+		config.labelLocales = append(config.labelLocales, label)
+	}
+	var sets []attrSet
+	for _, s := range setFlags {
+		set, err := parseSet(s)
+		if err != nil {
+			fatalUsage("Invalid -set:", err)
+		}
+		sets = append(sets, set)
+	}
+	for _, s := range removeAttrs {
+		set, err := parseRemoveAttr(s)
+		if err != nil {
+			fatalUsage("Invalid -removeAttr:", err)
+		}
+		sets = append(sets, set)
+	}
+	for _, s := range removeElementFlags {
+		path, err := parseRemoveElement(s)
+		if err != nil {
+			fatalUsage("Invalid -remove-element:", err)
+		}
+		config.removeElements = append(config.removeElements, path)
+	}
+	if *attrsFile != "" {
+		fileSets, err := readAttrsFile(*attrsFile, *keepWhitespace)
+		if err != nil {
+			fatalUsage(err)
+		}
+		sets = append(sets, fileSets...)
+	}
+	if *component != "" {
+		sel, err := parseComponentSelector(*component)
+		if err != nil {
+			fatalUsage(err)
+		}
+		for i := range sets {
+			if sets[i].path != "" {
+				fatalUsagef("-component can't be combined with the element path of %s", sets[i])
+			}
+			sets[i].component = &sel
+		}
+	}
+	config.attrSets = append(config.attrSets, sets...)
+
+	if *only != "" {
+		categories, err := parseOnly(*only)
+		if err != nil {
+			fatalUsage("Invalid -only:", err)
+		}
+		config.restrict(categories)
+	}
+
+	filePath := files[0]
+
+	if !single && (*printValues || *get != "" || *printSdk || *dump || *listNamespaces || *dumpAxmlPath != "" || *extract != "") {
+		fatalUsage("-print, -get, -print-sdk, -dump, -list-namespaces, -dump-axml and -extract only apply to a single file")
+	}
+	if *output != "" && (readOnly || *recursive || !single) {
+		fatalUsage("-output only applies when editing a single file")
+	}
+	if *backup && (readOnly || *output != "") {
+		fatalUsage("-backup only applies when editing files in place")
+	}
+
+	if *expectSHA256 != "" {
+		if readOnly || *recursive || !single || filePath == "-" {
+			fatalUsage("-expect-sha256 only applies when editing a single file")
+		}
+		if len(*expectSHA256) != sha256.Size*2 || strings.Trim(strings.ToLower(*expectSHA256), "0123456789abcdef") != "" {
+			fatalUsage("-expect-sha256 must be a SHA-256 hex digest of 64 characters")
+		}
+		config.expectSHA256 = *expectSHA256
+	}
+
+	var rep *report
+	if *reportPath != "" && readOnly && !*dryRun {
+		fatalUsage("-report only applies when editing files or with -dryRun")
+	}
+	if *reportPath != "" || jsonReport {
+		var err error
+		if rep, err = newReport(); err != nil {
+			fatalUsage(err)
+		}
+	}
+
+	var assertions []assertion
+	for _, s := range asserts {
+		a, err := parseAssertion(s)
+		if err != nil {
+			fatalUsage(err)
+		}
+		assertions = append(assertions, a)
+	}
+	if *validateOnly && len(assertions) == 0 {
+		fatalUsage("-validate-only requires at least one -assert")
+	} else if !*validateOnly && !verifyCommand && len(assertions) > 0 {
+		fatalUsage("-assert requires -validate-only")
+	}
+
+	if signCommand && config.signing == nil {
+		fatalUsage("The sign command requires -ks or -key")
+	}
+
+	var err error
+	if verifyCommand {
+		err = verifyFiles(files, assertions, *verifyBadging, checkSignature)
+	} else if signCommand {
+		err = signFiles(files, config.signing)
+	} else if *validateOnly {
+		paths := files
+		if *recursive {
+			paths, err = findArtifacts(filePath, *skipInvalid)
+		}
+		if err == nil {
+			err = validate(paths, assertions)
+		}
+	} else if *printValues {
+		var xmlNode *XmlNode
+		if xmlNode, err = readManifest(filePath); err == nil {
+			err = printManifestValues(xmlNode, *jsonOutput)
+		}
+	} else if *get != "" {
+		var xmlNode *XmlNode
+		if xmlNode, err = readManifest(filePath); err == nil {
+			err = printValue(xmlNode, *get)
+		}
+	} else if *printSdk {
+		var xmlNode *XmlNode
+		if xmlNode, err = readManifest(filePath); err == nil {
+			err = printSdkVersions(xmlNode, *jsonOutput)
+		}
+	} else if *dump {
+		var xmlNode *XmlNode
+		if xmlNode, err = readManifest(filePath); err == nil {
+			err = dumpManifest(xmlNode, *jsonOutput)
+		}
+	} else if *listNamespaces {
+		var xmlNode *XmlNode
+		if xmlNode, err = readManifest(filePath); err == nil {
+			err = printNamespaces(xmlNode, *jsonOutput)
+		}
+	} else if *dumpAxmlPath != "" {
+		err = dumpAxml(filePath, *dumpAxmlPath, config)
+	} else if *countOnly || *dryRun {
+		paths := files
+		if *recursive {
+			paths, err = findArtifacts(filePath, *skipInvalid)
+		}
+		if err == nil {
+			err = countChanges(paths, config, *dryRun, rep)
+		}
+		if err == nil && *dryRun {
+			fmt.Println("Dry run, nothing was written")
+		}
+	} else if *recursive {
+		var paths []string
+		if paths, err = findArtifacts(filePath, *skipInvalid); err == nil {
+			err = updateFiles(paths, *jobs, config, rep)
+		}
+	} else if *extract != "" {
+		if !strings.HasSuffix(filePath, ".aab") {
+			fatalUsage("-extract is only supported for .aab files")
+		}
+		err = extractManifest(filePath, *extract, config)
+	} else if !single {
+		err = updateFiles(files, *jobs, config, rep)
+	} else if filePath == "-" {
+		err = updateStdio(stdout, config)
+	} else {
+		var changes []change
+		var written bool
+		target := filePath
+		if *output != "" {
+			target = *output
+		}
+		err = rep.hashInput(target, filePath)
+		if err == nil && *output != "" {
+			changes, written, err = updateCopy(filePath, *output, config)
+		} else if err == nil {
+			changes, written, err = updateFile(filePath, config)
+		}
+		if err == nil {
+			err = rep.add(target, changes, written)
+		}
+	}
+	if err == nil && *reportPath != "" {
+		if err = rep.write(*reportPath); err == nil {
+			fmt.Println("Wrote report to", *reportPath)
+		}
+	}
+	if err == nil && jsonReport {
+		var out []byte
+		if out, err = rep.encode(); err == nil {
+			_, err = stdout.Write(out)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		exit(exitCode(err))
+	}
+}
+
+// checkTmpDir fails if tmpDir isn't an existing directory, before any temp file is created.
+func checkTmpDir() error {
+	info, err := os.Stat(tmpDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", tmpDir)
+	}
+	return nil
+}
+
+// resolveAapt2Path applies the defaults of -aapt2: the -build-tools version, $AAPT2_PATH, $AAPT2,
+// aapt2 in PATH or the newest build-tools of $ANDROID_HOME.
+func resolveAapt2Path() {
+	if aapt2Path == "" && buildToolsVersion != "" {
+		aapt2Path = findSdkTool("aapt2")
+	}
+	if aapt2Path == "" {
+		aapt2Path = os.Getenv("AAPT2_PATH")
+	}
+	if aapt2Path == "" {
+		aapt2Path = os.Getenv("AAPT2")
+	}
+	if aapt2Path == "" {
+		aapt2Path = findSdkTool("aapt2")
+	}
+}
+
+// readInputList returns the paths listed in the -input-list file, one per line. Blank lines and
+// lines starting with # are skipped.
+func readInputList(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file: %w", err)
+	}
+	var paths []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+// updateFiles applies the config to each of the files and prints a summary. A file that fails is
+// reported and the remaining files are still processed, but the run fails in the end. With jobs > 1
+// that many files are processed at the same time, see runJobs.
+func updateFiles(paths []string, jobs int, config *editConfig, rep *report) error {
+	var results []jobResult
+	if jobs > 1 {
+		results = runJobs(paths, jobs)
+		for _, result := range results {
+			if rep != nil && result.file != nil {
+				rep.Files = append(rep.Files, *result.file)
+			}
+		}
+	} else {
+		for _, path := range paths {
+			fmt.Println("Processing", path)
+			err := rep.hashInput(path, path)
+			var changes []change
+			var written bool
+			if err == nil {
+				changes, written, err = updateFile(path, config)
+			}
+			if err == nil {
+				err = rep.add(path, changes, written)
+			}
+			if err != nil {
+				errorf("%s: %v", path, err)
+			}
+			results = append(results, jobResult{written: written, err: err})
+		}
+	}
+
+	var updated, unchanged, failed []string
+	for i, result := range results {
+		switch {
+		case result.err != nil:
+			failed = append(failed, paths[i])
+		case result.written:
+			updated = append(updated, paths[i])
+		default:
+			unchanged = append(unchanged, paths[i])
+		}
+	}
+	fmt.Printf("Processed %d files\n", len(paths))
+	for _, path := range updated {
+		fmt.Println("  updated:", path)
+	}
+	for _, path := range unchanged {
+		fmt.Println("  unchanged:", path)
+	}
+	for _, path := range failed {
+		fmt.Println("  failed:", path)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed", len(failed), len(paths))
+	}
+	return checkSplitSets(paths)
+}
+
+// findArtifacts returns every APK, APK set and AAB below dir. With skipInvalid, the files that
+// only have the extension of one but aren't zip archives are left out with a warning.
+func findArtifacts(dir string, skipInvalid bool) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isArtifact(path) {
+			return nil
+		}
+		if skipInvalid {
+			if err := checkZip(path); err != nil {
+				warnf("Skipping %v", err)
+				return nil
+			}
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed walking directory: %w", err)
+	}
+	return paths, nil
+}
+
+// countChanges checks which of the files the config would change without writing them. With
+// diff, the changes of each file are listed too, for -dryRun. The results are also added to rep,
+// which may be nil.
+func countChanges(paths []string, config *editConfig, diff bool, rep *report) error {
+	// Work on a copy, so nothing but the temp manifest is written.
+	dryRun := *config
+	dryRun.skipUnchanged = true
+	dryRun.emitPatch = ""
+	var changing, current []string
+	changes := map[string][]change{}
+	for _, path := range paths {
+		fmt.Println("Checking", path)
+		fileChanges, changed, err := wouldChange(path, &dryRun)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := rep.addDryRun(path, fileChanges, changed); err != nil {
+			return err
+		}
+		if changed {
+			changing = append(changing, path)
+			changes[path] = fileChanges
+		} else {
+			current = append(current, path)
+		}
+	}
+
+	fmt.Printf("%d of %d artifacts would change, %d are already current\n", len(changing), len(paths), len(current))
+	for _, path := range changing {
+		fmt.Println("  would change:", path)
+		if !diff {
+			continue
+		}
+		for _, c := range changes[path] {
+			if c.Kind == removeKind {
+				fmt.Printf("    %s: removed\n", c.Element)
+				continue
+			}
+			old := "(unset)"
+			if c.Old != nil {
+				old = *c.Old
+			}
+			fmt.Printf("    %s/@%s: %s -> %s\n", c.Element, qualifiedName(nil, c.Namespace, c.Name), old, c.Value)
+		}
+	}
+	for _, path := range current {
+		fmt.Println("  current:", path)
+	}
+	return nil
+}
+
+func wouldChange(path string, config *editConfig) ([]change, bool, error) {
+	data, err := readManifestData(path)
+	if err != nil {
+		return nil, false, err
+	}
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(manifest)
+	if _, err := manifest.Write(data); err != nil {
+		return nil, false, fmt.Errorf("failed writing temp file: %w", err)
+	}
+	if err := manifest.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed writing temp file: %w", err)
+	}
+	return updateManifest(manifest.Name(), config)
+}
+
+func isArtifact(path string) bool {
+	return strings.HasSuffix(path, ".apk") || strings.HasSuffix(path, ".aab") || strings.HasSuffix(path, ".apks") || strings.HasSuffix(path, ".aar")
+}
+
+// updateFile dispatches on the file extension and returns the applied changes and whether the
+// file was written.
+func updateFile(path string, config *editConfig) ([]change, bool, error) {
+	if config.expectSHA256 != "" {
+		if err := checkSHA256(path, config.expectSHA256); err != nil {
+			return nil, false, err
+		}
+	}
+	if isArtifact(path) {
+		if err := checkZip(path); err != nil {
+			return nil, false, err
+		}
+	}
+	if config.backup {
+		if err := backupFile(path); err != nil {
+			return nil, false, err
+		}
+	}
+	if isArtifact(path) {
+		var before map[string]entrySum
+		if config.emitDelta != "" {
+			var err error
+			if before, err = readEntrySums(path); err != nil {
+				return nil, false, err
+			}
+		}
+		update := updateAab
+		if strings.HasSuffix(path, ".apk") {
+			update = updateApk
+		} else if strings.HasSuffix(path, ".apks") {
+			update = updateApkSet
+		} else if strings.HasSuffix(path, ".aar") {
+			update = updateAar
+		}
+		changes, written, err := update(path, config)
+		if err == nil && config.emitDelta != "" {
+			err = writeDelta(path, config.emitDelta, before)
+		}
+		return changes, written, err
+	}
+	if config.embedProvenance {
+		warnf("-embed-provenance only applies to APKs and AABs")
+	}
+	if isBinaryXMLFile(path) {
+		return updateBinaryManifest(path, config)
+	}
+	if isTextXMLFile(path) {
+		return updateTextManifest(path, config)
+	}
+	changes, changed, err := updateManifest(path, config)
+	if err != nil {
+		return nil, false, err
+	}
+	if !changed && config.skipUnchanged {
+		fmt.Println("Manifest unchanged, no write needed")
+		return changes, false, nil
+	}
+	return changes, true, nil
+}
+
+func updateApk(path string, config *editConfig) ([]change, bool, error) {
+	if proto, err := isProtoApk(path); err != nil {
+		return nil, false, err
+	} else if proto {
+		notef("%s already has a proto manifest, so it's edited without aapt2 and stays in the proto format", path)
+		if config.signing != nil {
+			warnf("Not signing %s, proto APKs can't be signed", path)
+		}
+		return updateProtoApk(path, config)
+	}
+	signingBlock, err := readSigningBlock(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	file, err := createTemp(tmpDir, "*.aar")
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(file)
+
+	if err := convertApk(path, file.Name(), "proto"); err != nil {
+		return nil, false, err
+	}
+
+	changes, written, err := updateManifestPbInZip(file.Name(), "AndroidManifest.xml", config)
+	if err != nil || !written {
+		return changes, false, err
+	}
+
+	if config.noReconvert {
+		if err := copyFile(file.Name(), path); err != nil {
+			return nil, false, err
+		}
+		warnf("The APK was left in proto format. It can't be installed before converting it with aapt2.")
+		return changes, true, nil
+	}
+
+	// The binary APK is finished in a temp file, so a failing step leaves the original APK intact.
+	apk, err := createTempSibling(path)
+	if err != nil {
+		return nil, false, err
+	}
+	apk.Close()
+	defer removeTemp(apk)
+	if err := convertApk(file.Name(), apk.Name(), "binary"); err != nil {
+		return nil, false, err
+	}
+
+	if config.verifyBadging {
+		if err := verifyBadging(apk.Name()); err != nil {
+			return nil, false, err
+		}
+	}
+	if config.signing != nil {
+		err = signApk(apk.Name(), config.signing)
+	} else if signingBlock != nil && config.preserveSigningBlock {
+		err = insertSigningBlock(apk.Name(), signingBlock)
+	} else if signingBlock != nil {
+		warnSigningBlockRemoved()
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := renameSynced(apk.Name(), path); err != nil {
+		return nil, false, fmt.Errorf("failed replacing APK: %w", err)
+	}
+	return changes, true, nil
+}
+
+// updateProtoApk edits an APK that already has a proto manifest. Its APK Signing Block is handled
+// like that of a binary APK: it's dropped with a warning or kept with -preserve-signing-block.
+func updateProtoApk(path string, config *editConfig) ([]change, bool, error) {
+	signingBlock, err := readSigningBlock(path)
+	if err != nil {
+		return nil, false, err
+	}
+	if signingBlock == nil || !config.preserveSigningBlock {
+		changes, written, err := updateManifestPbInZip(path, "AndroidManifest.xml", config)
+		if err == nil && written && signingBlock != nil {
+			warnSigningBlockRemoved()
+		}
+		return changes, written, err
+	}
+	// The block is inserted into a copy, so a failing step leaves the original APK intact.
+	apk, err := copyToTemp(path, filepath.Dir(path), filepath.Base(path)+".*.apk")
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(apk)
+	changes, written, err := updateManifestPbInZip(apk.Name(), "AndroidManifest.xml", config)
+	if err != nil || !written {
+		return changes, false, err
+	}
+	if err := insertSigningBlock(apk.Name(), signingBlock); err != nil {
+		return nil, false, err
+	}
+	if err := renameSynced(apk.Name(), path); err != nil {
+		return nil, false, fmt.Errorf("failed replacing APK: %w", err)
+	}
+	return changes, true, nil
+}
+
+func warnSigningBlockRemoved() {
+	warnf("Removed the APK Signing Block (v2+ signatures). The APK must be re-signed.")
+}
+
+// convertApk converts the APK at in to the given format with aapt2 or, with -native-axml, the
+// built-in binary XML codec.
+func convertApk(in string, out string, format string) error {
+	if nativeAxml {
+		return nativeConvert(in, out, format)
+	}
+	return aapt2Convert(in, out, format)
+}
+
+// isProtoApk reports whether the APK's manifest is already in aapt2's proto format, e.g. an APK
+// from an earlier -no-reconvert run or from bundletool's intermediate output, so it doesn't need
+// to be converted.
+func isProtoApk(path string) (bool, error) {
+	manifest, err := readFromZip(path, "AndroidManifest.xml")
+	if err != nil {
+		return false, err
+	}
+	return !bytes.HasPrefix(manifest, binaryXMLHeader), nil
+}
+
+// needsAapt2 reports whether the file can only be processed with aapt2.
+func needsAapt2(path string) bool {
+	if nativeAxml {
+		return false
+	}
+	if strings.HasSuffix(path, ".apks") {
+		return true
+	}
+	if !strings.HasSuffix(path, ".apk") {
+		return false
+	}
+	proto, err := isProtoApk(path)
+	// Unreadable APKs fail later with a better error.
+	return err == nil && !proto
+}
+
+// checkAapt2 fails if aapt2 can't be found, before any file is processed.
+func checkAapt2() error {
+	if _, err := exec.LookPath(aapt2Path); err != nil {
+		return withExitCode(exitAapt2Missing, fmt.Errorf("aapt2 is required to convert APKs, but %s can't be found (set -aapt2, AAPT2_PATH or AAPT2, or try -native-axml): %w", aapt2Path, err))
+	}
+	return nil
+}
+
+// aapt2Convert converts the APK at in to the given format ("proto" or "binary") and writes it to out.
+func aapt2Convert(in string, out string, format string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, aapt2Path, "convert", "-o", out, "--output-format", format, in)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return withExitCode(exitAapt2Missing, fmt.Errorf("aapt2 is required to convert APKs, but %s can't be executed (set -aapt2 or AAPT2_PATH, or try -native-axml): %w", aapt2Path, err))
+		}
+		return withExitCode(exitAapt2Failed, fmt.Errorf("failed executing aapt2: %w %s %s", err, stdout.String(), stderr.String()))
+	}
+	// aapt2 also prints warnings when it succeeds. They're usually harmless, so only show them on request.
+	if verbose && stderr.Len() > 0 {
+		fmt.Fprintf(os.Stderr, "aapt2 convert --output-format %s %s:\n%s", format, in, stderr.String())
+	}
+	return nil
+}
+
+func updateAab(path string, config *editConfig) ([]change, bool, error) {
+	if config.signing != nil {
+		warnf("-ks and -key only re-sign APKs. Sign %s with jarsigner (or let Play App Signing handle it).", path)
+	}
+	if config.verifyBadging {
+		warnf("aapt2 dump badging only reads APKs, so %s only gets the checks of -verify", path)
+	}
+	return updateManifestPbInZip(path, aabManifestPath, config)
+}
+
+// extractManifest writes the AAB's base manifest with all edits applied to target, leaving the AAB untouched.
+func extractManifest(path string, target string, config *editConfig) error {
+	manifest, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed creating file: %w", err)
+	}
+	if err := extractFromZip(path, aabManifestPath, manifest); err != nil {
+		manifest.Close()
+		return err
+	}
+	if err := manifest.Close(); err != nil {
+		return fmt.Errorf("failed writing file: %w", err)
+	}
+	_, _, err = updateManifest(target, config)
+	return err
+}
+
+// updateManifestPbInZip returns the applied changes and false if the zip was left untouched because
+// nothing changed.
+func updateManifestPbInZip(path string, manifestPath string, config *editConfig) ([]change, bool, error) {
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(manifest)
+
+	if manifestPath, err = manifestEntryName(path, manifestPath); err != nil {
+		return nil, false, err
+	}
+	others, err := otherManifests(path, manifestPath)
+	if err != nil {
+		return nil, false, err
+	}
+	var editedOthers []string
+	listed := map[string]bool{}
+	for _, name := range others {
+		module, _, _ := strings.Cut(name, "/")
+		isModule := isModuleManifest(path, name)
+		if isModule {
+			listed[module] = true
+		}
+		switch {
+		case config.allManifests || isModule && !config.baseOnly && (config.modules == nil || slices.Contains(config.modules, module)):
+			editedOthers = append(editedOthers, name)
+		case config.baseOnly && isModule:
+			notef("Ignoring %s because of -base-only", name)
+		case isModule:
+			notef("Ignoring %s, the module %s isn't listed in -modules", name, module)
+		default:
+			warnf("Ignoring %s, pass -all-manifests to edit it too", name)
+		}
+	}
+	for _, module := range config.modules {
+		if !listed[module] {
+			warnf("The AAB has no module %s, which -modules lists", module)
+		}
+	}
+	if len(editedOthers) > 0 {
+		fmt.Println("Editing", manifestPath)
+	}
+	if err := extractFromZip(path, manifestPath, manifest); err != nil {
+		return nil, false, err
+	}
+	manifestConfig := *config
+	manifestConfig.resources = &resourceTable{zipPath: path, name: resourcesPath(manifestPath)}
+	changes, changed, err := updateManifest(manifest.Name(), &manifestConfig)
+	if err != nil {
+		return nil, false, err
+	}
+	extra := map[string][]byte{}
+	var edited []string
+	if changed {
+		edited = append(edited, manifestPath)
+	}
+	for _, name := range editedOthers {
+		data, err := updateManifestEntry(path, name, &manifestConfig)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", name, err)
+		}
+		if data != nil {
+			extra[name] = data
+			edited = append(edited, name)
+		}
+	}
+	if len(editedOthers) > 0 {
+		fmt.Printf("Changed %d of %d manifests\n", len(edited), len(editedOthers)+1)
+		for _, name := range edited {
+			fmt.Println("  changed:", name)
+		}
+	}
+	if config.bundletoolVersion != "" || config.uncompressNativeLibs != nil || len(config.splitDimensions) > 0 {
+		bundleConfig, err := updateBundleConfig(path, config)
+		if err != nil {
+			return nil, false, err
+		}
+		if bundleConfig != nil {
+			extra[bundleConfigPath] = bundleConfig
+		}
+	}
+	if len(config.stringSets) > 0 || len(config.labelLocales) > 0 {
+		name := resourcesPath(manifestPath)
+		sets := config.stringSets
+		if len(config.labelLocales) > 0 {
+			edited, err := readManifest(manifest.Name())
+			if err != nil {
+				return nil, false, err
+			}
+			labelSets, err := labelStringSets(edited.GetElement(), manifestConfig.resources, config.labelLocales)
+			if err != nil {
+				return nil, false, err
+			}
+			sets = append(append([]stringSet{}, sets...), labelSets...)
+		}
+		table, err := updateStrings(path, name, sets)
+		if err != nil {
+			return nil, false, err
+		}
+		if table != nil {
+			extra[name] = table
+		}
+	}
+	if !changed && len(extra) == 0 && config.skipUnchanged && config.renameModule == nil {
+		fmt.Println("Manifest unchanged, no write needed")
+		return changes, false, nil
+	}
+	if config.embedProvenance {
+		if extra[provenancePath], err = provenanceJSON(changes); err != nil {
+			return nil, false, err
+		}
+		fmt.Println("Adding", provenancePath)
+	}
+	// updateManifest replaces the file, so it's opened again to read the edited manifest.
+	source, err := os.Open(manifest.Name())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading temp file: %w", err)
+	}
+	defer source.Close()
+	// 使用新的原生Go实现替代外部zip命令
+	if err := addToZipNative(path, manifestPath, source, config.renameModule, extra); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// updateBundleConfig returns the AAB's BundleConfig.pb with the new bundletool version and
+// optimizations, or nil if it already has them.
+func updateBundleConfig(path string, config *editConfig) ([]byte, error) {
+	data, err := readFromZip(path, bundleConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	bundleConfig, changed := data, false
+	if version := config.bundletoolVersion; version != "" {
+		var old string
+		if bundleConfig, old, err = setBundletoolVersion(bundleConfig, version); err != nil {
+			return nil, fmt.Errorf("failed updating %s: %w", bundleConfigPath, err)
+		}
+		if old == "" {
+			fmt.Println("Setting bundletool version to", version)
+		} else if old != version {
+			fmt.Println("Changing bundletool version from", old, "to", version)
+		}
+		changed = changed || old != version
+	}
+	if enabled := config.uncompressNativeLibs; enabled != nil {
+		var old *bool
+		if bundleConfig, old, err = setUncompressNativeLibraries(bundleConfig, *enabled); err != nil {
+			return nil, fmt.Errorf("failed updating %s: %w", bundleConfigPath, err)
+		}
+		if old == nil {
+			fmt.Println("Setting uncompressNativeLibraries to", *enabled)
+		} else if *old != *enabled {
+			fmt.Println("Changing uncompressNativeLibraries from", *old, "to", *enabled)
+		}
+		changed = changed || old == nil || *old != *enabled
+	}
+	for _, dim := range config.splitDimensions {
+		var old *bool
+		if bundleConfig, old, err = setSplitDimension(bundleConfig, dim); err != nil {
+			return nil, fmt.Errorf("failed updating %s: %w", bundleConfigPath, err)
+		}
+		if old != nil && *old == dim.enabled {
+			continue
+		}
+		if dim.enabled {
+			fmt.Printf("Enabling the %s splits\n", dim.name)
+		} else {
+			fmt.Printf("Disabling the %s splits\n", dim.name)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil, nil
+	}
+	return bundleConfig, nil
+}
+
+// readManifest parses the manifest of the given APK, AAB or proto manifest file without modifying it.
+func readManifest(path string) (*XmlNode, error) {
+	data, err := readManifestData(path)
+	if err != nil {
+		return nil, err
+	}
+	xmlNode, err := parseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	return xmlNode, nil
+}
+
+// readManifestData returns the proto manifest of the given APK, AAB or proto manifest file.
+func readManifestData(path string) ([]byte, error) {
+	if isArtifact(path) {
+		if err := checkZip(path); err != nil {
+			return nil, err
+		}
+	}
+	if strings.HasSuffix(path, ".apks") {
+		names, err := apkSetEntries(path)
+		if err != nil {
+			return nil, err
+		}
+		apk, err := createTemp(tmpDir, "*.apk")
+		if err != nil {
+			return nil, err
+		}
+		defer removeTemp(apk)
+		if err := extractFromZip(path, apkSetBase(names), apk); err != nil {
+			return nil, err
+		}
+		if err := apk.Close(); err != nil {
+			return nil, fmt.Errorf("failed writing temp file: %w", err)
+		}
+		return readManifestData(apk.Name())
+	}
+	if strings.HasSuffix(path, ".apk") {
+		if proto, err := isProtoApk(path); err != nil {
+			return nil, err
+		} else if proto {
+			return readFromZip(path, "AndroidManifest.xml")
+		}
+		file, err := createTemp(tmpDir, "*.aar")
+		if err != nil {
+			return nil, err
+		}
+		defer removeTemp(file)
+		if err := convertApk(path, file.Name(), "proto"); err != nil {
+			return nil, err
+		}
+		return readFromZip(file.Name(), "AndroidManifest.xml")
+	}
+	if strings.HasSuffix(path, ".aab") {
+		return readFromZip(path, aabManifestPath)
+	}
+	var in []byte
+	var err error
+	if strings.HasSuffix(path, ".aar") {
+		in, err = readFromZip(path, "AndroidManifest.xml")
+	} else if in, err = os.ReadFile(path); err != nil {
+		err = fmt.Errorf("failed reading file: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if text := bytes.TrimPrefix(in, utf8BOM); bytes.HasPrefix(bytes.TrimSpace(text), []byte("<")) {
+		xmlNode, err := decodeTextManifest(text, nil)
+		if err != nil {
+			return nil, withExitCode(exitParse, fmt.Errorf("failed to parse text XML manifest: %w", err))
+		}
+		return xmlNode.MarshalVT()
+	}
+	if bytes.HasPrefix(in, binaryXMLHeader) {
+		xmlNode, err := decodeBinaryXML(in)
+		if err != nil {
+			return nil, withExitCode(exitParse, fmt.Errorf("failed to parse binary XML manifest: %w", err))
+		}
+		return xmlNode.MarshalVT()
+	}
+	return in, nil
+}
+
+func readFromZip(path string, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := extractFromZip(path, name, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readFromZipIfExists is like readFromZip, but returns nil if the zip has no such entry.
+func readFromZipIfExists(path string, name string) ([]byte, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+	if findFile(&r.Reader, name) == nil {
+		return nil, nil
+	}
+	return readFromZip(path, name)
+}
+
+func extractFromZip(path string, name string, target io.Writer) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+	return extractEntry(&r.Reader, path, name, target)
+}
+
+// extractEntry writes the uncompressed entry name of reader to target. It works on any reader,
+// e.g. an archive in memory, and path is only used for the error.
+func extractEntry(reader *zip.Reader, path string, name string, target io.Writer) error {
+	f := findFile(reader, name)
+	if f == nil {
+		return withExitCode(exitIO, fmt.Errorf("%s has no %s entry", path, name))
+	}
+
+	innerFile, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed opening zip file's %s: %w", name, err)
+	}
+	defer innerFile.Close()
+	if _, err := io.Copy(target, innerFile); err != nil {
+		return fmt.Errorf("failed reading zip file's %s: %w", name, err)
+	}
+	return nil
+}
+
+// findFile returns the entry called name. Manifests are also found if the case of their name was
+// changed, e.g. by a round trip through a case-insensitive file system, or if they're at another
+// path but are the only manifest in the zip, like in some repackaged archives. An exact match wins.
+func findFile(r *zip.Reader, name string) *zip.File {
+	var folded, moved *zip.File
+	manifests := 0
+	for _, f := range r.File {
+		if f.Name == name {
+			return f
+		}
+		if !isManifestName(name) || !isManifestName(f.Name) {
+			continue
+		}
+		if folded == nil && strings.EqualFold(f.Name, name) {
+			folded = f
+		}
+		moved = f
+		manifests++
+	}
+	if folded == nil && manifests == 1 {
+		return moved
+	}
+	return folded
+}
+
+// updateManifest returns the applied changes and whether the written manifest differs from the
+// original file content. With skipUnchanged an identical manifest isn't written at all, preserving
+// the file's mtime.
+func updateManifest(path string, config *editConfig) ([]change, bool, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading file: %w", err)
+	}
+	changes, out, err := editManifest(in, config)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := !bytes.Equal(in, out)
+	if !changed && config.skipUnchanged {
+		return changes, false, nil
+	}
+	if err := replaceFile(path, out); err != nil {
+		return nil, false, err
+	}
+	return changes, changed, nil
+}
+
+// editManifest applies the config to the proto manifest in and returns the edited manifest. It
+// only works on bytes, so manifests that aren't files, like the entries of a zip read into memory,
+// can be edited without a temp file.
+func editManifest(in []byte, config *editConfig) ([]change, []byte, error) {
+	xmlNode, err := parseManifest(in)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if split := splitName(xmlNode.GetElement()); split != "" && !config.secondary {
+		// Split APKs lack what only the base APK has, like the versionName.
+		notef("This is the split %s, it gets the edits of its base APK", split)
+		splitConfig := *config
+		splitConfig.secondary = true
+		config = &splitConfig
+	}
+	if config.versionCodeIncrement > 0 && config.versionCode == 0 {
+		code, err := nextVersionCode(xmlNode.GetElement(), config.versionCodeIncrement)
+		if err != nil {
+			return nil, nil, err
+		}
+		incremented := *config
+		incremented.versionCode = code
+		config = &incremented
+	}
+	editor := newManifestEditor(xmlNode.GetElement(), config)
+	versionName := config.versionName
+	if config.versionNamePattern != nil {
+		if versionName, err = deriveVersionName(xmlNode.GetElement(), config); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.versionNameTemplate != nil {
+		if versionName, err = config.versionNameTemplate.format(xmlNode.GetElement(), config); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.versionNameSuffix != "" {
+		if versionName == "" {
+			attr := findAttr(xmlNode.GetElement(), namespace, versionNameAttr)
+			if attr == nil {
+				return nil, nil, withExitCode(exitNotFound, errors.New("-versionNameSuffix needs a versionName, but the manifest has none"))
+			}
+			versionName = attrValue(attr)
+		}
+		versionName += config.versionNameSuffix
+	}
+	if config.placeholders != nil {
+		pkg := config.packageName
+		if pkg == "" {
+			pkg = packageName(editor.root)
+		}
+		if err := editor.substitutePlaceholders(config.placeholders, pkg); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.packageRename != nil {
+		if err := editor.renamePackage(*config.packageRename); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, attr := range xmlNode.GetElement().GetAttribute() {
+		if attr.GetNamespaceUri() == "" && attr.GetName() == "package" {
+			if config.packageName != "" {
+				old := attr.Value
+				attr.Value = config.packageName
+				editor.record("packageName", editor.root, attr, &old)
+			}
+		}
+		if attr.GetNamespaceUri() != namespace {
+			continue
+		}
+		switch attr.GetName() {
+		case versionCodeAttr:
+			if config.versionCode > 0 {
+				old := attrValue(attr)
+				value := fmt.Sprint(config.versionCode)
+				switch x := attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+				case *Primitive_IntDecimalValue:
+					x.IntDecimalValue = config.versionCode
+				case *Primitive_IntHexadecimalValue:
+					x.IntHexadecimalValue = uint32(config.versionCode)
+					value = fmt.Sprintf("0x%x", config.versionCode)
+				default:
+					if attr.GetCompiledItem() != nil {
+						warnf("Can't update the versionCode %s, it isn't compiled as an integer", old)
+						continue
+					}
+				}
+				// In AABs the value exists, but when using aapt2 to convert the binary manifest the value is gone
+				if attr.Value != "" {
+					attr.Value = value
+				}
+				if attrValue(attr) != old {
+					editor.record("versionCode", editor.root, attr, &old)
+				}
+			}
+		case versionNameAttr:
+			if versionName != "" {
+				old := attr.Value
+				attr.Value = versionName
+				editor.record("versionName", editor.root, attr, &old)
+			}
+		}
+	}
+	// Attributes the manifest doesn't declare yet are added, placed and typed like aapt2 would.
+	root := xmlNode.GetElement()
+	added := []struct {
+		uri, name, value, label string
+		typ                     attrType
+	}{
+		{"", "package", config.packageName, "packageName", stringAttr},
+		{namespace, versionCodeAttr, "", "versionCode", intAttr},
+		{namespace, versionNameAttr, versionName, "versionName", stringAttr},
+	}
+	if config.versionCode > 0 {
+		added[1].value = fmt.Sprint(config.versionCode)
+	}
+	for _, a := range added {
+		if config.secondary || a.value == "" || findAttr(root, a.uri, a.name) != nil {
+			continue
+		}
+		if err := editor.setAttr(root, a.uri, a.name, androidAttrs[a.name].id, a.typ, a.value, a.label); err != nil {
+			return nil, nil, err
+		}
+	}
+	if unapplied := unappliedChanges(root, config, versionName); len(unapplied) > 0 {
+		if config.strict {
+			return nil, nil, withExitCode(exitNotFound, fmt.Errorf("strict check failed: the manifest doesn't have the requested %s", strings.Join(unapplied, ", ")))
+		}
+		warnf("The manifest doesn't have the requested %s", strings.Join(unapplied, ", "))
+	}
+
+	for _, permission := range config.removePermissions {
+		editor.removePermission(permission)
+	}
+	if config.stripPermissions != nil {
+		editor.stripPermissions(config.stripPermissions)
+	}
+	if config.stripComponents != nil {
+		editor.stripComponents(config.stripComponents)
+	}
+	for _, path := range config.removeElements {
+		if err := editor.removeElement(path); err != nil {
+			return nil, nil, fmt.Errorf("failed removing element: %w", err)
+		}
+	}
+	for _, permission := range config.addPermissions {
+		editor.addPermission(permission)
+	}
+	for _, name := range config.removeFeatures {
+		editor.removeFeature(name)
+	}
+	for _, f := range config.addFeatures {
+		if err := editor.addFeature(f); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, f := range config.featureRequired {
+		if err := editor.setFeatureRequired(f); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, m := range config.metaData {
+		if err := editor.setMetaData(m); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, l := range config.appLinks {
+		if err := editor.addAppLink(l); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, name := range config.queryPackages {
+		if err := editor.addQueryPackage(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, q := range config.queryIntents {
+		if err := editor.addQueryIntent(q); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if config.glEsVersion != 0 {
+		editor.setGlEsVersion(config.glEsVersion)
+	}
+	for _, set := range config.attrSets {
+		if err := editor.applyAttrSet(set); err != nil {
+			return nil, nil, fmt.Errorf("failed setting attribute: %w", err)
+		}
+	}
+	if config.merge != nil {
+		editor.merge(config.merge)
+	}
+	for _, c := range config.patch {
+		if err := editor.applyChange(c); err != nil {
+			return nil, nil, fmt.Errorf("failed applying patch: %w", err)
+		}
+	}
+	for _, t := range config.transformers {
+		if err := t.Transform(xmlNode); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.strict {
+		if err := editor.checkStrings(); err != nil {
+			return nil, nil, fmt.Errorf("strict check failed: %w", err)
+		}
+		// The other manifests of an AAB often lack what the base manifest has, so only skipped
+		// changes of the canonical one count.
+		if len(editor.skipped) > 0 && !config.secondary {
+			return nil, nil, withExitCode(exitNotFound, fmt.Errorf("strict check failed: %d requested changes weren't applied: %s", len(editor.skipped), strings.Join(editor.skipped, "; ")))
+		}
+	}
+	if config.emitPatch != "" {
+		if err := writePatch(config.emitPatch, editor.changes); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// We use MarshalVT because it keeps the correct field ordering.
+	// With the standard Marshal function, Android Studio can't read the resulting proto file inside aab files. :-/
+	out, err := xmlNode.MarshalVT()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed marshalling XML: %w", err)
+	}
+	if config.verify {
+		if err := verifyManifest(out, config.secondary); err != nil {
+			return nil, nil, err
+		}
+	}
+	return editor.changes, out, nil
+}
+
+// unappliedChanges returns the requested package, versionCode and versionName the manifest doesn't
+// have after the edits, e.g. because the versionCode isn't compiled as an integer. Secondary
+// manifests that lack an attribute are fine, because it isn't added to them.
+func unappliedChanges(root *XmlElement, config *editConfig, versionName string) []string {
+	var unapplied []string
+	check := func(uri string, name string, want string, matches func(string) bool) {
+		attr := findAttr(root, uri, name)
+		switch {
+		case want == "" || attr == nil && config.secondary:
+		case attr == nil:
+			unapplied = append(unapplied, fmt.Sprintf("%s %s (it's missing)", name, want))
+		case !matches(attrValue(attr)):
+			unapplied = append(unapplied, fmt.Sprintf("%s %s (it's %s)", name, want, attrValue(attr)))
+		}
+	}
+	equals := func(want string) func(string) bool {
+		return func(value string) bool { return value == want }
+	}
+	check("", "package", config.packageName, equals(config.packageName))
+	if config.versionCode > 0 {
+		check(namespace, versionCodeAttr, fmt.Sprint(config.versionCode), func(value string) bool {
+			v, err := strconv.ParseInt(value, 0, 32)
+			return err == nil && int32(v) == config.versionCode
+		})
+	}
+	check(namespace, versionNameAttr, versionName, equals(versionName))
+	return unapplied
+}
+
+// nextVersionCode returns the manifest's versionCode plus increment for -incrementVersionCode and
+// -versionCode-increment.
+func nextVersionCode(root *XmlElement, increment int32) (int32, error) {
+	attr := findAttr(root, namespace, versionCodeAttr)
+	if attr == nil {
+		return 0, withExitCode(exitNotFound, errors.New("incrementing the versionCode needs a versionCode, but the manifest has none"))
+	}
+	var code int64
+	switch x := attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+	case *Primitive_IntDecimalValue:
+		code = int64(x.IntDecimalValue)
+	case *Primitive_IntHexadecimalValue:
+		code = int64(x.IntHexadecimalValue)
+	default:
+		return 0, fmt.Errorf("incrementing the versionCode needs a compiled integer versionCode, but the manifest has %q", attrValue(attr))
+	}
+	if code < 0 || code+int64(increment) > math.MaxInt32 {
+		return 0, fmt.Errorf("the manifest's versionCode %d can't be incremented by %d", code, increment)
+	}
+	return int32(code + int64(increment)), nil
+}
+
+// deriveVersionName formats the versionCode set by this run, or else the manifest's current one,
+// with the -versionName-from-code pattern.
+func deriveVersionName(root *XmlElement, config *editConfig) (string, error) {
+	code, err := newVersionCode(root, config, "-versionName-from-code")
+	if err != nil {
+		return "", err
+	}
+	return config.versionNamePattern.format(code)
+}
+
+// newVersionCode returns the versionCode set by this run, or else the manifest's current one.
+// user names the option that needs it for the error if there's none.
+func newVersionCode(root *XmlElement, config *editConfig, user string) (int32, error) {
+	if config.versionCode != 0 {
+		return config.versionCode, nil
+	}
+	attr := findAttr(root, namespace, versionCodeAttr)
+	if attr == nil {
+		return 0, withExitCode(exitNotFound, fmt.Errorf("%s needs a versionCode, but the manifest has none", user))
+	}
+	v, err := strconv.ParseInt(attrValue(attr), 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("failed reading the manifest's versionCode: %w", err)
+	}
+	return int32(v), nil
+}
+
+// addToZipNative 使用Go内置zip包替代外部zip命令
+// zipPath: 目标zip文件路径
+// fileName: 要添加到zip中的文件名
+// source: 源文件，为nil时只替换或添加extra中的文件
+// rename: 要重命名的模块，可以为nil
+// extra: 额外要添加的文件（名称到内容），已存在的同名文件会被原地替换，可以为nil
+//
+// All other entries are copied raw, without recompressing them, in their original order.
+// The result is written to a temp file next to zipPath which then replaces the original.
+func addToZipNative(zipPath string, fileName string, source *os.File, rename *moduleRename, extra map[string][]byte) error {
+	reader, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer reader.Close()
+	if rename != nil {
+		if err := rename.check(&reader.Reader); err != nil {
+			return err
+		}
+	}
+
+	zipFile, err := createTempSibling(zipPath)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(zipFile)
+	var replacement io.ReadSeeker
+	if source != nil {
+		replacement = source
+	}
+	if err := rewriteZip(&reader.Reader, zipFile, zipPath, fileName, replacement, rename, extra); err != nil {
+		return err
+	}
+	if err := zipFile.Close(); err != nil {
+		return fmt.Errorf("failed writing zip file: %w", err)
+	}
+	reader.Close()
+	if err := renameSynced(zipFile.Name(), zipPath); err != nil {
+		return fmt.Errorf("failed replacing zip file: %w", err)
+	}
+	return nil
+}
+
+// rewriteZip writes the entries of reader to out, with fileName replaced by or, if it's missing,
+// added from source unless that's nil, and the extra entries replaced or added. It works on any
+// reader and writer, e.g. an archive in memory, and name is only used for -progress.
+func rewriteZip(reader *zip.Reader, out io.Writer, name string, fileName string, source io.ReadSeeker, rename *moduleRename, extra map[string][]byte) error {
+	offset := &offsetWriter{w: out}
+	zipWriter := zip.NewWriter(offset)
+	replaced := false
+	written := map[string]bool{}
+	renamed := 0
+	progress := newZipProgress(name, reader.File)
+	for _, file := range reader.File {
+		if err := checkCancelled(); err != nil {
+			return err
+		}
+		progress.entryDone(int64(file.CompressedSize64))
+		header := file.FileHeader
+		header.Name = rename.apply(file.Name)
+		if header.Name != file.Name {
+			fmt.Println("Renaming", file.Name, "to", header.Name)
+			renamed++
+		}
+		// Without a source, the entry called fileName is copied like the others.
+		replace := source != nil && file.Name == fileName
+		if _, isExtra := extra[file.Name]; header.Method == zip.Store && (replace || isExtra) {
+			if err := alignHeader(zipWriter, offset, &header, storedAlignment(header.Name)); err != nil {
+				return err
+			}
+		}
+		if replace {
+			if err := writeZipEntry(zipWriter, header, source); err != nil {
+				return err
+			}
+			offset.descriptor = 0
+			replaced = true
+			continue
+		}
+		if data, ok := extra[file.Name]; ok {
+			if err := writeZipEntry(zipWriter, header, bytes.NewReader(data)); err != nil {
+				return err
+			}
+			offset.descriptor = 0
+			written[file.Name] = true
+			continue
+		}
+		if err := copyZipEntry(zipWriter, offset, file, header); err != nil {
+			return err
+		}
+	}
+	modTime, err := buildTime()
+	if err != nil {
+		return err
+	}
+	if !replaced && source != nil {
+		header := zip.FileHeader{Name: rename.apply(fileName), Method: zip.Deflate}
+		header.SetModTime(modTime)
+		if err := writeZipEntry(zipWriter, header, source); err != nil {
+			return err
+		}
+	}
+	var names []string
+	for name := range extra {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetModTime(modTime)
+		if err := writeZipEntry(zipWriter, header, bytes.NewReader(extra[name])); err != nil {
+			return err
+		}
+	}
+	progress.finish()
+	if rename != nil {
+		fmt.Printf("Renamed module %s to %s (%d entries)\n", rename.old, rename.new, renamed)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed writing zip file: %w", err)
+	}
+	return nil
+}
+
+// createTempSibling creates a temp file in the same directory and with the same mode as path, so it
+// can atomically replace path via renameSynced.
+func createTempSibling(path string) (*os.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file: %w", err)
+	}
+	file, err := createTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(info.Mode()); err != nil {
+		removeTemp(file)
+		return nil, fmt.Errorf("failed creating temp file: %w", err)
+	}
+	return file, nil
+}
+
+// renameSynced atomically replaces path with the finished temp file. The temp file is synced to
+// disk first, so a crash or power loss right after the rename leaves the new content instead of an
+// empty or truncated file, and the directory afterwards, so the rename itself is durable.
+func renameSynced(temp string, path string) error {
+	file, err := os.OpenFile(temp, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = file.Sync()
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return err
+	}
+	// Not every platform can sync a directory, e.g. Windows, and the file is replaced either way.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// updateCopy applies the config to a copy of src, which then replaces dst. src is never modified and
+// dst only once all edits succeeded. The copy keeps the extension of src, which decides how it's
+// processed.
+func updateCopy(src string, dst string, config *editConfig) ([]change, bool, error) {
+	out, err := copyToTemp(src, filepath.Dir(dst), filepath.Base(dst)+".*"+filepath.Ext(src))
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(out)
+	changes, written, err := updateFile(out.Name(), config)
+	if err != nil {
+		return nil, false, err
+	}
+	if config.skipUnchanged {
+		same, err := sameContent(out.Name(), dst)
+		if err != nil {
+			return nil, false, err
+		}
+		if same {
+			fmt.Println(dst, "is unchanged, no write needed")
+			return changes, false, nil
+		}
+	}
+	if err := renameSynced(out.Name(), dst); err != nil {
+		return nil, false, fmt.Errorf("failed writing output: %w", err)
+	}
+	fmt.Println("Wrote", dst)
+	return changes, written, nil
+}
+
+// sameContent reports whether the files have the same content. A missing b is different.
+func sameContent(a string, b string) (bool, error) {
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("failed reading file: %w", err)
+	}
+	infoB, err := os.Stat(b)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && infoA.Size() != infoB.Size() {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed reading file: %w", err)
+	}
+	dataA, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("failed reading file: %w", err)
+	}
+	dataB, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("failed reading file: %w", err)
+	}
+	return bytes.Equal(dataA, dataB), nil
+}
+
+// updateStdio applies the config to a proto manifest read from stdin and writes the result to
+// stdout, for the file argument -. The manifest is written even if it's unchanged.
+func updateStdio(stdout io.Writer, config *editConfig) error {
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(manifest)
+	if _, err := io.Copy(manifest, os.Stdin); err != nil {
+		return fmt.Errorf("failed reading stdin: %w", err)
+	}
+	if err := manifest.Close(); err != nil {
+		return fmt.Errorf("failed writing temp file: %w", err)
+	}
+	stdioConfig := *config
+	stdioConfig.skipUnchanged = false
+	if _, _, err := updateManifest(manifest.Name(), &stdioConfig); err != nil {
+		return err
+	}
+	out, err := os.ReadFile(manifest.Name())
+	if err != nil {
+		return fmt.Errorf("failed reading file: %w", err)
+	}
+	if _, err := stdout.Write(out); err != nil {
+		return fmt.Errorf("failed writing stdout: %w", err)
+	}
+	return nil
+}
+
+// copyToTemp copies src to a new temp file in dir with the same mode. The returned file is closed.
+func copyToTemp(src string, dir string, pattern string) (*os.File, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening file: %w", err)
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file: %w", err)
+	}
+	out, err := createTemp(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	err = out.Chmod(info.Mode())
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeTemp(out)
+		return nil, fmt.Errorf("failed copying file: %w", err)
+	}
+	return out, nil
+}
+
+// replaceFile atomically replaces the content of path with data.
+func replaceFile(path string, data []byte) error {
+	out, err := createTempSibling(path)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(out)
+	if _, err := out.Write(data); err != nil {
+		return fmt.Errorf("failed writing file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed writing file: %w", err)
+	}
+	if err := renameSynced(out.Name(), path); err != nil {
+		return fmt.Errorf("failed replacing file: %w", err)
+	}
+	return nil
+}
+
+// backupFile copies path to path.bak for -backup, replacing an earlier backup.
+func backupFile(path string) error {
+	backup, err := copyToTemp(path, filepath.Dir(path), filepath.Base(path)+".bak.*")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(backup)
+	if err := renameSynced(backup.Name(), path+".bak"); err != nil {
+		return fmt.Errorf("failed writing backup: %w", err)
+	}
+	fmt.Println("Backed up", path, "to", path+".bak")
+	return nil
+}
+
+// copyFile atomically replaces dst with the content of src.
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed opening file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := createTempSibling(dst)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(out)
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed copying file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed copying file: %w", err)
+	}
+	if err := renameSynced(out.Name(), dst); err != nil {
+		return fmt.Errorf("failed replacing file: %w", err)
+	}
+	return nil
+}
+
+// copyZipEntry copies the still compressed entry data together with its original header.
+// Stored entries are aligned like zipalign -p does. The header can differ from the
+// entry's original header, e.g. in its name.
+func copyZipEntry(zipWriter *zip.Writer, offset *offsetWriter, file *zip.File, header zip.FileHeader) error {
+	// With Modified set, archive/zip would append another extended timestamp field to Extra.
+	// The MS-DOS time fields and the original Extra already contain the modification time.
+	header.Modified = time.Time{}
+	if alignment := entryAlignment(file); alignment > 0 {
+		if err := alignHeader(zipWriter, offset, &header, alignment); err != nil {
+			return err
+		}
+	}
+	writer, err := zipWriter.CreateRaw(&header)
+	if err != nil {
+		return fmt.Errorf("failed creating file in zip: %w", err)
+	}
+	offset.descriptor = dataDescriptorSize(&header)
+	rc, err := file.OpenRaw()
+	if err != nil {
+		return fmt.Errorf("failed opening file in zip: %w", err)
+	}
+	if _, err := io.Copy(writer, cancellableReader{rc}); err != nil {
+		return fmt.Errorf("failed copying file in zip: %w", err)
+	}
+	return nil
+}
+
+// writeZipEntry writes source as a new entry, taking the name, compression method and metadata from header.
+// The data is compressed here and written with CreateRaw, because CreateHeader would replace the
+// creator and reader versions of the original entry with its own.
+func writeZipEntry(zipWriter *zip.Writer, header zip.FileHeader, source io.ReadSeeker) error {
+	source.Seek(0, 0)
+	data, err := io.ReadAll(source)
+	if err != nil {
+		return fmt.Errorf("failed reading file for zip: %w", err)
+	}
+	compressed := data
+	switch header.Method {
+	case zip.Store:
+	case zip.Deflate:
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.DefaultCompression)
+		if _, err := w.Write(data); err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("failed compressing file for zip: %w", err)
+		}
+		compressed = buf.Bytes()
+	default:
+		return fmt.Errorf("unsupported compression method for %s: %d", header.Name, header.Method)
+	}
+
+	fh := &zip.FileHeader{
+		Name:           header.Name,
+		Comment:        header.Comment,
+		Method:         header.Method,
+		ModifiedTime:   header.ModifiedTime,
+		ModifiedDate:   header.ModifiedDate,
+		ExternalAttrs:  header.ExternalAttrs,
+		CreatorVersion: header.CreatorVersion,
+		ReaderVersion:  header.ReaderVersion,
+		// The sizes are known up front, so there's no need for a data descriptor.
+		Flags:              header.Flags &^ 0x8,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(len(compressed)),
+		UncompressedSize64: uint64(len(data)),
+	}
+	// Stored entries keep the padding of alignHeader. Deflated ones keep the other extra fields,
+	// like extended timestamps, but not the padding of the old data or its zip64 sizes, which
+	// zip.Writer adds itself when they're needed.
+	if header.Method == zip.Store {
+		fh.Extra = header.Extra
+	} else {
+		fh.Extra = stripExtraFields(header.Extra, zip64ExtraID, alignmentExtraID)
+	}
+	// Same defaults as CreateHeader: version 2.0, made by MS-DOS.
+	if fh.CreatorVersion == 0 {
+		fh.CreatorVersion = 20
+	}
+	if fh.ReaderVersion == 0 {
+		fh.ReaderVersion = 20
+	}
+	if zipCreatorVersion != 0 {
+		fh.CreatorVersion = zipCreatorVersion
+	}
+	writer, err := zipWriter.CreateRaw(fh)
+	if err != nil {
+		return fmt.Errorf("failed creating new file in zip: %w", err)
+	}
+	if _, err := writer.Write(compressed); err != nil {
+		return fmt.Errorf("failed copying file to zip: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,626 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+const testManifest = `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app" android:versionCode="1" android:versionName="1.0">
+  <uses-sdk android:minSdkVersion="21" android:targetSdkVersion="33"/>
+  <uses-permission android:name="android.permission.INTERNET"/>
+  <application android:label="App"/>
+</manifest>`
+
+// testEntryTime is the modification time of the entries of the archives built by buildZip.
+var testEntryTime = time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC)
+
+// zipEntry is an entry of an archive built by buildZip.
+type zipEntry struct {
+	name   string
+	data   string
+	method uint16
+}
+
+// protoManifest compiles the text manifest to aapt2's proto format.
+func protoManifest(t testing.TB, text string) []byte {
+	t.Helper()
+	node, err := decodeTextManifest([]byte(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := node.MarshalVT()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// buildZip returns an archive with the entries in order.
+func buildZip(t testing.TB, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: entry.method}
+		header.SetModTime(testEntryTime)
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, entry.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func openZip(t testing.TB, data []byte) *zip.Reader {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func readEntry(t testing.TB, f *zip.File) string {
+	t.Helper()
+	rc, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func entryNames(r *zip.Reader) []string {
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// manifestAttr returns the value of the attribute in the proto manifest and whether it exists.
+func manifestAttr(t testing.TB, data []byte, path string, uri string, name string) (string, bool) {
+	t.Helper()
+	node, err := parseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	element := node.GetElement()
+	if path != "" {
+		element = childElement(element, path)
+		if element == nil {
+			return "", false
+		}
+	}
+	attr := findAttr(element, uri, name)
+	if attr == nil {
+		return "", false
+	}
+	return attr.GetValue(), true
+}
+
+func TestEditManifest(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  editConfig
+		element string
+		attr    string
+		want    string
+		changes int
+	}{
+		{"versionCode", editConfig{versionCode: 42}, "", versionCodeAttr, "42", 1},
+		{"versionName", editConfig{versionName: "2.0"}, "", versionNameAttr, "2.0", 1},
+		{"increment", editConfig{versionCodeIncrement: 5}, "", versionCodeAttr, "6", 1},
+		{"suffix", editConfig{versionNameSuffix: "-beta"}, "", versionNameAttr, "1.0-beta", 1},
+		{"uses-sdk", editConfig{attrSets: []attrSet{androidAttr("minSdkVersion", "24")}}, "uses-sdk", "minSdkVersion", "24", 1},
+		{"application", editConfig{attrSets: []attrSet{androidAttr("debuggable", "false")}}, "application", "debuggable", "false", 1},
+	}
+	in := protoManifest(t, testManifest)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, out, err := editManifest(in, &tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != tt.changes {
+				t.Errorf("got %d changes, want %d: %v", len(changes), tt.changes, changes)
+			}
+			if got, _ := manifestAttr(t, out, tt.element, namespace, tt.attr); got != tt.want {
+				t.Errorf("%s = %q, want %q", tt.attr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditManifestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     []byte
+		config editConfig
+		code   int
+	}{
+		{"empty", nil, editConfig{versionCode: 1}, exitParse},
+		{"text XML", []byte(testManifest), editConfig{versionCode: 1}, exitParse},
+		{"binary XML", append(slices.Clone(binaryXMLHeader), 0, 0), editConfig{versionCode: 1}, exitParse},
+		{"suffix without versionName", protoManifest(t, `<manifest package="com.example.app"/>`), editConfig{versionNameSuffix: "-beta"}, exitNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := editManifest(tt.in, &tt.config)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if code := exitCode(err); code != tt.code {
+				t.Errorf("exit code %d, want %d: %v", code, tt.code, err)
+			}
+		})
+	}
+}
+
+func TestRewriteZip(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	const name = "base/manifest/AndroidManifest.xml"
+	input := buildZip(t,
+		zipEntry{name: "BundleConfig.pb", data: "config"},
+		zipEntry{name: name, data: "old", method: zip.Deflate},
+		zipEntry{name: "base/dex/classes.dex", data: "dex", method: zip.Deflate},
+	)
+	tests := []struct {
+		name     string
+		input    []byte
+		source   io.ReadSeeker
+		rename   *moduleRename
+		extra    map[string][]byte
+		want     map[string]string
+		wantList []string
+	}{
+		{
+			name:     "replace",
+			input:    input,
+			source:   bytes.NewReader([]byte("new")),
+			want:     map[string]string{name: "new", "BundleConfig.pb": "config", "base/dex/classes.dex": "dex"},
+			wantList: []string{"BundleConfig.pb", name, "base/dex/classes.dex"},
+		},
+		{
+			name:     "add missing",
+			input:    buildZip(t, zipEntry{name: "BundleConfig.pb", data: "config"}),
+			source:   bytes.NewReader([]byte("new")),
+			want:     map[string]string{name: "new"},
+			wantList: []string{"BundleConfig.pb", name},
+		},
+		{
+			name:     "extra",
+			input:    input,
+			extra:    map[string][]byte{"BundleConfig.pb": []byte("edited"), "META-INF/b": []byte("b"), "META-INF/a": []byte("a")},
+			want:     map[string]string{name: "old", "BundleConfig.pb": "edited", "META-INF/a": "a"},
+			wantList: []string{"BundleConfig.pb", name, "base/dex/classes.dex", "META-INF/a", "META-INF/b"},
+		},
+		{
+			name:     "rename",
+			input:    input,
+			source:   bytes.NewReader([]byte("new")),
+			rename:   &moduleRename{old: "base", new: "app"},
+			want:     map[string]string{"app/manifest/AndroidManifest.xml": "new", "app/dex/classes.dex": "dex"},
+			wantList: []string{"BundleConfig.pb", "app/manifest/AndroidManifest.xml", "app/dex/classes.dex"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := rewriteZip(openZip(t, tt.input), &out, "test.aab", name, tt.source, tt.rename, tt.extra); err != nil {
+				t.Fatal(err)
+			}
+			r := openZip(t, out.Bytes())
+			if got := entryNames(r); !slices.Equal(got, tt.wantList) {
+				t.Errorf("entries %v, want %v", got, tt.wantList)
+			}
+			for _, f := range r.File {
+				want, ok := tt.want[f.Name]
+				if !ok {
+					continue
+				}
+				if got := readEntry(t, f); got != want {
+					t.Errorf("%s = %q, want %q", f.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteZipAddedEntryTime(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	want := time.Unix(1700000000, 0).UTC()
+	input := buildZip(t, zipEntry{name: "BundleConfig.pb", data: "config"})
+	var out bytes.Buffer
+	extra := map[string][]byte{"META-INF/extra": []byte("extra")}
+	if err := rewriteZip(openZip(t, input), &out, "test.aab", "base/manifest/AndroidManifest.xml", bytes.NewReader([]byte("new")), nil, extra); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range openZip(t, out.Bytes()).File[1:] {
+		if got := f.Modified.UTC(); !got.Equal(want) {
+			t.Errorf("%s was modified %v, want %v", f.Name, got, want)
+		}
+	}
+}
+
+func TestExtractEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []zipEntry
+		entry   string
+		want    string
+		code    int
+	}{
+		{"exact", []zipEntry{{name: "AndroidManifest.xml", data: "manifest", method: zip.Deflate}}, "AndroidManifest.xml", "manifest", 0},
+		{"stored", []zipEntry{{name: "resources.pb", data: "table"}}, "resources.pb", "table", 0},
+		{"exact wins", []zipEntry{{name: "androidmanifest.xml", data: "lower"}, {name: "AndroidManifest.xml", data: "exact"}}, "AndroidManifest.xml", "exact", 0},
+		{"case folded", []zipEntry{{name: "base/manifest/androidmanifest.xml", data: "lower"}}, "base/manifest/AndroidManifest.xml", "lower", 0},
+		{"missing", []zipEntry{{name: "classes.dex", data: "dex"}}, "AndroidManifest.xml", "", exitIO},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := extractEntry(openZip(t, buildZip(t, tt.entries...)), "test.apk", tt.entry, &out)
+			if tt.code != 0 {
+				if err == nil || exitCode(err) != tt.code {
+					t.Fatalf("got %v, want exit code %d", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("got %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// largeBundle returns an AAB-like archive of about 64 MiB with the manifest in the middle, like
+// the ones with native libraries and assets where the manifest is a tiny part.
+func largeBundle(b *testing.B) []byte {
+	b.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	chunk := make([]byte, 512<<10)
+	entries := []zipEntry{{name: "BundleConfig.pb", data: "config"}}
+	for i := range 128 {
+		// Half random, half zeroes, so deflate has some work to do.
+		for j := range len(chunk) / 2 {
+			chunk[j] = byte(rng.Uint32())
+		}
+		entries = append(entries, zipEntry{name: fmt.Sprintf("base/assets/%03d.bin", i), data: string(chunk), method: zip.Deflate})
+		if i == 64 {
+			entries = append(entries, zipEntry{name: "base/manifest/AndroidManifest.xml", data: testManifest, method: zip.Deflate})
+		}
+	}
+	return buildZip(b, entries...)
+}
+
+// BenchmarkRewriteZip measures replacing the manifest of a large AAB. Copying the other entries raw
+// avoids decompressing and compressing them again, e.g. with Go 1.27 on one core of a linux/amd64
+// Xeon:
+//
+//	BenchmarkRewriteZip/recompress    31   38860196 ns/op    865.04 MB/s
+//	BenchmarkRewriteZip/raw          195    5459584 ns/op   6157.15 MB/s
+//
+// The raw copy is about 7 times faster and only bound by memory bandwidth, as the time grows with
+// the size of the archive but not with the work deflate does for it.
+func BenchmarkRewriteZip(b *testing.B) {
+	input := largeBundle(b)
+	manifest := []byte(testManifest)
+	b.Run("recompress", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for b.Loop() {
+			r := openZip(b, input)
+			w := zip.NewWriter(io.Discard)
+			for _, f := range r.File {
+				out, err := w.CreateHeader(&f.FileHeader)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var in io.Reader = bytes.NewReader(manifest)
+				if f.Name != "base/manifest/AndroidManifest.xml" {
+					rc, err := f.Open()
+					if err != nil {
+						b.Fatal(err)
+					}
+					in = rc
+				}
+				if _, err := io.Copy(out, in); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("raw", func(b *testing.B) {
+		b.SetBytes(int64(len(input)))
+		for b.Loop() {
+			if err := rewriteZip(openZip(b, input), io.Discard, "test.aab", "base/manifest/AndroidManifest.xml", bytes.NewReader(manifest), nil, nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// rawZip returns an archive with the headers written as they are, e.g. with their creator and
+// reader versions, which CreateHeader would replace.
+func rawZip(t testing.TB, headers ...zip.FileHeader) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, header := range headers {
+		header.Method = zip.Store
+		header.CRC32 = crc32.ChecksumIEEE([]byte(header.Name))
+		header.CompressedSize64 = uint64(len(header.Name))
+		header.UncompressedSize64 = uint64(len(header.Name))
+		f, err := w.CreateRaw(&header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, header.Name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRewriteZipVersions(t *testing.T) {
+	input := rawZip(t,
+		zip.FileHeader{Name: "AndroidManifest.xml", CreatorVersion: 0x0314, ReaderVersion: 10},
+		zip.FileHeader{Name: "classes.dex", CreatorVersion: 0x0b2d, ReaderVersion: 45},
+		zip.FileHeader{Name: "resources.arsc", CreatorVersion: 0x000a, ReaderVersion: 10},
+	)
+	tests := []struct {
+		name           string
+		creatorVersion uint16
+		want           map[string][2]uint16
+	}{
+		{"preserved", 0, map[string][2]uint16{"AndroidManifest.xml": {0x0314, 10}, "classes.dex": {0x0b2d, 45}, "resources.arsc": {0x000a, 10}}},
+		// -zip-creator-version only applies to the entries written anew.
+		{"overridden", 0x0017, map[string][2]uint16{"AndroidManifest.xml": {0x0017, 10}, "classes.dex": {0x0b2d, 45}, "resources.arsc": {0x000a, 10}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zipCreatorVersion = tt.creatorVersion
+			t.Cleanup(func() { zipCreatorVersion = 0 })
+			var out bytes.Buffer
+			if err := rewriteZip(openZip(t, input), &out, "test.apk", "AndroidManifest.xml", bytes.NewReader([]byte("new")), nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range openZip(t, out.Bytes()).File {
+				if got := [2]uint16{f.CreatorVersion, f.ReaderVersion}; got != tt.want[f.Name] {
+					t.Errorf("%s has creator and reader versions %#04x, want %#04x", f.Name, got, tt.want[f.Name])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAabLowercaseManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.aab")
+	input := buildZip(t,
+		zipEntry{name: "BundleConfig.pb"},
+		zipEntry{name: "base/manifest/androidmanifest.xml", data: string(protoManifest(t, testManifest)), method: zip.Deflate},
+		zipEntry{name: "base/dex/classes.dex", data: "dex", method: zip.Deflate},
+	)
+	if err := os.WriteFile(path, input, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, written, err := updateFile(path, &editConfig{versionCode: 42}); err != nil || !written {
+		t.Fatalf("got written %v and %v", written, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := openZip(t, data)
+	// The entry keeps its name, so nothing else about the archive changes.
+	want := []string{"BundleConfig.pb", "base/manifest/androidmanifest.xml", "base/dex/classes.dex"}
+	if got := entryNames(r); !slices.Equal(got, want) {
+		t.Fatalf("entries %v, want %v", got, want)
+	}
+	if got, _ := manifestAttr(t, []byte(readEntry(t, r.File[1])), "", namespace, versionCodeAttr); got != "42" {
+		t.Errorf("versionCode = %q, want 42", got)
+	}
+}
+
+func TestAddToZipNativeKeepsOrder(t *testing.T) {
+	var entries []zipEntry
+	for i := range 50 {
+		// Names in reverse, so neither sorting nor a map would give this order.
+		entries = append(entries, zipEntry{name: fmt.Sprintf("res/raw/%02d.txt", 50-i), data: fmt.Sprint(i), method: zip.Deflate})
+		if i == 25 {
+			entries = append(entries, zipEntry{name: "AndroidManifest.xml", data: "old", method: zip.Deflate})
+		}
+	}
+	path := filepath.Join(t.TempDir(), "app.zip")
+	input := buildZip(t, entries...)
+	if err := os.WriteFile(path, input, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.Open(writeTestFile(t, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	want := entryNames(openZip(t, input))
+	for range 3 {
+		if err := addToZipNative(path, "AndroidManifest.xml", source, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := entryNames(openZip(t, data)); !slices.Equal(got, want) {
+			t.Fatalf("entries %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFailedWriteKeepsOriginal(t *testing.T) {
+	input := buildZip(t,
+		zipEntry{name: "BundleConfig.pb"},
+		zipEntry{name: "base/manifest/AndroidManifest.xml", data: string(protoManifest(t, `<manifest package="com.example.app"/>`)), method: zip.Deflate},
+		zipEntry{name: "base/dex/classes.dex", data: "dex", method: zip.Deflate},
+	)
+	tests := []struct {
+		name   string
+		update func(path string) error
+	}{
+		{"source fails mid-write", func(path string) error {
+			// The entries before the manifest are written to the temp file already when reading
+			// the closed source fails.
+			source, err := os.Open(writeTestFile(t, "new"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			source.Close()
+			return addToZipNative(path, "base/manifest/AndroidManifest.xml", source, nil, nil)
+		}},
+		{"edit fails", func(path string) error {
+			_, _, err := updateFile(path, &editConfig{versionNameSuffix: "-beta"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.aab")
+			if err := os.WriteFile(path, input, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.update(path); err == nil {
+				t.Fatal("expected an error")
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, input) {
+				t.Error("the original was modified")
+			}
+			if files, _ := os.ReadDir(dir); len(files) != 1 {
+				t.Errorf("temp files were left behind: %v", files)
+			}
+		})
+	}
+}
+
+func TestRewriteZipKeepsHeaders(t *testing.T) {
+	// The manifest has an unknown extra field, which is kept, and alignment padding, which isn't.
+	custom := []byte{0xfe, 0xca, 2, 0, 1, 2}
+	padding := []byte{0x35, 0xd9, 2, 0, 4, 0}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for i, name := range []string{"AndroidManifest.xml", "classes.dex", "res/raw/script.sh", "assets/data.bin"} {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate, Comment: "entry " + name}
+		header.Modified = time.Date(2019, 5, 6, 7, 8, 10+i*2, 0, time.UTC)
+		header.SetMode(0o644)
+		if name == "res/raw/script.sh" {
+			header.SetMode(0o755)
+		}
+		if name == "AndroidManifest.xml" {
+			header.Extra = slices.Concat(custom, padding)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	before := openZip(t, buf.Bytes())
+	var out bytes.Buffer
+	if err := rewriteZip(before, &out, "test.apk", "AndroidManifest.xml", bytes.NewReader([]byte("new")), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	after := openZip(t, out.Bytes())
+	// zip.Writer appended the extended timestamp of Modified to the manifest's fields.
+	timestamp := before.File[0].Extra[len(custom)+len(padding):]
+	if want := slices.Concat(custom, timestamp); !bytes.Equal(after.File[0].Extra, want) {
+		t.Errorf("the rewritten manifest has the extra fields % x, want % x", after.File[0].Extra, want)
+	}
+	for i, f := range after.File[1:] {
+		if want := before.File[i+1].FileHeader; !reflect.DeepEqual(f.FileHeader, want) {
+			t.Errorf("%s has the header\n%+v\nwant\n%+v", f.Name, f.FileHeader, want)
+		}
+	}
+}
+
+func TestRecursiveJobs(t *testing.T) {
+	aab := buildZip(t, zipEntry{name: "BundleConfig.pb"}, zipEntry{name: "base/manifest/AndroidManifest.xml", data: string(protoManifest(t, testManifest)), method: zip.Deflate})
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		// The invalid APK fails, but the other files are still processed.
+		{"invalid file", []string{"-jobs", "2"}, exitFailure},
+		{"skip invalid", []string{"-jobs", "2", "-skip-invalid"}, 0},
+		{"skip invalid sequentially", []string{"-skip-invalid"}, 0},
+		{"parallel", []string{"-parallel", "2", "-skip-invalid"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths := []string{filepath.Join(dir, "a.aab"), filepath.Join(dir, "sub", "b.aab"), filepath.Join(dir, "sub", "deep", "c.aab")}
+			for _, path := range paths {
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, aab, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(dir, "sub", "notes.apk"), []byte("not an APK"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			args := append(append([]string{"-versionCode", "42", "-recursive"}, tt.args...), dir)
+			if code := runMain(t, args...); code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+			for _, path := range paths {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				manifest := readEntry(t, openZip(t, data).File[1])
+				if got, _ := manifestAttr(t, []byte(manifest), "", namespace, versionCodeAttr); got != "42" {
+					t.Errorf("%s: versionCode %q, want 42", path, got)
+				}
+			}
+		})
+	}
+}
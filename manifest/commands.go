@@ -0,0 +1,99 @@
+package manifest
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// subcommand is a command like `androidmanifest-changer get`. Except for diff, the commands are
+// modes of the flat command line, which keeps working without a command, with their own usage and
+// the subset of the flags that applies to them.
+type subcommand struct {
+	name        string
+	args        string
+	description string
+	// The flags the command accepts besides commonFlags. If nil, every flag except the modeFlags of
+	// the other commands is accepted.
+	flags []string
+}
+
+var subcommands = []subcommand{
+	{"set", "[flags] FILE...", "Edit the manifests of APKs, AABs, APK sets or proto manifests, like the command line without a command.", nil},
+	{"get", "[flags] [NAME] FILE", "Print the package, versionCode, versionName and SDK versions, or only the value of NAME, e.g. versionCode or minSdk.", []string{"json", "manifestPath"}},
+	{"dump", "[flags] FILE", "Print the whole manifest as XML, or with -json as JSON.", []string{"json", "manifestPath"}},
+	{"diff", "[flags] OLD NEW", "Print the element and attribute level differences between two manifests.", nil},
+	{"serve", "[flags]", "Run an HTTP service that edits uploaded APKs and AABs, for build farms.", nil},
+	{"verify", "[flags] FILE...", "Check the manifests like -verify does, and optionally assertions and APK signatures, without modifying them.", []string{"assert", "verify-badging", "verify-signature", "manifestPath"}},
+	{"sign", "[flags] APK...", "Re-sign APKs with apksigner without editing them.", []string{"ks", "ks-pass", "ks-key-alias", "key-pass", "key", "cert", "verify-signature"}},
+}
+
+// commonFlags apply to every command.
+var commonFlags = []string{"aapt2", "build-tools", "native-axml", "tmpdir", "format", "timeout", "verbose", "v", "quiet", "q"}
+
+// modeFlags select what the flat command line does instead of editing. The set command rejects
+// them, because it always edits: get, dump and verify do the same as some of them, and the others
+// only apply to the flat command line.
+var modeFlags = []string{
+	"print", "get", "print-sdk", "dump", "list-namespaces", "validate-only", "count-only", "dryRun", "dry-run",
+	"dump-axml", "extract",
+}
+
+// parseSubcommand returns the command named by the first argument, or nil for the flat command
+// line. A file called like a command can still be passed as ./set.
+func parseSubcommand() *subcommand {
+	if len(os.Args) < 2 {
+		return nil
+	}
+	for i := range subcommands {
+		if subcommands[i].name == os.Args[1] {
+			return &subcommands[i]
+		}
+	}
+	return nil
+}
+
+// usage prints the usage of the command with only the flags it accepts.
+func (c *subcommand) usage() {
+	// A flag set with only the accepted flags prints them like flag.PrintDefaults.
+	accepted := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	accepted.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if c.accepts(f.Name) {
+			accepted.Var(f.Value, f.Name, f.Usage)
+			accepted.Lookup(f.Name).DefValue = f.DefValue
+		}
+	})
+	fmt.Fprintf(accepted.Output(), "Usage: androidmanifest-changer %s %s\n\n%s\n\nFlags:\n", c.name, c.args, c.description)
+	accepted.PrintDefaults()
+}
+
+func (c *subcommand) accepts(name string) bool {
+	if c.flags == nil {
+		return !slices.Contains(modeFlags, name)
+	}
+	return slices.Contains(c.flags, name) || slices.Contains(commonFlags, name)
+}
+
+// checkFlags fails if a flag given on the command line doesn't apply to the command.
+func (c *subcommand) checkFlags() {
+	flag.Visit(func(f *flag.Flag) {
+		if !c.accepts(f.Name) {
+			fmt.Fprintf(flag.CommandLine.Output(), "Error: -%s doesn't apply to the %s command.\n", f.Name, c.name)
+			c.usage()
+			exit(exitUsage)
+		}
+	})
+}
+
+// usage prints the usage of the flat command line, which lists the commands first.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: androidmanifest-changer [COMMAND] [flags] FILE...\n\nCommands:\n")
+	for _, c := range subcommands {
+		fmt.Fprintf(out, "  %-8s%s\n", c.name, c.description)
+	}
+	fmt.Fprintf(out, "\nWithout a command, the flags below edit the files like set, or select one of the other modes.\nRun androidmanifest-changer COMMAND -h for the flags of a command.\n\nFlags:\n")
+	flag.PrintDefaults()
+}
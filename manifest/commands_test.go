@@ -0,0 +1,31 @@
+package manifest
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetRejectsModeFlags(t *testing.T) {
+	aab := buildZip(t, zipEntry{name: "BundleConfig.pb"}, zipEntry{name: "base/manifest/AndroidManifest.xml", data: string(protoManifest(t, testManifest)), method: zip.Deflate})
+	path := filepath.Join(t.TempDir(), "app.aab")
+	if err := os.WriteFile(path, aab, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"-count-only"},
+		{"-dryRun"},
+		{"-dry-run"},
+		{"-dump-axml", filepath.Join(t.TempDir(), "AndroidManifest.xml")},
+		{"-extract", filepath.Join(t.TempDir(), "AndroidManifest.pb")},
+		{"-print"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			args := append(append([]string{"set", "-versionCode", "2"}, args...), path)
+			if code := runMain(t, args...); code != exitUsage {
+				t.Errorf("exit code %d, want %d", code, exitUsage)
+			}
+		})
+	}
+}
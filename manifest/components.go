@@ -0,0 +1,184 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var componentTypes = []string{"activity", "activity-alias", "service", "receiver", "provider"}
+
+// componentSelector picks a component below <application>. See the README for the syntax.
+type componentSelector struct {
+	// One of the componentTypes, "launcher" or "" to match by name.
+	kind  string
+	name  string
+	index int
+}
+
+func parseComponentSelector(s string) (componentSelector, error) {
+	sel := componentSelector{index: -1}
+	if s == "first-launcher" {
+		return componentSelector{kind: "launcher", index: 0}, nil
+	}
+	if base, index, ok := strings.Cut(s, "["); ok {
+		n, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+		if err != nil || !strings.HasSuffix(index, "]") || n < 0 {
+			return sel, fmt.Errorf("invalid component selector %q: expected a zero-based index like %s[0]", s, base)
+		}
+		s, sel.index = base, n
+	}
+	if s == "" {
+		return sel, fmt.Errorf("empty component selector")
+	}
+	if s == "launcher" || isComponentType(s) {
+		sel.kind = s
+	} else {
+		sel.name = s
+	}
+	return sel, nil
+}
+
+func (sel componentSelector) String() string {
+	s := sel.name
+	if sel.kind != "" {
+		s = sel.kind
+	}
+	if sel.index >= 0 {
+		s += fmt.Sprintf("[%d]", sel.index)
+	}
+	return s
+}
+
+// selectComponent returns the single component matching the selector, with relative class names
+// resolved against pkg.
+func selectComponent(root *XmlElement, pkg string, sel componentSelector) (*XmlElement, error) {
+	var matches []*XmlElement
+	for _, child := range childElement(root, "application").GetChild() {
+		element := child.GetElement()
+		if !isComponentType(element.GetName()) {
+			continue
+		}
+		var match bool
+		switch sel.kind {
+		case "":
+			match = resolveClassName(pkg, componentName(element)) == resolveClassName(pkg, sel.name)
+		case "launcher":
+			match = (element.GetName() == "activity" || element.GetName() == "activity-alias") && isLauncher(element)
+		default:
+			match = element.GetName() == sel.kind
+		}
+		if match {
+			matches = append(matches, element)
+		}
+	}
+	switch {
+	case len(matches) == 0:
+		return nil, withExitCode(exitNotFound, fmt.Errorf("component selector %q doesn't match any component", sel))
+	case sel.index >= len(matches):
+		return nil, withExitCode(exitNotFound, fmt.Errorf("component selector %q is out of range, only %d components match", sel, len(matches)))
+	case sel.index >= 0:
+		return matches[sel.index], nil
+	case len(matches) > 1:
+		return nil, fmt.Errorf("component selector %q matches %d components, add an index like %s[0]", sel, len(matches), sel)
+	}
+	return matches[0], nil
+}
+
+func isComponentType(name string) bool {
+	for _, t := range componentTypes {
+		if name == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isLauncher(component *XmlElement) bool {
+	for _, child := range component.GetChild() {
+		filter := child.GetElement()
+		if filter.GetName() != "intent-filter" {
+			continue
+		}
+		var main, launcher bool
+		for _, entry := range filter.GetChild() {
+			name := findAttr(entry.GetElement(), namespace, "name").GetValue()
+			switch entry.GetElement().GetName() {
+			case "action":
+				main = main || name == "android.intent.action.MAIN"
+			case "category":
+				launcher = launcher || name == "android.intent.category.LAUNCHER"
+			}
+		}
+		if main && launcher {
+			return true
+		}
+	}
+	return false
+}
+
+func componentName(component *XmlElement) string {
+	return findAttr(component, namespace, "name").GetValue()
+}
+
+func packageName(root *XmlElement) string {
+	return findAttr(root, "", "package").GetValue()
+}
+
+// resolveClassName expands relative class names like .MainActivity the way the platform does.
+func resolveClassName(pkg string, name string) string {
+	if strings.HasPrefix(name, ".") {
+		return pkg + name
+	}
+	if !strings.Contains(name, ".") {
+		return pkg + "." + name
+	}
+	return name
+}
+
+// checkPackageName validates a package name the way the platform does when installing an app: at
+// least two dot-separated segments, see checkDottedName.
+func checkPackageName(name string) error {
+	return checkDottedName(name, 2)
+}
+
+// checkDottedName checks that name consists of at least minSegments dot-separated segments, each
+// starting with an ASCII letter followed by ASCII letters, digits or underscores. Besides package
+// names, permission and process names follow the same rules.
+func checkDottedName(name string, minSegments int) error {
+	segments := strings.Split(name, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("%q has an empty segment, check for leading, trailing or double dots", name)
+		}
+		for i, r := range segment {
+			letter := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+			if !letter && (i == 0 || r != '_' && (r < '0' || r > '9')) {
+				return fmt.Errorf("%q: the segment %q has to start with a letter and may only contain letters, digits and underscores", name, segment)
+			}
+		}
+	}
+	if len(segments) < minSegments {
+		return fmt.Errorf("%q needs at least %d dot-separated segments, e.g. com.example", name, minSegments)
+	}
+	return nil
+}
+
+// checkClassName accepts fully qualified class names like com.example.Factory and names relative
+// to the package like .Factory, as the platform resolves them with resolveClassName.
+func checkClassName(name string) error {
+	if name == "" {
+		return fmt.Errorf("the class name is empty")
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(name, "."), ".") {
+		valid := part != ""
+		for i, r := range part {
+			valid = valid && (r == '_' || r == '$' || unicode.IsLetter(r) || i > 0 && unicode.IsDigit(r))
+		}
+		if !valid {
+			return fmt.Errorf("%q is not a valid class name", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+)
+
+// entrySum identifies the uncompressed content of a zip entry.
+type entrySum struct {
+	crc  uint32
+	size uint64
+}
+
+// readEntrySums returns the content sums of all entries of the zip at path, to find the entries a
+// run changed with writeDelta.
+func readEntrySums(path string) (map[string]entrySum, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+	sums := map[string]entrySum{}
+	for _, f := range r.File {
+		sums[f.Name] = entrySum{crc: f.CRC32, size: f.UncompressedSize64}
+	}
+	return sums, nil
+}
+
+// writeDelta writes the entries of the zip at path that are new or differ from before to target,
+// copied raw and in archive order. Removed entries can't be expressed in a zip and are left out.
+func writeDelta(path string, target string, before map[string]entrySum) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed creating file: %w", err)
+	}
+	defer out.Close()
+	offset := &offsetWriter{w: out}
+	zipWriter := zip.NewWriter(offset)
+	count := 0
+	for _, f := range r.File {
+		if sum, ok := before[f.Name]; ok && sum == (entrySum{crc: f.CRC32, size: f.UncompressedSize64}) {
+			continue
+		}
+		if err := copyZipEntry(zipWriter, offset, f, f.FileHeader); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed writing delta: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed writing delta: %w", err)
+	}
+	fmt.Printf("Wrote delta with %d changed entries to %s\n", count, target)
+	return nil
+}
@@ -0,0 +1,88 @@
+package manifest
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// quiet suppresses notes and, when editing, the progress messages, but never warnings and errors.
+var quiet bool
+
+// githubFormat emits warnings and errors as GitHub Actions workflow commands, which show up as
+// annotations in the workflow run.
+var githubFormat bool
+
+// setOutputFormat configures the diagnostics for -format: "text", "github" or "" to use github
+// when running in GitHub Actions.
+func setOutputFormat(format string) error {
+	switch format {
+	case "":
+		githubFormat = os.Getenv("GITHUB_ACTIONS") == "true"
+	case "text":
+		githubFormat = false
+	case "github":
+		githubFormat = true
+	default:
+		return fmt.Errorf("invalid -format %q, expected text or github", format)
+	}
+	if githubFormat {
+		log.SetFlags(0)
+		log.SetOutput(annotationWriter{command: "error"})
+	}
+	return nil
+}
+
+// warnings collects the warnings since the last takeWarnings, for the report.
+var warnings []string
+
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	warnings = append(warnings, msg)
+	printDiagnostic("warning", "Warning: ", msg)
+}
+
+// takeWarnings returns the warnings printed since the last call.
+func takeWarnings() []string {
+	w := warnings
+	warnings = nil
+	return w
+}
+
+func errorf(format string, args ...any) {
+	printDiagnostic("error", "Error: ", fmt.Sprintf(format, args...))
+}
+
+func notef(format string, args ...any) {
+	if quiet {
+		return
+	}
+	printDiagnostic("notice", "Note: ", fmt.Sprintf(format, args...))
+}
+
+// printDiagnostic prints to stderr, so stdout only has the progress messages and the data of the
+// print modes. GitHub Actions picks up workflow commands from both.
+func printDiagnostic(command string, prefix string, msg string) {
+	if githubFormat {
+		fmt.Fprintf(os.Stderr, "::%s::%s\n", command, escapeAnnotation(msg))
+	} else {
+		fmt.Fprintln(os.Stderr, prefix+msg)
+	}
+}
+
+// annotationWriter turns log output, i.e. fatal errors, into workflow commands.
+type annotationWriter struct {
+	command string
+}
+
+func (w annotationWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	fmt.Fprintf(os.Stderr, "::%s::%s\n", w.command, escapeAnnotation(msg))
+	return len(p), nil
+}
+
+// escapeAnnotation escapes the message of a workflow command, which has to fit on one line.
+func escapeAnnotation(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
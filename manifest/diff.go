@@ -0,0 +1,166 @@
+package manifest
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+)
+
+// manifestDiff is one difference found by the diff subcommand. Old is empty for added and New for
+// removed elements and attributes.
+type manifestDiff struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// runDiff implements `androidmanifest-changer diff old new`, which prints the element and
+// attribute level differences between the manifests of two APKs, AABs or proto manifests.
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: androidmanifest-changer diff [flags] OLD NEW")
+		flags.PrintDefaults()
+	}
+	jsonOutput := flags.Bool("json", false, "Print the differences as JSON")
+	flags.StringVar(&aapt2Path, "aapt2", "", "The aapt2 binary to use for binary APKs (default: $AAPT2_PATH, $AAPT2, aapt2 in PATH or in the newest build-tools of $ANDROID_HOME)")
+	flags.BoolVar(&nativeAxml, "native-axml", false, "Decode binary APK manifests with the built-in binary XML codec instead of aapt2 (experimental)")
+	flags.StringVar(&buildToolsVersion, "build-tools", "", "Take aapt2 from this version of the SDK's build-tools, e.g. 34.0.0")
+	flags.StringVar(&tmpDir, "tmpdir", tmpDir, "The directory for the manifests of binary APKs while they're converted")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		fmt.Fprintln(flags.Output(), "Error: diff needs exactly two files to compare.")
+		flags.Usage()
+		exit(exitUsage)
+	}
+	if err := checkTmpDir(); err != nil {
+		fatalUsage("Invalid -tmpdir:", err)
+	}
+	if err := checkBuildTools(); err != nil {
+		fatalUsage("Invalid -build-tools:", err)
+	}
+	removeTempOnInterrupt()
+	resolveAapt2Path()
+	if err := diffManifests(flags.Arg(0), flags.Arg(1), *jsonOutput); err != nil {
+		log.Println(err)
+		exit(exitCode(err))
+	}
+}
+
+func diffManifests(oldPath string, newPath string, asJSON bool) error {
+	oldNode, err := readManifest(oldPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", oldPath, err)
+	}
+	newNode, err := readManifest(newPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", newPath, err)
+	}
+	oldRoot, newRoot := oldNode.GetElement(), newNode.GetElement()
+	diffs := diffElement(oldRoot, newRoot, oldRoot, newRoot, oldRoot.GetName())
+	if asJSON {
+		if diffs == nil {
+			diffs = []manifestDiff{}
+		}
+		out, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed encoding JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for _, d := range diffs {
+		switch d.Kind {
+		case "added":
+			fmt.Printf("+ %s%s\n", d.Path, valueSuffix(d.New))
+		case "removed":
+			fmt.Printf("- %s%s\n", d.Path, valueSuffix(d.Old))
+		default:
+			fmt.Printf("~ %s: %s -> %s\n", d.Path, d.Old, d.New)
+		}
+	}
+	if len(diffs) == 0 {
+		fmt.Println("The manifests are identical")
+	} else {
+		fmt.Printf("%d differences\n", len(diffs))
+	}
+	return nil
+}
+
+func valueSuffix(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "=" + value
+}
+
+// diffElement compares the attributes and children of two matching elements. Attributes are
+// matched by namespace and name, children by diffKey.
+func diffElement(oldRoot, newRoot, oldElement, newElement *XmlElement, path string) []manifestDiff {
+	var diffs []manifestDiff
+	for _, oldAttr := range oldElement.GetAttribute() {
+		attrPath := path + "/@" + qualifiedName(oldRoot, oldAttr.GetNamespaceUri(), oldAttr.GetName())
+		newAttr := findAttr(newElement, oldAttr.GetNamespaceUri(), oldAttr.GetName())
+		if newAttr == nil {
+			diffs = append(diffs, manifestDiff{Kind: "removed", Path: attrPath, Old: attrValue(oldAttr)})
+		} else if attrValue(oldAttr) != attrValue(newAttr) {
+			diffs = append(diffs, manifestDiff{Kind: "changed", Path: attrPath, Old: attrValue(oldAttr), New: attrValue(newAttr)})
+		}
+	}
+	for _, newAttr := range newElement.GetAttribute() {
+		if findAttr(oldElement, newAttr.GetNamespaceUri(), newAttr.GetName()) == nil {
+			attrPath := path + "/@" + qualifiedName(newRoot, newAttr.GetNamespaceUri(), newAttr.GetName())
+			diffs = append(diffs, manifestDiff{Kind: "added", Path: attrPath, New: attrValue(newAttr)})
+		}
+	}
+
+	oldChildren, oldKeys := diffChildren(oldElement)
+	newChildren, newKeys := diffChildren(newElement)
+	for _, key := range oldKeys {
+		if newChild, ok := newChildren[key]; ok {
+			diffs = append(diffs, diffElement(oldRoot, newRoot, oldChildren[key], newChild, path+"/"+key)...)
+		} else {
+			diffs = append(diffs, manifestDiff{Kind: "removed", Path: path + "/" + key})
+		}
+	}
+	for _, key := range newKeys {
+		if _, ok := oldChildren[key]; !ok {
+			diffs = append(diffs, manifestDiff{Kind: "added", Path: path + "/" + key})
+		}
+	}
+	return diffs
+}
+
+// diffChildren returns the child elements by diffKey and the keys in document order.
+func diffChildren(element *XmlElement) (map[string]*XmlElement, []string) {
+	children := map[string]*XmlElement{}
+	var keys []string
+	counts := map[string]int{}
+	for _, child := range element.GetChild() {
+		if child.GetElement() == nil {
+			continue
+		}
+		key := diffKey(child.GetElement())
+		n := counts[key]
+		counts[key]++
+		if n > 0 {
+			key = fmt.Sprintf("%s[%d]", key, n)
+		}
+		children[key] = child.GetElement()
+		keys = append(keys, key)
+	}
+	return children, keys
+}
+
+// diffKey identifies an element among its siblings: by its android:name if it has one, like
+// components, permissions and intent filter actions, so reordering them isn't a difference, and
+// otherwise by its position among the siblings with the same name, like intent filters. There's
+// only one <application>, so a changed application class is an attribute change.
+func diffKey(element *XmlElement) string {
+	if name := componentName(element); name != "" && element.GetName() != "application" {
+		return fmt.Sprintf("%s[%s]", element.GetName(), name)
+	}
+	return element.GetName()
+}
@@ -0,0 +1,131 @@
+package manifest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dumpedElement is the JSON form of an element for -dump -json.
+type dumpedElement struct {
+	Namespace  string            `json:"namespace,omitempty"`
+	Name       string            `json:"name"`
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	Attributes []dumpedAttr      `json:"attributes,omitempty"`
+	Children   []dumpedNode      `json:"children,omitempty"`
+}
+
+type dumpedAttr struct {
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	Value      string `json:"value"`
+	ResourceID string `json:"resourceId,omitempty"`
+}
+
+// dumpedNode is either an element or a text node.
+type dumpedNode struct {
+	*dumpedElement
+	Text *string `json:"text,omitempty"`
+}
+
+// dumpManifest prints the whole manifest for -dump, as text XML or as JSON. Compiled values are
+// printed like -print does, e.g. references without a name as @0x7f010000.
+func dumpManifest(xmlNode *XmlNode, asJSON bool) error {
+	if asJSON {
+		out, err := json.MarshalIndent(dumpElement(xmlNode.GetElement()), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed encoding JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	fmt.Println(`<?xml version="1.0" encoding="utf-8"?>`)
+	writeXMLElement(os.Stdout, xmlNode.GetElement(), map[string]string{}, 0)
+	return nil
+}
+
+func dumpElement(element *XmlElement) *dumpedElement {
+	d := &dumpedElement{Namespace: element.GetNamespaceUri(), Name: element.GetName()}
+	for _, decl := range element.GetNamespaceDeclaration() {
+		if d.Namespaces == nil {
+			d.Namespaces = map[string]string{}
+		}
+		d.Namespaces[decl.GetPrefix()] = decl.GetUri()
+	}
+	for _, attr := range element.GetAttribute() {
+		a := dumpedAttr{Namespace: attr.GetNamespaceUri(), Name: attr.GetName(), Value: attrValue(attr)}
+		if attr.GetResourceId() != 0 {
+			a.ResourceID = fmt.Sprintf("0x%08x", attr.GetResourceId())
+		}
+		d.Attributes = append(d.Attributes, a)
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			d.Children = append(d.Children, dumpedNode{dumpedElement: dumpElement(child.GetElement())})
+		} else {
+			text := child.GetText()
+			d.Children = append(d.Children, dumpedNode{Text: &text})
+		}
+	}
+	return d
+}
+
+// writeXMLElement writes element indented by depth. prefixes maps the namespace URIs declared by
+// the ancestors to their prefix.
+func writeXMLElement(w io.Writer, element *XmlElement, prefixes map[string]string, depth int) {
+	if decls := element.GetNamespaceDeclaration(); len(decls) > 0 {
+		scoped := map[string]string{}
+		for uri, prefix := range prefixes {
+			scoped[uri] = prefix
+		}
+		for _, decl := range decls {
+			scoped[decl.GetUri()] = decl.GetPrefix()
+		}
+		prefixes = scoped
+	}
+	name := func(uri string, local string) string {
+		if uri == "" {
+			return local
+		}
+		if prefix, ok := prefixes[uri]; ok {
+			return prefix + ":" + local
+		}
+		return uri + ":" + local
+	}
+
+	indent := strings.Repeat("    ", depth)
+	fmt.Fprintf(w, "%s<%s", indent, name(element.GetNamespaceUri(), element.GetName()))
+	// A single attribute stays on the element's line, like Android Studio formats manifests.
+	sep := "\n" + indent + "    "
+	if len(element.GetNamespaceDeclaration())+len(element.GetAttribute()) == 1 {
+		sep = " "
+	}
+	for _, decl := range element.GetNamespaceDeclaration() {
+		fmt.Fprintf(w, "%sxmlns:%s=\"%s\"", sep, decl.GetPrefix(), escapeXML(decl.GetUri()))
+	}
+	for _, attr := range element.GetAttribute() {
+		fmt.Fprintf(w, "%s%s=\"%s\"", sep, name(attr.GetNamespaceUri(), attr.GetName()), escapeXML(attrValue(attr)))
+	}
+	if len(element.GetChild()) == 0 {
+		fmt.Fprintln(w, " />")
+		return
+	}
+	fmt.Fprintln(w, ">")
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			writeXMLElement(w, child.GetElement(), prefixes, depth+1)
+		} else if text := strings.TrimSpace(child.GetText()); text != "" {
+			fmt.Fprintf(w, "%s    %s\n", indent, escapeXML(text))
+		}
+	}
+	fmt.Fprintf(w, "%s</%s>\n", indent, name(element.GetNamespaceUri(), element.GetName()))
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,338 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// change describes a single attribute modification or, with the kind removeKind, the removal of an
+// element. Element is a path like manifest/application where repeated siblings are addressed by a
+// zero-based index, e.g. manifest/application/activity[1].
+type change struct {
+	Kind       string  `json:"kind,omitempty"`
+	Element    string  `json:"element"`
+	Namespace  string  `json:"namespace,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	ResourceID uint32  `json:"resourceId,omitempty"`
+	Type       string  `json:"type,omitempty"`
+	Old        *string `json:"old,omitempty"`
+	Value      string  `json:"value"`
+	// The element's path for patches, see patchPath.
+	key string
+}
+
+// removeKind is the kind of a change that removed its element. Old is the element's android:name,
+// if it has one.
+const removeKind = "remove"
+
+// manifestEditor applies edits to a manifest and keeps track of every attribute it changed.
+type manifestEditor struct {
+	root    *XmlElement
+	changes []change
+	// Values longer than this are truncated when printing changes. Zero disables truncation.
+	maxReportLen int
+	// Resolves references by name. Nil if the manifest has no resource table next to it.
+	resources *resourceTable
+	// Set for text XML manifests, in which references by name are kept as they are.
+	keepReferenceNames bool
+	// The requested changes that weren't applied or have no effect, see skipf.
+	skipped []string
+	// The package before the edits. Relative class names in component selectors and element paths
+	// are resolved against it, because they refer to the manifest as it was passed in, even if
+	// e.g. -package or -rename-package changes it first.
+	inputPackage string
+}
+
+func newManifestEditor(root *XmlElement, config *editConfig) *manifestEditor {
+	return &manifestEditor{root: root, maxReportLen: config.maxReportLen, resources: config.resources, keepReferenceNames: config.textXML, inputPackage: packageName(root)}
+}
+
+// record prints and tracks a change of attr. Pass a nil old value for newly added attributes.
+func (e *manifestEditor) record(label string, element *XmlElement, attr *XmlAttribute, old *string) {
+	if old == nil {
+		fmt.Println("Setting", label, "to", e.reportValue(attrValue(attr)))
+	} else {
+		fmt.Println("Changing", label, "from", e.reportValue(*old), "to", e.reportValue(attrValue(attr)))
+	}
+	e.track(element, attr, old)
+}
+
+// skipf warns that a requested change wasn't applied or has no effect, e.g. removing an attribute
+// the element doesn't have. -strict fails the run for them once all edits are done.
+func (e *manifestEditor) skipf(format string, args ...any) {
+	warnf(format, args...)
+	e.skipped = append(e.skipped, fmt.Sprintf(format, args...))
+}
+
+// reportValue shortens long values like JSON blobs or tokens so they don't flood the output.
+func (e *manifestEditor) reportValue(value string) string {
+	if e.maxReportLen <= 0 || utf8.RuneCountInString(value) <= e.maxReportLen {
+		return value
+	}
+	return string([]rune(value)[:e.maxReportLen]) + "..."
+}
+
+// track is like record, but without printing, for callers reporting the change themselves.
+func (e *manifestEditor) track(element *XmlElement, attr *XmlAttribute, old *string) {
+	e.changes = append(e.changes, change{
+		Element:    elementPath(e.root, element),
+		Namespace:  attr.GetNamespaceUri(),
+		Name:       attr.GetName(),
+		ResourceID: attr.GetResourceId(),
+		Type:       compiledType(attr),
+		Old:        old,
+		Value:      attrValue(attr),
+		key:        patchPath(e.root, element),
+	})
+}
+
+// trackRemoval tracks the removal of element, while it's still part of the tree.
+func (e *manifestEditor) trackRemoval(element *XmlElement) {
+	c := change{Kind: removeKind, Element: elementPath(e.root, element), key: patchPath(e.root, element)}
+	if name := componentName(element); name != "" {
+		c.Old = &name
+	}
+	e.changes = append(e.changes, c)
+}
+
+// removeChildren removes the child elements of parent that match and returns them. The removals
+// are tracked before any element is removed, so their paths refer to the tree before the edit.
+func (e *manifestEditor) removeChildren(parent *XmlElement, match func(*XmlElement) bool) []*XmlElement {
+	var removed []*XmlElement
+	for _, child := range parent.GetChild() {
+		if element := child.GetElement(); element != nil && match(element) {
+			e.trackRemoval(element)
+			removed = append(removed, element)
+		}
+	}
+	if removed != nil {
+		parent.Child = slices.DeleteFunc(parent.Child, func(node *XmlNode) bool {
+			return slices.Contains(removed, node.GetElement())
+		})
+	}
+	return removed
+}
+
+// maxStringLen is the longest string value -strict accepts. The platform doesn't define a limit,
+// but values this long are almost certainly a mistake like an expanded file or env dump.
+const maxStringLen = 1024
+
+// checkStrings validates the string values changed so far for -strict: they must be valid UTF-8,
+// free of control characters and at most maxStringLen characters long.
+func (e *manifestEditor) checkStrings() error {
+	for _, c := range e.changes {
+		if c.Type != "string" {
+			continue
+		}
+		label := fmt.Sprintf("%s/@%s", c.Element, qualifiedName(e.root, c.Namespace, c.Name))
+		if !utf8.ValidString(c.Value) {
+			return fmt.Errorf("%s: value %q is not valid UTF-8", label, c.Value)
+		}
+		for i, r := range c.Value {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("%s: value %q contains the control character %U at byte %d", label, c.Value, r, i)
+			}
+		}
+		if n := utf8.RuneCountInString(c.Value); n > maxStringLen {
+			return fmt.Errorf("%s: value is %d characters long, at most %d are allowed", label, n, maxStringLen)
+		}
+	}
+	return nil
+}
+
+func compiledType(attr *XmlAttribute) string {
+	if attr.GetCompiledItem().GetRef() != nil {
+		return "reference"
+	}
+	switch attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+	case *Primitive_IntDecimalValue:
+		return "int"
+	case *Primitive_IntHexadecimalValue:
+		return "hex"
+	case *Primitive_BooleanValue:
+		return "bool"
+	case *Primitive_FloatValue:
+		return "float"
+	}
+	return "string"
+}
+
+// elementPath returns the path of target below root or "" if it isn't part of the tree.
+func elementPath(root *XmlElement, target *XmlElement) string {
+	if root == target {
+		return root.GetName()
+	}
+	counts := map[string]int{}
+	for _, child := range root.GetChild() {
+		element := child.GetElement()
+		if element == nil {
+			continue
+		}
+		index := counts[element.GetName()]
+		counts[element.GetName()]++
+		path := elementPath(element, target)
+		if path == "" {
+			continue
+		}
+		if index > 0 {
+			_, rest, _ := strings.Cut(path, "/")
+			path = fmt.Sprintf("%s[%d]", element.GetName(), index)
+			if rest != "" {
+				path += "/" + rest
+			}
+		}
+		return root.GetName() + "/" + path
+	}
+	return ""
+}
+
+// patchPath is elementPath, but elements with an android:name no sibling of the same name shares
+// are addressed by it, e.g. manifest/uses-permission[android.permission.CAMERA]. Unlike an index,
+// it still refers to the same element after elements before it were added or removed.
+func patchPath(root *XmlElement, target *XmlElement) string {
+	if root == target {
+		return root.GetName()
+	}
+	for _, child := range root.GetChild() {
+		element := child.GetElement()
+		if element == nil {
+			continue
+		}
+		rest := patchPath(element, target)
+		if rest == "" {
+			continue
+		}
+		// rest starts with the plain name of element.
+		rest = rest[len(element.GetName()):]
+		segment := element.GetName()
+		if name := componentName(element); isPathSelector(name) && countNamed(root, element.GetName(), name) == 1 {
+			segment = fmt.Sprintf("%s[%s]", segment, name)
+		} else if index := slices.Index(siblingsNamed(root, element.GetName()), element); index > 0 {
+			segment = fmt.Sprintf("%s[%d]", segment, index)
+		}
+		return root.GetName() + "/" + segment + rest
+	}
+	return ""
+}
+
+// isPathSelector reports whether name can select an element in an element path.
+func isPathSelector(name string) bool {
+	if name == "" || strings.ContainsAny(name, "/[]") {
+		return false
+	}
+	_, err := strconv.Atoi(name)
+	return err != nil
+}
+
+func siblingsNamed(parent *XmlElement, name string) []*XmlElement {
+	var elements []*XmlElement
+	for _, child := range parent.GetChild() {
+		if child.GetElement().GetName() == name {
+			elements = append(elements, child.GetElement())
+		}
+	}
+	return elements
+}
+
+// countNamed returns how many child elements of parent are called name and have the android:name
+// component.
+func countNamed(parent *XmlElement, name string, component string) int {
+	n := 0
+	for _, element := range siblingsNamed(parent, name) {
+		if componentName(element) == component {
+			n++
+		}
+	}
+	return n
+}
+
+// resolveElementPath is the inverse of elementPath. A segment can also pick an element by its
+// android:name instead of its index, e.g. activity[.MainActivity], with relative class names
+// resolved against pkg. With create, a missing last path segment is added as a new element if its
+// index is the next free one.
+func resolveElementPath(root *XmlElement, pkg string, path string, create bool) (*XmlElement, error) {
+	segments := strings.Split(path, "/")
+	if segments[0] != root.GetName() {
+		return nil, fmt.Errorf("element path %q doesn't start with the root element %s", path, root.GetName())
+	}
+	element := root
+	for i, segment := range segments[1:] {
+		name, index, selector := segment, 0, ""
+		if base, rest, ok := strings.Cut(segment, "["); ok {
+			if !strings.HasSuffix(rest, "]") || len(rest) == 1 {
+				return nil, fmt.Errorf("invalid element path segment %q", segment)
+			}
+			rest = strings.TrimSuffix(rest, "]")
+			n, err := strconv.Atoi(rest)
+			if err == nil && n < 0 {
+				return nil, fmt.Errorf("invalid element path segment %q", segment)
+			}
+			if err != nil {
+				selector = resolveClassName(pkg, rest)
+			}
+			name, index = base, n
+		}
+		var matches []*XmlElement
+		for _, child := range element.GetChild() {
+			if child.GetElement().GetName() != name {
+				continue
+			}
+			if selector == "" || resolveClassName(pkg, componentName(child.GetElement())) == selector {
+				matches = append(matches, child.GetElement())
+			}
+		}
+		switch {
+		case index < len(matches):
+			element = matches[index]
+		case create && selector == "" && index == len(matches) && i == len(segments)-2:
+			child := &XmlElement{Name: name}
+			element.Child = append(element.Child, &XmlNode{Node: &XmlNode_Element{Element: child}})
+			element = child
+		default:
+			return nil, withExitCode(exitNotFound, fmt.Errorf("element %q not found", path))
+		}
+	}
+	return element, nil
+}
+
+// parseRemoveElement parses the element path of a -remove-element, like an element path of
+// -set without the attribute.
+func parseRemoveElement(s string) (string, error) {
+	path := strings.Trim(strings.TrimSpace(s), "/")
+	if strings.Contains(path, "/@") || strings.HasPrefix(path, "@") {
+		return "", fmt.Errorf("expected an element path like application/activity[.Ads] but got %q, see -removeAttr for attributes", s)
+	}
+	if path == "" || path == "manifest" {
+		return "", errors.New("the root element can't be removed")
+	}
+	if !strings.HasPrefix(path, "manifest/") {
+		path = "manifest/" + path
+	}
+	return path, nil
+}
+
+// removeElement removes the element at path with its children. A missing element is only a
+// warning, because the goal is already reached.
+func (e *manifestEditor) removeElement(path string) error {
+	element, err := resolveElementPath(e.root, e.inputPackage, path, false)
+	if exitCode(err) == exitNotFound {
+		e.skipf("Not removing %s, the manifest has no such element", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	parent, _ := resolveElementPath(e.root, e.inputPackage, path[:strings.LastIndex(path, "/")], false)
+	label := elementPath(e.root, element)
+	if name := componentName(element); name != "" {
+		label += " (" + name + ")"
+	}
+	e.removeChildren(parent, func(child *XmlElement) bool { return child == element })
+	fmt.Println("Removing", label)
+	return nil
+}
@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"log"
+)
+
+// The exit codes of the failure classes CI scripts may want to tell apart. They're documented in
+// the README, together with timeoutExitCode.
+const (
+	exitFailure = 1
+	// Invalid flags or arguments, including files passed to flags that can't be read.
+	exitUsage = 2
+	// aapt2 is needed for an APK but can't be executed.
+	exitAapt2Missing = 3
+	// The input can't be read or written, or isn't a valid APK or AAB.
+	exitIO = 4
+	// The manifest isn't in aapt2's proto format or can't be decoded.
+	exitParse = 5
+	// An element or attribute an edit refers to doesn't exist.
+	exitNotFound = 6
+	// The input doesn't have the digest -expect-sha256 demands.
+	exitChecksumMismatch = 7
+	// aapt2 ran, but failed converting an APK.
+	exitAapt2Failed = 8
+)
+
+// exitCodeError attaches an exit code to an error without changing its message.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *exitCodeError) Unwrap() error {
+	return e.err
+}
+
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode returns the exit code for err: the code attached with withExitCode, or exitIO
+// for file system and zip errors.
+func exitCode(err error) int {
+	var codeErr *exitCodeError
+	var pathErr *fs.PathError
+	switch {
+	case errors.As(err, &codeErr):
+		return codeErr.code
+	case errors.As(err, &pathErr), errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrChecksum):
+		return exitIO
+	}
+	return exitFailure
+}
+
+// fatalUsage is log.Fatalln for invalid flags and arguments, exiting with exitUsage.
+func fatalUsage(v ...any) {
+	log.Println(v...)
+	exit(exitUsage)
+}
+
+// fatalUsagef is log.Fatalf for invalid flags and arguments, exiting with exitUsage.
+func fatalUsagef(format string, v ...any) {
+	log.Printf(format, v...)
+	exit(exitUsage)
+}
@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestMain runs Main instead of the tests if the test binary is started by runMain.
+func TestMain(m *testing.M) {
+	if os.Getenv("ANDROIDMANIFEST_CHANGER_MAIN") == "1" {
+		os.Args = append([]string{"androidmanifest-changer"}, os.Args[1:]...)
+		Main("test", "")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command line in a subprocess, because Main exits, and returns its exit code.
+func runMain(t *testing.T, args ...string) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "ANDROIDMANIFEST_CHANGER_MAIN=1", "AAPT2_PATH=", "AAPT2=", "ANDROID_HOME=", "ANDROID_SDK_ROOT=")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	t.Logf("%s", out)
+	return cmd.ProcessState.ExitCode()
+}
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	aab := buildZip(t, zipEntry{name: "BundleConfig.pb"}, zipEntry{name: "base/manifest/AndroidManifest.xml", data: string(protoManifest(t, testManifest)), method: zip.Deflate})
+	// A binary manifest, so the APK has to be converted by aapt2.
+	apk := write("app.apk", buildZip(t, zipEntry{name: "AndroidManifest.xml", data: string(binaryXMLHeader), method: zip.Deflate}))
+	failingAapt2 := write("aapt2", []byte("#!/bin/sh\necho 'error: failed to open APK' >&2\nexit 1\n"))
+	if err := os.Chmod(failingAapt2, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args func() []string
+		code int
+	}{
+		{"success", func() []string { return []string{"-versionCode", "2", write("ok.aab", aab)} }, 0},
+		{"unknown flag", func() []string { return []string{"-no-such-flag", write("usage.aab", aab)} }, exitUsage},
+		{"invalid value", func() []string { return []string{"-package", "nodots", write("value.aab", aab)} }, exitUsage},
+		{"missing aapt2", func() []string { return []string{"-versionCode", "2", "-aapt2", filepath.Join(dir, "missing"), apk} }, exitAapt2Missing},
+		{"missing file", func() []string { return []string{"-versionCode", "2", filepath.Join(dir, "missing.aab")} }, exitIO},
+		{"not a zip", func() []string { return []string{"-versionCode", "2", write("text.aab", []byte(testManifest))} }, exitIO},
+		{"unparsable manifest", func() []string { return []string{"-versionCode", "2", write("AndroidManifest.pb", []byte("garbage"))} }, exitParse},
+		{"missing attribute", func() []string {
+			return []string{"-versionNameSuffix", "-beta", write("AndroidManifest.xml", protoManifest(t, `<manifest package="com.example.app"/>`))}
+		}, exitNotFound},
+		{"checksum mismatch", func() []string {
+			return []string{"-versionCode", "2", "-expect-sha256", "0000000000000000000000000000000000000000000000000000000000000000", write("sum.aab", aab)}
+		}, exitChecksumMismatch},
+		{"aapt2 fails", func() []string { return []string{"-versionCode", "2", "-aapt2", failingAapt2, apk} }, exitAapt2Failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.code == exitAapt2Failed && runtime.GOOS == "windows" {
+				t.Skip("the fake aapt2 is a shell script")
+			}
+			if code := runMain(t, tt.args()...); code != tt.code {
+				t.Errorf("exit code %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const glEsVersionAttr = "glEsVersion"
+
+// requiredAttrID is the resource ID of android:required.
+const requiredAttrID = 0x0101028e
+
+// featureSpec is a <uses-feature> of -add-feature or -set-feature-required. required is empty if
+// -add-feature leaves android:required out, which the platform reads as true.
+type featureSpec struct {
+	name     string
+	required string
+}
+
+// parseFeature parses name or name=true|false, e.g. android.hardware.camera=false. With
+// needsRequired, the value can't be left out.
+func parseFeature(s string, needsRequired bool) (featureSpec, error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok && needsRequired {
+		return featureSpec{}, fmt.Errorf("expected feature=true|false but got %q", s)
+	}
+	if err := checkDottedName(name, 2); err != nil {
+		return featureSpec{}, fmt.Errorf("invalid feature name: %w", err)
+	}
+	f := featureSpec{name: name}
+	if ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return featureSpec{}, fmt.Errorf("android:required: %q is not a boolean", value)
+		}
+		f.required = strconv.FormatBool(b)
+	}
+	return f, nil
+}
+
+func findFeature(root *XmlElement, name string) *XmlElement {
+	for _, child := range root.GetChild() {
+		element := child.GetElement()
+		if element.GetName() == "uses-feature" && componentName(element) == name {
+			return element
+		}
+	}
+	return nil
+}
+
+// addFeature adds a <uses-feature> for -add-feature after the last one or else before
+// <application>. If the manifest already declares the feature, only android:required is set, if
+// given.
+func (e *manifestEditor) addFeature(f featureSpec) error {
+	if existing := findFeature(e.root, f.name); existing != nil {
+		if f.required == "" {
+			return nil
+		}
+		return e.setFeatureRequired(f)
+	}
+	element := &XmlElement{Name: "uses-feature"}
+	attr := &XmlAttribute{NamespaceUri: namespace, Name: "name", Value: f.name, ResourceId: nameAttrID}
+	addAttr(element, attr)
+	insertTopLevel(e.root, element)
+	fmt.Println("Adding uses-feature", f.name)
+	e.track(element, attr, nil)
+	if f.required == "" {
+		return nil
+	}
+	return e.setAttr(element, namespace, "required", requiredAttrID, boolAttr, f.required, fmt.Sprintf("android:required of %s", f.name))
+}
+
+// removeFeature removes the <uses-feature> elements declaring the feature. A feature the manifest
+// doesn't declare is only a warning, like for -removePermission.
+func (e *manifestEditor) removeFeature(name string) {
+	removed := e.removeChildren(e.root, func(element *XmlElement) bool {
+		return element.GetName() == "uses-feature" && componentName(element) == name
+	})
+	if len(removed) == 0 {
+		e.skipf("Not removing %s, the manifest doesn't declare it", name)
+		return
+	}
+	fmt.Println("Removing uses-feature", name)
+}
+
+// setFeatureRequired sets android:required on the declared feature, e.g. to false so Play doesn't
+// filter out devices without it. A feature the manifest doesn't declare is a warning, because the
+// other modules of an AAB usually don't.
+func (e *manifestEditor) setFeatureRequired(f featureSpec) error {
+	element := findFeature(e.root, f.name)
+	if element == nil {
+		e.skipf("Not setting android:required of %s, the manifest doesn't declare it. Use -add-feature to add it", f.name)
+		return nil
+	}
+	return e.setAttr(element, namespace, "required", requiredAttrID, boolAttr, f.required, fmt.Sprintf("android:required of %s", f.name))
+}
+
+// parseGlEsVersion encodes a version like 3.1 the way the platform expects it: the major version
+// in the upper and the minor version in the lower 16 bits.
+func parseGlEsVersion(s string) (uint32, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	maj, err1 := strconv.ParseUint(major, 10, 16)
+	mnr, err2 := strconv.ParseUint(minor, 10, 16)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("invalid OpenGL ES version %q, expected MAJOR.MINOR like 3.0", s)
+	}
+	return uint32(maj<<16 | mnr), nil
+}
+
+func formatGlEsVersion(v uint32) string {
+	return fmt.Sprintf("%d.%d (0x%08x)", v>>16, v&0xffff, v)
+}
+
+// setGlEsVersion sets android:glEsVersion on the <uses-feature> declaring it, adding one if needed.
+func (e *manifestEditor) setGlEsVersion(version uint32) {
+	root := e.root
+	value := &Item{Value: &Item_Prim{Prim: &Primitive{OneofValue: &Primitive_IntHexadecimalValue{IntHexadecimalValue: version}}}}
+	for _, child := range root.GetChild() {
+		attr := findAttr(child.GetElement(), namespace, glEsVersionAttr)
+		if child.GetElement().GetName() != "uses-feature" || attr == nil {
+			continue
+		}
+		old := "unknown"
+		switch x := attr.GetCompiledItem().GetPrim().GetOneofValue().(type) {
+		case *Primitive_IntHexadecimalValue:
+			old = formatGlEsVersion(x.IntHexadecimalValue)
+		case *Primitive_IntDecimalValue:
+			old = formatGlEsVersion(uint32(x.IntDecimalValue))
+		}
+		fmt.Println("Changing glEsVersion from", old, "to", formatGlEsVersion(version))
+		oldValue := attrValue(attr)
+		attr.CompiledItem = value
+		if attr.Value != "" {
+			attr.Value = fmt.Sprintf("0x%08x", version)
+		}
+		e.track(child.GetElement(), attr, &oldValue)
+		return
+	}
+
+	feature := &XmlElement{Name: "uses-feature"}
+	attr := &XmlAttribute{
+		NamespaceUri: namespace,
+		Name:         glEsVersionAttr,
+		Value:        fmt.Sprintf("0x%08x", version),
+		ResourceId:   0x01010281,
+		CompiledItem: value,
+	}
+	addAttr(feature, attr)
+	root.Child = append(root.Child, &XmlNode{Node: &XmlNode_Element{Element: feature}})
+	fmt.Println("Adding uses-feature with glEsVersion", formatGlEsVersion(version))
+	e.track(feature, attr, nil)
+}
@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// boolFlag is a boolean flag that remembers whether it was passed at all, so an explicit false can
+// be told apart from the default.
+type boolFlag struct {
+	set   bool
+	value bool
+}
+
+func (f *boolFlag) String() string {
+	if f == nil || !f.set {
+		return ""
+	}
+	return strconv.FormatBool(f.value)
+}
+
+func (f *boolFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	f.set, f.value = true, v
+	return nil
+}
+
+func (f *boolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// listFlag collects the values of a flag that can be passed multiple times.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// isFlagSet reports whether the flag was passed, even if with an empty value.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// applyConfigFile sets the flags listed in a -config file, a JSON object mapping flag names to
+// values, e.g. {"versionCode": 42, "addPermission": ["android.permission.CAMERA"]}. Repeatable
+// flags take an array. Flags passed on the command line take precedence over the file.
+func applyConfigFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var values map[string]any
+	if err := decoder.Decode(&values); err != nil {
+		return fmt.Errorf("failed parsing %s: %w", path, err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := flag.Lookup(name)
+		if f == nil || name == "config" {
+			return fmt.Errorf("unknown flag %q", name)
+		}
+		if isFlagSet(name) {
+			continue
+		}
+		list, isList := values[name].([]any)
+		if _, repeatable := f.Value.(*listFlag); isList && !repeatable {
+			return fmt.Errorf("%s takes a single value, not an array", name)
+		} else if !isList {
+			list = []any{values[name]}
+		}
+		for _, v := range list {
+			var s string
+			switch x := v.(type) {
+			case string:
+				s = x
+			case json.Number:
+				s = x.String()
+			case bool:
+				s = strconv.FormatBool(x)
+			default:
+				return errors.New(name + " must be a string, number or boolean")
+			}
+			if err := f.Value.Set(s); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %w", s, name, err)
+			}
+		}
+	}
+	return nil
+}
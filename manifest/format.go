@@ -0,0 +1,75 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// binaryXMLHeader is the chunk header (RES_XML_TYPE with a header size of 8) every binary XML file starts with.
+var binaryXMLHeader = []byte{0x03, 0x00, 0x08, 0x00}
+
+// parseManifest parses a proto manifest. A leading UTF-8 BOM, e.g. added by an editor or an
+// extraction tool, is ignored. Other formats are detected to give a helpful error.
+func parseManifest(data []byte) (*XmlNode, error) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	switch {
+	case len(data) == 0:
+		return nil, withExitCode(exitParse, errors.New("the manifest is empty"))
+	case bytes.HasPrefix(data, binaryXMLHeader):
+		return nil, withExitCode(exitParse, errors.New("the manifest is in the binary XML format used inside APKs, only aapt2's proto format is supported. Pass the APK instead"))
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")):
+		return nil, withExitCode(exitParse, errors.New("the manifest is plain text XML, only aapt2's proto format is supported. Take it from an AAB or build it with aapt2 link --proto-format"))
+	}
+	xmlNode := &XmlNode{}
+	// A proto XmlNode starts with its element (field 1, length-delimited).
+	if data[0] != 0x0a || proto.Unmarshal(data, xmlNode) != nil || xmlNode.GetElement() == nil {
+		return nil, withExitCode(exitParse, fmt.Errorf("unrecognized manifest format, expected aapt2's proto format but the file starts with % x", data[:min(len(data), 8)]))
+	}
+	return xmlNode, nil
+}
+
+// zipMagic is the signature of a zip's first local file header.
+var zipMagic = []byte("PK\x03\x04")
+
+// checkZip fails with a precise error if the APK or AAB at path isn't a zip archive, before it
+// ends up in aapt2 or archive/zip.
+func checkZip(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed opening file: %w", err)
+	}
+	defer file.Close()
+	head := make([]byte, 8)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed reading file: %w", err)
+	}
+	head = head[:n]
+	if bytes.HasPrefix(head, zipMagic) {
+		return nil
+	}
+	return withExitCode(exitIO, fmt.Errorf("%s: expected a zip archive but got %s", path, describeContent(head)))
+}
+
+// describeContent guesses what kind of file starts with head, for error messages.
+func describeContent(head []byte) string {
+	head = bytes.TrimPrefix(head, utf8BOM)
+	switch {
+	case len(head) == 0:
+		return "an empty file"
+	case bytes.HasPrefix(head, binaryXMLHeader):
+		return "a binary XML file"
+	case bytes.HasPrefix(bytes.TrimSpace(head), []byte("<")):
+		return "a text XML file"
+	case head[0] == 0x0a:
+		return "what looks like a proto manifest"
+	}
+	return fmt.Sprintf("a file starting with % x", head)
+}
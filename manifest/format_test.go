@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	proto := protoManifest(t, testManifest)
+	bom := func(data []byte) []byte {
+		return append(slices.Clone(utf8BOM), data...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{"proto", proto, ""},
+		{"proto with BOM", bom(proto), ""},
+		{"text XML with BOM", bom([]byte(testManifest)), "plain text XML"},
+		{"binary XML with BOM", bom(append(slices.Clone(binaryXMLHeader), 0, 0)), "binary XML format"},
+		{"only a BOM", utf8BOM, "empty"},
+		{"other leading bytes", append([]byte{0, 0}, proto...), "the file starts with 00 00 0a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parseManifest(tt.data)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := packageName(node.GetElement()); got != "com.example.app" {
+					t.Errorf("package = %q, want com.example.app", got)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) || exitCode(err) != exitParse {
+				t.Errorf("got %v (exit code %d), want exit code %d and an error containing %q", err, exitCode(err), exitParse, tt.err)
+			}
+		})
+	}
+}
+
+func TestUpdateFileBOMManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "AndroidManifest.xml")
+	if err := os.WriteFile(path, append(slices.Clone(utf8BOM), protoManifest(t, testManifest)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, written, err := updateFile(path, &editConfig{versionCode: 42}); err != nil || !written {
+		t.Fatalf("got written %v and %v", written, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := manifestAttr(t, data, "", namespace, versionCodeAttr); got != "42" {
+		t.Errorf("versionCode = %q, want 42", got)
+	}
+}
+
+func TestCheckZip(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"proto manifest", protoManifest(t, testManifest), "expected a zip archive but got what looks like a proto manifest"},
+		{"text XML", []byte(testManifest), "expected a zip archive but got a text XML file"},
+		{"binary XML", append(slices.Clone(binaryXMLHeader), 0, 0), "expected a zip archive but got a binary XML file"},
+		{"empty", nil, "expected a zip archive but got an empty file"},
+		{"other", []byte("garbage!"), "expected a zip archive but got a file starting with 67 61 72 62 61 67 65 21"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.apk")
+			if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			// updateFile checks the signature before aapt2 would be needed.
+			_, written, err := updateFile(path, &editConfig{versionCode: 2})
+			if err == nil || written {
+				t.Fatalf("got written %v and %v, want an error", written, err)
+			}
+			if want := path + ": " + tt.want; err.Error() != want {
+				t.Errorf("got %q, want %q", err, want)
+			}
+			if code := exitCode(err); code != exitIO {
+				t.Errorf("exit code %d, want %d", code, exitIO)
+			}
+		})
+	}
+	path := filepath.Join(t.TempDir(), "app.apk")
+	if err := os.WriteFile(path, buildZip(t, zipEntry{name: "AndroidManifest.xml"}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkZip(path); err != nil {
+		t.Errorf("a zip archive failed the check: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+)
+
+// jobResult is the outcome of processing one of several files.
+type jobResult struct {
+	written bool
+	err     error
+	// The file's -report entry, if it was processed by a child process.
+	file *fileReport
+}
+
+// runJobs processes the files with up to jobs child processes of this binary at the same time. The
+// progress messages and diagnostics are printed to the process's stdout and stderr from
+// everywhere, so they can't be kept apart within one process. Each child gets the same flags and a
+// single file, and its output is printed as one block when it's done. The files are independent,
+// and temp files get random names, so they don't collide.
+func runJobs(paths []string, jobs int) []jobResult {
+	results := make([]jobResult, len(paths))
+	var wg sync.WaitGroup
+	var output sync.Mutex
+	slots := make(chan struct{}, jobs)
+	for i, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			out, result := runJob(path)
+			output.Lock()
+			defer output.Unlock()
+			fmt.Println("Processing", path)
+			os.Stdout.Write(out)
+			if result.err != nil {
+				errorf("%s: %v", path, result.err)
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// jobFlags are the flags of the command line, which the children of runJobs get too, except for
+// the ones that only apply to the parent.
+var jobFlags []string
+
+// recordJobFlags sets jobFlags from the parsed command line, before -config adds its values, which
+// the children read themselves. The arguments are rebuilt instead of taken from os.Args, where a
+// -- would turn the child's own flags into file arguments. A repeatable flag is passed once per
+// value, and flags sharing a variable like -o and -output only once.
+func recordJobFlags() {
+	excluded := []string{"jobs", "parallel", "json", "report", "input-list", "recursive", "skip-invalid"}
+	seen := map[flag.Value]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		if slices.Contains(excluded, f.Name) || seen[f.Value] {
+			return
+		}
+		seen[f.Value] = true
+		if list, ok := f.Value.(*listFlag); ok {
+			for _, value := range *list {
+				jobFlags = append(jobFlags, fmt.Sprintf("-%s=%s", f.Name, value))
+			}
+			return
+		}
+		jobFlags = append(jobFlags, fmt.Sprintf("-%s=%s", f.Name, f.Value.String()))
+	})
+}
+
+// runJob processes path in a child process and returns its output. The child prints its -json
+// report to stdout and everything else to stderr.
+func runJob(path string) ([]byte, jobResult) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, jobResult{err: fmt.Errorf("failed finding the executable: %w", err)}
+	}
+	args := append(append([]string{}, jobFlags...), "-jobs=1", "-json=true", "--", path)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, exe, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stderr.Bytes(), jobResult{err: fmt.Errorf("failed with exit code %d", exitErr.ExitCode())}
+		}
+		return stderr.Bytes(), jobResult{err: fmt.Errorf("failed running %s: %w", exe, err)}
+	}
+	var r report
+	if err := json.Unmarshal(stdout.Bytes(), &r); err != nil || len(r.Files) != 1 {
+		return stderr.Bytes(), jobResult{err: fmt.Errorf("failed reading the report of %s", path)}
+	}
+	return stderr.Bytes(), jobResult{written: r.Files[0].Status == "updated", file: &r.Files[0]}
+}
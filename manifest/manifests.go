@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// otherManifests returns the names of the entries besides canonical that are called
+// AndroidManifest.xml in any case, in archive order. In an AAB these are the manifests of the feature modules,
+// in an APK they are usually leftovers of a broken build. It fails if one of the manifests appears
+// more than once, because it would be unclear which of the entries is read.
+func otherManifests(zipPath string, canonical string) ([]string, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+	var names []string
+	count := map[string]int{}
+	for _, f := range r.File {
+		if !isManifestName(f.Name) {
+			continue
+		}
+		if count[f.Name]++; count[f.Name] > 1 {
+			return nil, fmt.Errorf("%s contains more than one entry named %s", zipPath, f.Name)
+		}
+		if f.Name != canonical {
+			names = append(names, f.Name)
+		}
+	}
+	return names, nil
+}
+
+// isManifestName reports whether the entry is called AndroidManifest.xml, ignoring case.
+func isManifestName(name string) bool {
+	return strings.EqualFold(path.Base(name), "AndroidManifest.xml")
+}
+
+// isModuleManifest reports whether the entry name is the manifest of one of the AAB's modules, like
+// feature/manifest/AndroidManifest.xml. These are edited by default, because bundletool rejects
+// bundles whose modules disagree on e.g. the versionCode.
+func isModuleManifest(zipPath string, name string) bool {
+	parts := strings.Split(name, "/")
+	return strings.HasSuffix(zipPath, ".aab") && len(parts) == 3 && parts[1] == "manifest" && isManifestName(name)
+}
+
+// manifestEntryName returns the actual name of the manifest entry name in the zip, which can differ
+// in case or path (see findFile), so the entry keeps its name when the zip is rewritten.
+func manifestEntryName(zipPath string, name string) (string, error) {
+	r, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return "", fmt.Errorf("failed opening zip for reading: %w", err)
+	}
+	defer r.Close()
+	f := findFile(&r.Reader, name)
+	if f == nil {
+		var candidates []string
+		for _, f := range r.File {
+			if isManifestName(f.Name) {
+				candidates = append(candidates, f.Name)
+			}
+		}
+		if len(candidates) > 0 {
+			return "", withExitCode(exitIO, fmt.Errorf("%s has no %s entry, pass -manifestPath with one of %s", zipPath, name, strings.Join(candidates, ", ")))
+		}
+		return "", withExitCode(exitIO, fmt.Errorf("%s has no %s entry", zipPath, name))
+	}
+	if strings.EqualFold(f.Name, name) && f.Name != name {
+		notef("Editing %s as %s", f.Name, name)
+	} else if f.Name != name {
+		notef("Editing %s, the archive has no %s", f.Name, name)
+	}
+	return f.Name, nil
+}
+
+// updateManifestEntry applies the edits to the manifest entry name of the zip and returns the new
+// content, or nil if the entry was skipped or is unchanged. Entries that aren't proto manifests
+// (e.g. binary XML that aapt2 copied as it was) are skipped with a warning.
+func updateManifestEntry(zipPath string, name string, config *editConfig) ([]byte, error) {
+	data, err := readFromZip(zipPath, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseManifest(data); err != nil {
+		warnf("Skipping %s: %v", name, err)
+		return nil, nil
+	}
+	fmt.Println("Editing", name)
+	// The patch and the provenance only describe the canonical manifest.
+	entryConfig := *config
+	entryConfig.emitPatch = ""
+	entryConfig.secondary = true
+	entryConfig.resources = &resourceTable{zipPath: zipPath, name: resourcesPath(name), fallback: config.resources}
+	_, out, err := editManifest(data, &entryConfig)
+	if err != nil || bytes.Equal(data, out) {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,487 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// mergedSingletons are the elements a manifest normally has only once. The overlay's copy is merged
+// into the target's instead of being added next to it.
+var mergedSingletons = map[string]bool{
+	"application":      true,
+	"queries":          true,
+	"supports-screens": true,
+	"uses-sdk":         true,
+}
+
+// toolsNamespace is the namespace of the manifest merger's markers like tools:node, which -merge
+// interprets instead of copying them.
+const toolsNamespace = "http://schemas.android.com/tools"
+
+// overlayAttrs are the resource IDs and types of common android attributes that text XML overlays
+// use but the tool doesn't edit on its own, e.g. android:name. Attributes from proto overlays
+// already carry their ID.
+var overlayAttrs = map[string]attrInfo{
+	"theme":           {0x01010000, refAttr, ""},
+	"icon":            {0x01010002, refAttr, ""},
+	"name":            {0x01010003, stringAttr, ""},
+	"permission":      {0x01010006, stringAttr, ""},
+	"readPermission":  {0x01010007, stringAttr, ""},
+	"writePermission": {0x01010008, stringAttr, ""},
+	"process":         {0x01010011, stringAttr, ""},
+	"authorities":     {0x01010018, stringAttr, ""},
+	"priority":        {0x0101001c, intAttr, ""},
+	"description":     {0x01010020, untypedAttr, ""},
+	"value":           {0x01010024, untypedAttr, ""},
+	"resource":        {0x01010025, refAttr, ""},
+	"mimeType":        {0x01010026, stringAttr, ""},
+	"scheme":          {0x01010027, stringAttr, ""},
+	"host":            {0x01010028, stringAttr, ""},
+	"port":            {0x01010029, stringAttr, ""},
+	"path":            {0x0101002a, stringAttr, ""},
+	"pathPrefix":      {0x0101002b, stringAttr, ""},
+	"pathPattern":     {0x0101002c, stringAttr, ""},
+	"required":        {0x0101028e, boolAttr, ""},
+}
+
+// readOverlay reads a -merge overlay, either a proto manifest or a text XML manifest.
+func readOverlay(path string) (*XmlElement, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading file: %w", err)
+	}
+	var overlay *XmlElement
+	if bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM)), []byte("<")) {
+		overlay, err = parseTextManifest(bytes.TrimPrefix(data, utf8BOM))
+	} else {
+		var xmlNode *XmlNode
+		xmlNode, err = parseManifest(data)
+		overlay = xmlNode.GetElement()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if overlay.GetName() != "manifest" || overlay.GetNamespaceUri() != "" {
+		return nil, fmt.Errorf("failed to parse %s: expected a <manifest> root element but got <%s>", path, overlay.GetName())
+	}
+	return overlay, nil
+}
+
+// parseTextManifest converts a text XML manifest to the proto structure. Values of android
+// attributes are compiled like aapt2 would, as far as their type is known. Text content is dropped,
+// manifests don't have any.
+func parseTextManifest(data []byte) (*XmlElement, error) {
+	xmlNode, err := decodeTextManifest(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return xmlNode.GetElement(), nil
+}
+
+// decodeTextManifest is parseTextManifest. If spans isn't nil, it gets where each element is in data
+// by the source position of its node. The root node has none, a proto manifest starts with its
+// element, so the root element is at the zero textPos.
+func decodeTextManifest(data []byte, spans map[textPos]*textSpan) (*XmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	root := &XmlNode{}
+	var stack []*XmlElement
+	var open []*textSpan
+	for {
+		// Tokens are contiguous, so the offset before reading one is where it starts.
+		offset := int(decoder.InputOffset())
+		line, column := decoder.InputPos()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			element := &XmlElement{NamespaceUri: t.Name.Space, Name: t.Name.Local}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					element.NamespaceDeclaration = append(element.NamespaceDeclaration, &XmlNamespace{Prefix: a.Name.Local, Uri: a.Value})
+					continue
+				}
+				if a.Name.Space == "" && a.Name.Local == "xmlns" {
+					continue
+				}
+				attr, err := overlayAttr(a)
+				if err != nil {
+					return nil, fmt.Errorf("<%s>: %w", t.Name.Local, err)
+				}
+				addAttr(element, attr)
+			}
+			node := root
+			if len(stack) > 0 {
+				node = &XmlNode{}
+				parent := stack[len(stack)-1]
+				parent.Child = append(parent.Child, node)
+			}
+			node.Node = &XmlNode_Element{Element: element}
+			stack = append(stack, element)
+			if spans != nil {
+				span := &textSpan{element: element, leading: offset, start: offset, startEnd: int(decoder.InputOffset())}
+				span.childrenEnd = span.startEnd
+				pos := textPos{}
+				if len(open) > 0 {
+					node.Source = &SourcePosition{LineNumber: uint32(line), ColumnNumber: uint32(column)}
+					pos = textPos{node.Source.GetLineNumber(), node.Source.GetColumnNumber()}
+					parent := open[len(open)-1]
+					span.parent, span.leading = parent, parent.childrenEnd
+					parent.children = append(parent.children, span)
+				}
+				spans[pos] = span
+				open = append(open, span)
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if spans != nil {
+				span := open[len(open)-1]
+				span.end, span.endEnd = offset, int(decoder.InputOffset())
+				open = open[:len(open)-1]
+				if len(open) > 0 {
+					open[len(open)-1].childrenEnd = span.endEnd
+				}
+			}
+		}
+	}
+	if root.GetElement() == nil {
+		return nil, errors.New("the file has no root element")
+	}
+	return root, nil
+}
+
+// overlayAttr converts a text XML attribute. encoding/xml leaves undeclared prefixes as they are,
+// so android: also works without the xmlns:android declaration.
+func overlayAttr(a xml.Attr) (*XmlAttribute, error) {
+	attr := &XmlAttribute{NamespaceUri: a.Name.Space, Name: a.Name.Local}
+	if attr.NamespaceUri == "android" {
+		attr.NamespaceUri = namespace
+	}
+	label := qualifiedName(nil, attr.NamespaceUri, attr.Name)
+	typ := stringAttr
+	if attr.NamespaceUri == namespace {
+		info, ok := androidAttrs[attr.Name]
+		if !ok {
+			info, ok = overlayAttrs[attr.Name]
+		}
+		attr.ResourceId, typ = info.id, info.typ
+		if attr.ResourceId == 0 {
+			warnf("%s has no known resource ID. The platform ignores it when it's added by -merge.", label)
+		}
+		if typ == untypedAttr {
+			typ = guessAttrType(attr.Name, a.Value)
+		}
+	}
+	if err := setAttrValue(attr, typ, a.Value); err != nil {
+		return nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return attr, nil
+}
+
+// guessAttrType picks the type of attributes that accept several formats: references start with
+// @ and <meta-data android:value> also takes booleans and numbers, like aapt2 compiles them.
+func guessAttrType(name string, value string) attrType {
+	if strings.HasPrefix(value, "@") {
+		return refAttr
+	}
+	if name == "value" {
+		if value == "true" || value == "false" {
+			return boolAttr
+		}
+		if _, err := strconv.ParseInt(value, 10, 32); err == nil {
+			return intAttr
+		}
+		if _, err := strconv.ParseFloat(value, 32); err == nil {
+			return floatAttr
+		}
+	}
+	return stringAttr
+}
+
+// merge overlays the given <manifest> element onto the edited manifest, see the README for the rules.
+func (e *manifestEditor) merge(overlay *XmlElement) {
+	for _, decl := range overlay.GetNamespaceDeclaration() {
+		if decl.GetUri() != toolsNamespace {
+			e.mergeNamespace(decl)
+		}
+	}
+	if attr := findAttr(overlay, "", "package"); attr != nil && attr.GetValue() != packageName(e.root) {
+		warnf("Ignoring the overlay's package %s, -merge never changes the package name", attr.GetValue())
+	}
+	e.mergeElement(e.root, overlay)
+}
+
+func (e *manifestEditor) mergeNamespace(decl *XmlNamespace) {
+	for _, existing := range e.root.GetNamespaceDeclaration() {
+		if existing.GetUri() == decl.GetUri() {
+			return
+		}
+		if existing.GetPrefix() == decl.GetPrefix() {
+			e.skipf("Not declaring xmlns:%s=%s, the prefix is already bound to %s", decl.GetPrefix(), decl.GetUri(), existing.GetUri())
+			return
+		}
+	}
+	e.root.NamespaceDeclaration = append(e.root.NamespaceDeclaration, &XmlNamespace{Prefix: decl.GetPrefix(), Uri: decl.GetUri()})
+	fmt.Printf("Adding namespace declaration xmlns:%s=%s\n", decl.GetPrefix(), decl.GetUri())
+}
+
+// mergeElement merges the attributes and children of overlay into target.
+func (e *manifestEditor) mergeElement(target *XmlElement, overlay *XmlElement) {
+	for _, attr := range overlay.GetAttribute() {
+		if target == e.root && attr.GetNamespaceUri() == "" && attr.GetName() == "package" || isToolsAttr(attr) {
+			continue
+		}
+		e.mergeAttr(target, attr)
+	}
+	if names := toolsAttr(overlay, "remove"); names != "" {
+		e.removeMarkedAttrs(target, names)
+	}
+	for _, node := range overlay.GetChild() {
+		child := node.GetElement()
+		if child == nil {
+			continue
+		}
+		switch marker := toolsAttr(child, "node"); marker {
+		case "", "merge":
+		case "remove", "removeAll":
+			e.removeMarked(target, child, marker == "removeAll")
+			continue
+		case "replace":
+			if i := e.matchingChild(target, child); i >= 0 {
+				target.Child[i] = &XmlNode{Node: &XmlNode_Element{Element: cleanClone(child)}}
+				e.resolveReferences(target.Child[i].GetElement())
+				if name := componentName(child); name != "" {
+					fmt.Printf("Replacing %s (%s)\n", elementPath(e.root, target.Child[i].GetElement()), name)
+				} else {
+					fmt.Println("Replacing", elementPath(e.root, target.Child[i].GetElement()))
+				}
+			} else {
+				e.addElement(target, child)
+			}
+			continue
+		default:
+			warnf("Ignoring tools:node=\"%s\" of <%s>, -merge only supports merge, replace, remove and removeAll", marker, child.GetName())
+		}
+		if mergedSingletons[child.GetName()] && child.GetNamespaceUri() == "" {
+			if existing := childElement(target, child.GetName()); existing != nil {
+				e.mergeElement(existing, child)
+				continue
+			}
+			e.addElement(target, child)
+			continue
+		}
+		name := componentName(child)
+		if name == "" {
+			if !hasSameChild(target, child) {
+				e.addElement(target, child)
+			}
+			continue
+		}
+		if i := e.findNamedChild(target, child.GetName(), name); i >= 0 {
+			if !sameElement(target.Child[i].GetElement(), child) {
+				target.Child[i] = &XmlNode{Node: &XmlNode_Element{Element: cleanClone(child)}}
+				e.resolveReferences(target.Child[i].GetElement())
+				fmt.Printf("Replacing %s (%s)\n", elementPath(e.root, target.Child[i].GetElement()), name)
+			}
+			continue
+		}
+		e.addElement(target, child)
+	}
+}
+
+// matchingChild returns the index of target's child that the overlay's child element refers to, or
+// -1: the element of a singleton like <application>, the element with the same android:name, or
+// else the first element of the same name.
+func (e *manifestEditor) matchingChild(target *XmlElement, child *XmlElement) int {
+	if name := componentName(child); name != "" && !mergedSingletons[child.GetName()] {
+		return e.findNamedChild(target, child.GetName(), name)
+	}
+	for i, node := range target.GetChild() {
+		if node.GetElement().GetName() == child.GetName() && node.GetElement().GetNamespaceUri() == child.GetNamespaceUri() {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeMarked removes the element of target an overlay element with tools:node="remove" refers
+// to, or with removeAll every element called like it, e.g. to drop a permission of a prebuilt
+// bundle without rebuilding it.
+func (e *manifestEditor) removeMarked(target *XmlElement, child *XmlElement, all bool) {
+	label := elementPath(e.root, target) + "/" + child.GetName()
+	if name := componentName(child); name != "" && !all {
+		label += " (" + name + ")"
+	}
+	removed := 0
+	for {
+		i := e.matchingChild(target, child)
+		if all {
+			i = slices.IndexFunc(target.GetChild(), func(node *XmlNode) bool {
+				return node.GetElement().GetName() == child.GetName() && node.GetElement().GetNamespaceUri() == child.GetNamespaceUri()
+			})
+		}
+		if i < 0 {
+			break
+		}
+		e.trackRemoval(target.Child[i].GetElement())
+		target.Child = slices.Delete(target.Child, i, i+1)
+		removed++
+		if !all {
+			break
+		}
+	}
+	if removed == 0 {
+		e.skipf("Not removing %s, the manifest doesn't have it", label)
+		return
+	}
+	fmt.Println("Removing", label)
+}
+
+// removeMarkedAttrs removes the attributes listed by tools:remove, e.g. "android:maxSdkVersion".
+func (e *manifestEditor) removeMarkedAttrs(target *XmlElement, names string) {
+	for _, name := range strings.Split(names, ",") {
+		prefix, local, ok := strings.Cut(strings.TrimSpace(name), ":")
+		if !ok {
+			prefix, local = "", prefix
+		}
+		uri, err := namespaceURI(e.root, prefix)
+		if err != nil {
+			e.skipf("Not removing %s of tools:remove: %v", name, err)
+			continue
+		}
+		e.removeAttr(target, uri, local, fmt.Sprintf("%s/@%s", elementPath(e.root, target), qualifiedName(e.root, uri, local)))
+	}
+}
+
+// isToolsAttr reports whether attr is a manifest merger marker. Text overlays that don't declare
+// xmlns:tools keep the plain prefix.
+func isToolsAttr(attr *XmlAttribute) bool {
+	return attr.GetNamespaceUri() == toolsNamespace || attr.GetNamespaceUri() == "tools"
+}
+
+// toolsAttr returns the value of the marker tools:name of element, or "".
+func toolsAttr(element *XmlElement, name string) string {
+	for _, attr := range element.GetAttribute() {
+		if isToolsAttr(attr) && attr.GetName() == name {
+			return attrValue(attr)
+		}
+	}
+	return ""
+}
+
+func (e *manifestEditor) mergeAttr(target *XmlElement, attr *XmlAttribute) {
+	label := fmt.Sprintf("%s/@%s", elementPath(e.root, target), qualifiedName(e.root, attr.GetNamespaceUri(), attr.GetName()))
+	merged := cleanAttr(attr)
+	e.resolveReference(merged, label)
+	for i, existing := range target.GetAttribute() {
+		if existing.GetNamespaceUri() != attr.GetNamespaceUri() || existing.GetName() != attr.GetName() {
+			continue
+		}
+		if sameAttr(existing, merged) {
+			return
+		}
+		old := attrValue(existing)
+		if merged.GetResourceId() == 0 {
+			merged.ResourceId = existing.GetResourceId()
+		}
+		target.Attribute[i] = merged
+		e.record(label, target, merged, &old)
+		return
+	}
+	addAttr(target, merged)
+	e.record(label, target, merged, nil)
+}
+
+func (e *manifestEditor) addElement(target *XmlElement, element *XmlElement) {
+	added := cleanClone(element)
+	target.Child = append(target.Child, &XmlNode{Node: &XmlNode_Element{Element: added}})
+	e.resolveReferences(added)
+	if name := componentName(added); name != "" {
+		fmt.Printf("Adding %s (%s)\n", elementPath(e.root, added), name)
+	} else {
+		fmt.Println("Adding", elementPath(e.root, added))
+	}
+}
+
+// findNamedChild returns the index of target's child with the given element and android:name, or
+// -1. Relative class names of components are resolved against the target's package.
+func (e *manifestEditor) findNamedChild(target *XmlElement, element string, name string) int {
+	pkg := packageName(e.root)
+	if isComponentType(element) {
+		name = resolveClassName(pkg, name)
+	}
+	for i, node := range target.GetChild() {
+		child := node.GetElement()
+		if child.GetName() != element || child.GetNamespaceUri() != "" {
+			continue
+		}
+		childName := componentName(child)
+		if isComponentType(element) {
+			childName = resolveClassName(pkg, childName)
+		}
+		if childName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasSameChild(target *XmlElement, element *XmlElement) bool {
+	for _, node := range target.GetChild() {
+		if node.GetElement() != nil && sameElement(node.GetElement(), element) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanClone returns a deep copy of element without the source positions, which refer to the
+// overlay file, and without manifest merger markers.
+func cleanClone(element *XmlElement) *XmlElement {
+	clone := proto.Clone(element).(*XmlElement)
+	cleanElement(clone)
+	return clone
+}
+
+func cleanElement(element *XmlElement) {
+	for _, decl := range element.GetNamespaceDeclaration() {
+		decl.Source = nil
+	}
+	element.Attribute = slices.DeleteFunc(element.Attribute, isToolsAttr)
+	for _, attr := range element.GetAttribute() {
+		attr.Source = nil
+	}
+	for _, child := range element.GetChild() {
+		child.Source = nil
+		if child.GetElement() != nil {
+			cleanElement(child.GetElement())
+		}
+	}
+}
+
+func sameElement(a *XmlElement, b *XmlElement) bool {
+	return proto.Equal(cleanClone(a), cleanClone(b))
+}
+
+func sameAttr(a *XmlAttribute, b *XmlAttribute) bool {
+	return proto.Equal(cleanAttr(a), cleanAttr(b))
+}
+
+func cleanAttr(attr *XmlAttribute) *XmlAttribute {
+	clone := proto.Clone(attr).(*XmlAttribute)
+	clone.Source = nil
+	return clone
+}
@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const mergeTestOverlay = `<manifest xmlns:android="http://schemas.android.com/apk/res/android" xmlns:tools="http://schemas.android.com/tools" package="com.example.app">
+  <uses-permission android:name="android.permission.CAMERA"/>
+  <uses-permission android:name="android.permission.READ_PHONE_STATE" tools:node="remove"/>
+  <application android:label="Merged" android:allowBackup="false">
+    <activity android:name=".AdActivity" android:exported="false"/>
+    <meta-data android:name="com.example.flavor" android:value="pro"/>
+  </application>
+</manifest>`
+
+func TestMergeRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	textPath := filepath.Join(dir, "overlay.xml")
+	if err := os.WriteFile(textPath, []byte(mergeTestOverlay), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	protoPath := filepath.Join(dir, "overlay.pb")
+	if err := os.WriteFile(protoPath, protoManifest(t, mergeTestOverlay), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	merge := func(t *testing.T, manifest []byte, overlayPath string) []byte {
+		t.Helper()
+		overlay, err := readOverlay(overlayPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, out, err := editManifest(manifest, &editConfig{merge: overlay})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	merged := merge(t, protoManifest(t, patchTestManifest), textPath)
+	text := manifestXML(t, merged)
+	for _, want := range []string{
+		`android:name="android.permission.CAMERA"`,
+		`android:label="Merged"`,
+		`android:allowBackup="false"`,
+		`android:name="com.example.flavor"`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("the merged manifest lacks %s:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "READ_PHONE_STATE") || strings.Contains(text, "tools:") {
+		t.Errorf("the merged manifest still has the removed permission or a tools marker:\n%s", text)
+	}
+	if got, _ := manifestAttr(t, merged, "application", namespace, "label"); got != "Merged" {
+		t.Errorf("application label %q, want Merged", got)
+	}
+	ad := childElement(mustParseManifest(t, merged), "application").GetChild()[1].GetElement()
+	if componentName(ad) != ".AdActivity" || findAttr(ad, namespace, "exported").GetValue() != "false" {
+		t.Errorf("the AdActivity wasn't replaced by the overlay's:\n%s", text)
+	}
+
+	if again := merge(t, merged, textPath); !bytes.Equal(again, merged) {
+		t.Errorf("merging the overlay again changed the manifest to\n%s\nwant\n%s", manifestXML(t, again), text)
+	}
+	if proto := merge(t, protoManifest(t, patchTestManifest), protoPath); !bytes.Equal(proto, merged) {
+		t.Errorf("merging the proto overlay gave\n%s\nwant\n%s", manifestXML(t, proto), text)
+	}
+}
@@ -0,0 +1,57 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// valueAttrID is the resource ID of android:value.
+const valueAttrID = 0x01010024
+
+// metaData is a -meta-data assignment of a <meta-data> below <application>.
+type metaData struct {
+	name  string
+	value string
+}
+
+// parseMetaData parses "name=value". The value may be empty, but the name may not.
+func parseMetaData(s string) (metaData, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return metaData{}, fmt.Errorf("expected name=value but got %q", s)
+	}
+	return metaData{name: name, value: value}, nil
+}
+
+// setMetaData sets android:value of the <meta-data> with the given android:name, adding the
+// element at the end of <application> if it doesn't exist yet. The value is compiled like aapt2
+// does, so true, 42 and 1.5 become a boolean, an integer and a float. An android:resource the
+// entry had before is removed, because the platform prefers it over the value.
+func (e *manifestEditor) setMetaData(m metaData) error {
+	application := childElementOrCreate(e.root, "application")
+	var element *XmlElement
+	for _, child := range application.GetChild() {
+		if child.GetElement().GetName() == "meta-data" && componentName(child.GetElement()) == m.name {
+			element = child.GetElement()
+			break
+		}
+	}
+	label := fmt.Sprintf("meta-data %s", m.name)
+	if element == nil {
+		element = &XmlElement{Name: "meta-data"}
+		attr := &XmlAttribute{
+			NamespaceUri: namespace,
+			Name:         "name",
+			Value:        m.name,
+			ResourceId:   nameAttrID,
+		}
+		addAttr(element, attr)
+		application.Child = append(application.Child, &XmlNode{Node: &XmlNode_Element{Element: element}})
+		fmt.Println("Adding", label)
+		e.track(element, attr, nil)
+	} else if findAttr(element, namespace, "resource") != nil {
+		e.removeAttr(element, namespace, "resource", label+" android:resource")
+	}
+	return e.setAttr(element, namespace, "value", valueAttrID, guessAttrType("value", m.value), m.value, label)
+}
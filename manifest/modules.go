@@ -0,0 +1,63 @@
+package manifest
+
+import (
+	"archive/zip"
+	"fmt"
+	"strings"
+)
+
+// moduleRename renames a module directory of an AAB, e.g. base/ to app/.
+type moduleRename struct {
+	old string
+	new string
+}
+
+// Top-level AAB directories that don't belong to a module.
+var bundleDirs = []string{"BUNDLE-METADATA", "META-INF"}
+
+func parseModuleRename(s string) (*moduleRename, error) {
+	old, new, ok := strings.Cut(s, "=")
+	if !ok {
+		return nil, fmt.Errorf("expected old=new but got %q", s)
+	}
+	for _, name := range []string{old, new} {
+		if name == "" || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+			return nil, fmt.Errorf("invalid module name %q", name)
+		}
+		for _, dir := range bundleDirs {
+			if name == dir {
+				return nil, fmt.Errorf("%s is not a module", name)
+			}
+		}
+	}
+	if old == new {
+		return nil, fmt.Errorf("module %s would be renamed to itself", old)
+	}
+	return &moduleRename{old: old, new: new}, nil
+}
+
+// apply returns the entry name after the rename. A nil rename leaves all names unchanged.
+func (r *moduleRename) apply(name string) string {
+	if r == nil {
+		return name
+	}
+	if rest, ok := strings.CutPrefix(name, r.old+"/"); ok {
+		return r.new + "/" + rest
+	}
+	return name
+}
+
+// check makes sure the old module exists in the bundle and the new name isn't taken yet.
+func (r *moduleRename) check(reader *zip.Reader) error {
+	var found bool
+	for _, file := range reader.File {
+		if strings.HasPrefix(file.Name, r.new+"/") {
+			return fmt.Errorf("can't rename module %s to %s, the bundle already contains %s", r.old, r.new, file.Name)
+		}
+		found = found || strings.HasPrefix(file.Name, r.old+"/")
+	}
+	if !found {
+		return fmt.Errorf("the bundle doesn't contain a module %s", r.old)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// changeCategories are the names -only accepts, each gating a part of the editConfig.
+var changeCategories = []string{
+	"versionCode",
+	"versionName",
+	"package",
+	"glEsVersion",
+	"permissions",
+	"components",
+	"features",
+	"metaData",
+	"appLinks",
+	"queries",
+	"strings",
+	"placeholders",
+	"attributes",
+	"elements",
+	"merge",
+	"patch",
+	"scripts",
+	"bundletoolVersion",
+	"bundleConfig",
+	"renameModule",
+}
+
+// parseOnly parses the comma-separated -only list.
+func parseOnly(s string) (map[string]bool, error) {
+	only := map[string]bool{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, category := range changeCategories {
+			known = known || name == category
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown change category %q, expected one of %s", name, strings.Join(changeCategories, ", "))
+		}
+		only[name] = true
+	}
+	return only, nil
+}
+
+// restrict drops every configured change whose category isn't in only.
+func (c *editConfig) restrict(only map[string]bool) {
+	configured := map[string]bool{
+		"versionCode":       c.versionCode > 0 || c.versionCodeIncrement > 0,
+		"versionName":       c.versionName != "" || c.versionNamePattern != nil || c.versionNameTemplate != nil || c.versionNameSuffix != "",
+		"package":           c.packageName != "",
+		"glEsVersion":       c.glEsVersion != 0,
+		"permissions":       len(c.addPermissions) > 0 || len(c.removePermissions) > 0 || len(c.stripPermissions) > 0,
+		"components":        len(c.stripComponents) > 0,
+		"features":          len(c.addFeatures) > 0 || len(c.removeFeatures) > 0 || len(c.featureRequired) > 0,
+		"metaData":          len(c.metaData) > 0,
+		"appLinks":          len(c.appLinks) > 0,
+		"queries":           len(c.queryPackages) > 0 || len(c.queryIntents) > 0,
+		"strings":           len(c.stringSets) > 0 || len(c.labelLocales) > 0,
+		"placeholders":      c.placeholders != nil,
+		"attributes":        len(c.attrSets) > 0,
+		"elements":          len(c.removeElements) > 0,
+		"merge":             c.merge != nil,
+		"patch":             len(c.patch) > 0,
+		"scripts":           len(c.transformers) > 0,
+		"bundletoolVersion": c.bundletoolVersion != "",
+		"bundleConfig":      c.uncompressNativeLibs != nil || len(c.splitDimensions) > 0,
+		"renameModule":      c.renameModule != nil,
+	}
+	for _, category := range changeCategories {
+		if only[category] || !configured[category] {
+			continue
+		}
+		notef("Skipping the %s changes, they aren't listed in -only", category)
+		switch category {
+		case "versionCode":
+			c.versionCode, c.versionCodeIncrement = 0, 0
+		case "versionName":
+			c.versionName, c.versionNamePattern, c.versionNameTemplate, c.versionNameSuffix = "", nil, nil, ""
+		case "package":
+			c.packageName, c.packageRename = "", nil
+		case "glEsVersion":
+			c.glEsVersion = 0
+		case "permissions":
+			c.addPermissions, c.removePermissions, c.stripPermissions = nil, nil, nil
+		case "components":
+			c.stripComponents = nil
+		case "features":
+			c.addFeatures, c.removeFeatures, c.featureRequired = nil, nil, nil
+		case "metaData":
+			c.metaData = nil
+		case "appLinks":
+			c.appLinks = nil
+		case "queries":
+			c.queryPackages, c.queryIntents = nil, nil
+		case "strings":
+			c.stringSets, c.labelLocales = nil, nil
+		case "placeholders":
+			c.placeholders = nil
+		case "attributes":
+			c.attrSets = nil
+		case "elements":
+			c.removeElements = nil
+		case "merge":
+			c.merge = nil
+		case "patch":
+			c.patch = nil
+		case "scripts":
+			c.transformers = nil
+		case "bundletoolVersion":
+			c.bundletoolVersion = ""
+		case "bundleConfig":
+			c.uncompressNativeLibs, c.splitDimensions = nil, nil
+		case "renameModule":
+			c.renameModule = nil
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package manifest
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// packageRename is a -rename-package change of the package name, which also updates the names
+// that depend on it.
+type packageRename struct {
+	old string
+	new string
+}
+
+func parsePackageRename(s string) (packageRename, error) {
+	oldName, newName, ok := strings.Cut(s, "=")
+	if !ok {
+		return packageRename{}, fmt.Errorf("expected old=new but got %q", s)
+	}
+	r := packageRename{old: strings.TrimSpace(oldName), new: strings.TrimSpace(newName)}
+	for _, name := range []string{r.old, r.new} {
+		if err := checkPackageName(name); err != nil {
+			return packageRename{}, err
+		}
+	}
+	return r, nil
+}
+
+// classNameAttrs are the android attributes holding class names that are resolved against the
+// package, by element.
+var classNameAttrs = map[string][]string{
+	"application":     {"name", "backupAgent", "manageSpaceActivity", "appComponentFactory"},
+	"activity":        {"name", "parentActivityName"},
+	"activity-alias":  {"name", "targetActivity"},
+	"service":         {"name"},
+	"receiver":        {"name"},
+	"provider":        {"name"},
+	"instrumentation": {"name"},
+}
+
+// packagePrefixedAttrs are the android attributes whose values conventionally start with the
+// package name, like authorities and custom permissions.
+var packagePrefixedAttrs = []string{"authorities", "taskAffinity", "permission", "readPermission", "writePermission", "permissionGroup", "process"}
+
+// permissionElements are the elements whose android:name is a permission, not a class.
+var permissionElements = []string{"permission", "permission-group", "permission-tree", "uses-permission", "uses-permission-sdk-23"}
+
+// renamePackage prepares the manifest for the package change of r, like aapt2's
+// --rename-manifest-package: relative class names like .MainActivity are expanded with the old
+// package, because the classes keep their names, and authorities, task affinities and
+// permissions starting with the old package are moved to the new one. The package attribute
+// itself is changed with the other root attributes.
+func (e *manifestEditor) renamePackage(r packageRename) error {
+	if pkg := packageName(e.root); pkg != r.old {
+		return withExitCode(exitNotFound, fmt.Errorf("-rename-package expects the package %s, but the manifest has %s", r.old, pkg))
+	}
+	return e.renamePackageIn(e.root, r)
+}
+
+func (e *manifestEditor) renamePackageIn(element *XmlElement, r packageRename) error {
+	classAttrs := classNameAttrs[element.GetName()]
+	isPermission := slices.Contains(permissionElements, element.GetName())
+	for _, attr := range element.GetAttribute() {
+		if attr.GetNamespaceUri() != namespace || attr.GetCompiledItem() != nil {
+			continue
+		}
+		value := attr.GetValue()
+		renamed := value
+		switch {
+		case isPermission && attr.GetName() == "name":
+			renamed = movePackagePrefix(value, r)
+		case slices.Contains(classAttrs, attr.GetName()):
+			renamed = resolveClassName(r.old, value)
+		case attr.GetName() == "authorities":
+			authorities := strings.Split(value, ";")
+			for i, authority := range authorities {
+				authorities[i] = movePackagePrefix(authority, r)
+			}
+			renamed = strings.Join(authorities, ";")
+		case slices.Contains(packagePrefixedAttrs, attr.GetName()):
+			renamed = movePackagePrefix(value, r)
+		case element.GetName() == "instrumentation" && attr.GetName() == "targetPackage" && value == r.old:
+			renamed = r.new
+		}
+		if renamed == value {
+			continue
+		}
+		label := fmt.Sprintf("%s/@android:%s", elementPath(e.root, element), attr.GetName())
+		if err := e.setAttr(element, namespace, attr.GetName(), attr.GetResourceId(), stringAttr, renamed, label); err != nil {
+			return err
+		}
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			if err := e.renamePackageIn(child.GetElement(), r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// movePackagePrefix replaces the old package at the start of value, e.g. the authority
+// com.example.fileprovider or the process com.example:sync, with the new one.
+func movePackagePrefix(value string, r packageRename) string {
+	if value == r.old {
+		return r.new
+	}
+	for _, sep := range []string{".", ":"} {
+		if rest, ok := strings.CutPrefix(value, r.old+sep); ok {
+			return r.new + sep + rest
+		}
+	}
+	return value
+}
@@ -0,0 +1,128 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const patchVersion = 1
+
+// patch is the file format of -emit-patch and -apply-patch. Each change fully describes the
+// resulting attribute or removed element, so a patch can be applied to another build of the same
+// app. Elements are addressed by their android:name where possible, see patchPath.
+type patch struct {
+	Version int      `json:"version"`
+	Changes []change `json:"changes"`
+}
+
+var patchTypes = map[string]attrType{
+	"string": stringAttr,
+	"int":    intAttr,
+	"hex":    hexAttr,
+	"bool":   boolAttr,
+	"float":  floatAttr,
+
+	"reference": refAttr,
+}
+
+func writePatch(path string, changes []change) error {
+	keyed := make([]change, len(changes))
+	for i, c := range changes {
+		keyed[i] = c
+		keyed[i].Element = c.key
+	}
+	out, err := json.MarshalIndent(patch{Version: patchVersion, Changes: keyed}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding patch: %w", err)
+	}
+	if err := os.WriteFile(path, append(out, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed writing patch: %w", err)
+	}
+	return nil
+}
+
+func readPatch(path string) ([]change, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading patch: %w", err)
+	}
+	var p patch
+	if err := json.Unmarshal(in, &p); err != nil {
+		return nil, fmt.Errorf("failed parsing patch: %w", err)
+	}
+	if p.Version != patchVersion {
+		return nil, fmt.Errorf("unsupported patch version %d, expected %d", p.Version, patchVersion)
+	}
+	for i, c := range p.Changes {
+		if c.Kind == removeKind {
+			if c.Element == "" {
+				return nil, fmt.Errorf("invalid patch: change %d needs an element", i)
+			}
+			continue
+		}
+		if c.Kind != "" {
+			return nil, fmt.Errorf("invalid patch: change %d has unknown kind %q", i, c.Kind)
+		}
+		if _, ok := patchTypes[c.Type]; !ok {
+			return nil, fmt.Errorf("invalid patch: change %d has unknown type %q", i, c.Type)
+		}
+		if c.Element == "" || c.Name == "" {
+			return nil, fmt.Errorf("invalid patch: change %d needs an element and a name", i)
+		}
+	}
+	return p.Changes, nil
+}
+
+func (e *manifestEditor) applyChange(c change) error {
+	if c.Kind == removeKind {
+		return e.removeElement(c.Element)
+	}
+	element, err := resolveElementPath(e.root, e.inputPackage, c.Element, true)
+	if exitCode(err) == exitNotFound && c.Namespace == namespace && c.Name == "name" {
+		// The patch recorded adding the element, e.g. by -addPermission.
+		_, err = e.addNamedElement(c.Element, c.Value)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	label := fmt.Sprintf("%s/@%s", c.Element, qualifiedName(e.root, c.Namespace, c.Name))
+	typ := patchTypes[c.Type]
+	// Enums are stored as ints, but their value may be the name of the enum constant.
+	// Likewise, flags are stored as hex ints, but their value may be the names of the flags.
+	if known, ok := androidAttrs[c.Name]; ok && c.Namespace == namespace && known.typ == enumAttr && typ == intAttr {
+		typ = enumAttr
+	}
+	if known, ok := androidAttrs[c.Name]; ok && c.Namespace == namespace && known.typ == flagsAttr && typ == hexAttr {
+		typ = flagsAttr
+	}
+	return e.setAttr(element, c.Namespace, c.Name, c.ResourceID, typ, c.Value, label)
+}
+
+// addNamedElement adds the element with the android:name value a path like
+// manifest/uses-permission[android.permission.CAMERA] refers to, if its parent exists. Top-level
+// elements are placed like -addPermission places them.
+func (e *manifestEditor) addNamedElement(path string, value string) (*XmlElement, error) {
+	i := strings.LastIndex(path, "/")
+	name, selector, ok := strings.Cut(strings.TrimSuffix(path[i+1:], "]"), "[")
+	if i < 0 || !ok || !isPathSelector(selector) {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("element %q not found", path))
+	}
+	parent, err := resolveElementPath(e.root, e.inputPackage, path[:i], false)
+	if err != nil {
+		return nil, err
+	}
+	element := &XmlElement{Name: name}
+	attr := &XmlAttribute{NamespaceUri: namespace, Name: "name", Value: value, ResourceId: nameAttrID}
+	addAttr(element, attr)
+	if parent == e.root {
+		insertTopLevel(e.root, element)
+	} else {
+		parent.Child = append(parent.Child, &XmlNode{Node: &XmlNode_Element{Element: element}})
+	}
+	fmt.Println("Adding", name, value)
+	e.track(element, attr, nil)
+	return element, nil
+}
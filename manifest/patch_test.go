@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const patchTestManifest = `<manifest xmlns:android="http://schemas.android.com/apk/res/android" package="com.example.app" android:versionCode="1">
+  <uses-permission android:name="android.permission.INTERNET"/>
+  <uses-permission android:name="android.permission.READ_PHONE_STATE"/>
+  <uses-feature android:name="android.hardware.camera"/>
+  <application android:label="App">
+    <activity android:name=".MainActivity" android:exported="true"/>
+    <activity android:name=".AdActivity"/>
+    <service android:name=".SyncService"/>
+  </application>
+</manifest>`
+
+func TestPatchRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config editConfig
+	}{
+		{"remove and add permissions", editConfig{removePermissions: []string{"android.permission.INTERNET"}, addPermissions: []string{"android.permission.CAMERA"}}},
+		{"remove before a changed element", editConfig{
+			removePermissions: []string{"android.permission.INTERNET"},
+			attrSets:          []attrSet{{prefix: "android", name: "maxSdkVersion", value: "28", permission: "android.permission.READ_PHONE_STATE"}},
+		}},
+		{"strip components", editConfig{
+			stripComponents: []stripPattern{mustStripPattern(t, `.*\.AdActivity`)},
+			attrSets:        []attrSet{{prefix: "android", name: "exported", value: "false", path: "manifest/application/service[.SyncService]"}},
+		}},
+		{"remove elements and features", editConfig{
+			removeElements: []string{"manifest/application/activity[.MainActivity]"},
+			removeFeatures: []string{"android.hardware.camera"},
+			addFeatures:    []featureSpec{{name: "android.hardware.nfc", required: "false"}},
+			versionCode:    2,
+		}},
+	}
+	original := protoManifest(t, patchTestManifest)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.emitPatch = filepath.Join(t.TempDir(), "patch.json")
+			_, direct, err := editManifest(original, &config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changes, err := readPatch(config.emitPatch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, patched, err := editManifest(original, &editConfig{patch: changes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(patched, direct) {
+				patch, _ := os.ReadFile(config.emitPatch)
+				t.Errorf("applying the patch gave\n%s\nwant\n%s\npatch:\n%s", manifestXML(t, patched), manifestXML(t, direct), patch)
+			}
+		})
+	}
+}
+
+func mustStripPattern(t *testing.T, s string) stripPattern {
+	t.Helper()
+	p, err := parseStripPattern(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// manifestXML returns the proto manifest as text XML, for messages.
+func manifestXML(t *testing.T, data []byte) string {
+	t.Helper()
+	node, err := parseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	writeXMLElement(&buf, node.GetElement(), map[string]string{}, 0)
+	return buf.String()
+}
@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"fmt"
+)
+
+// nameAttrID is the resource ID of android:name.
+const nameAttrID = 0x01010003
+
+// removePermission removes the <uses-permission> elements requesting permission. A permission the
+// manifest doesn't request is only a warning, because the goal is already reached.
+func (e *manifestEditor) removePermission(permission string) {
+	removed := e.removeChildren(e.root, func(element *XmlElement) bool {
+		return element.GetName() == "uses-permission" && componentName(element) == permission
+	})
+	if len(removed) == 0 {
+		e.skipf("Not removing %s, the manifest doesn't request it", permission)
+		return
+	}
+	fmt.Println("Removing uses-permission", permission)
+}
+
+// addPermission adds a <uses-permission> requesting permission, unless the manifest already
+// requests it. The element is placed after the last <uses-permission> or else before
+// <application>, like aapt2 would order a manifest that declared it.
+func (e *manifestEditor) addPermission(permission string) {
+	root := e.root
+	if findPermission(root, permission) != nil {
+		return
+	}
+	element := &XmlElement{Name: "uses-permission"}
+	attr := &XmlAttribute{
+		NamespaceUri: namespace,
+		Name:         "name",
+		Value:        permission,
+		ResourceId:   nameAttrID,
+	}
+	addAttr(element, attr)
+	insertTopLevel(root, element)
+	fmt.Println("Adding uses-permission", permission)
+	e.track(element, attr, nil)
+}
+
+// insertTopLevel inserts element below the root after the last element with the same name or else
+// before <application>.
+func insertTopLevel(root *XmlElement, element *XmlElement) {
+	index := len(root.Child)
+	for i, child := range root.GetChild() {
+		switch child.GetElement().GetName() {
+		case element.GetName():
+			index = i + 1
+		case "application":
+			if index == len(root.Child) {
+				index = i
+			}
+		}
+	}
+	node := &XmlNode{Node: &XmlNode_Element{Element: element}}
+	root.Child = append(root.Child[:index], append([]*XmlNode{node}, root.Child[index:]...)...)
+}
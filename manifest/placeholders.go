@@ -0,0 +1,75 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// placeholderPattern matches Gradle's manifest placeholders like ${applicationId}.
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// parsePlaceholder parses a -placeholder key=value. The value may be empty, but the key may not.
+func parsePlaceholder(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("expected key=value but got %q", s)
+	}
+	return key, value, nil
+}
+
+// substitutePlaceholders replaces the ${key} placeholders in all attribute values, like Gradle
+// does with manifestPlaceholders when it merges the manifest. ${applicationId} is the (new)
+// package unless it's given explicitly. Placeholders without a value are left as they are with a
+// warning.
+func (e *manifestEditor) substitutePlaceholders(placeholders map[string]string, pkg string) error {
+	values := map[string]string{"applicationId": pkg}
+	for key, value := range placeholders {
+		values[key] = value
+	}
+	return e.substitutePlaceholdersIn(e.root, values)
+}
+
+func (e *manifestEditor) substitutePlaceholdersIn(element *XmlElement, values map[string]string) error {
+	for _, attr := range element.GetAttribute() {
+		if item := attr.GetCompiledItem(); !strings.Contains(attr.GetValue(), "${") || item != nil && item.GetStr() == nil {
+			continue
+		}
+		label := fmt.Sprintf("%s/@%s", elementPath(e.root, element), qualifiedName(e.root, attr.GetNamespaceUri(), attr.GetName()))
+		value := placeholderPattern.ReplaceAllStringFunc(attr.GetValue(), func(placeholder string) string {
+			key := placeholderPattern.FindStringSubmatch(placeholder)[1]
+			if value, ok := values[key]; ok {
+				return value
+			}
+			warnf("%s has the placeholder %s, which -placeholder doesn't set", label, placeholder)
+			return placeholder
+		})
+		if value == attr.GetValue() {
+			continue
+		}
+		// The placeholder was compiled as a string, so the type comes from the attribute.
+		typ := stringAttr
+		if attr.GetNamespaceUri() == namespace {
+			info, ok := androidAttrs[attr.GetName()]
+			if !ok {
+				info = overlayAttrs[attr.GetName()]
+			}
+			typ = info.typ
+			if typ == untypedAttr {
+				typ = guessAttrType(attr.GetName(), value)
+			}
+		}
+		if err := e.setAttr(element, attr.GetNamespaceUri(), attr.GetName(), attr.GetResourceId(), typ, value, label); err != nil {
+			return err
+		}
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			if err := e.substitutePlaceholdersIn(child.GetElement(), values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
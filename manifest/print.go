@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// printedAttr is an attribute printed by -print-sdk or -print.
+type printedAttr struct {
+	element   string
+	namespace string
+	name      string
+}
+
+var sdkAttrs = []printedAttr{
+	{"uses-sdk", namespace, "minSdkVersion"},
+	{"uses-sdk", namespace, "targetSdkVersion"},
+	{"manifest", namespace, "compileSdkVersion"},
+	{"uses-sdk", namespace, "maxSdkVersion"},
+}
+
+var manifestValueAttrs = []printedAttr{
+	{"manifest", "", "package"},
+	{"manifest", namespace, versionCodeAttr},
+	{"manifest", namespace, versionNameAttr},
+	{"uses-sdk", namespace, "minSdkVersion"},
+	{"uses-sdk", namespace, "targetSdkVersion"},
+}
+
+// printSdkVersions prints the SDK versions as key=value lines or as a JSON object with null for
+// missing attributes.
+func printSdkVersions(xmlNode *XmlNode, asJSON bool) error {
+	return printAttrs(xmlNode, sdkAttrs, asJSON)
+}
+
+// printManifestValues prints the package, version and SDK levels for -print, in the same formats
+// as printSdkVersions.
+func printManifestValues(xmlNode *XmlNode, asJSON bool) error {
+	return printAttrs(xmlNode, manifestValueAttrs, asJSON)
+}
+
+// printValue prints only the value of one of -print's or -print-sdk's attributes for -get, so
+// scripts can capture it. minSdk etc. are accepted for the SDK versions. A missing attribute is an
+// error instead of unset.
+func printValue(xmlNode *XmlNode, name string) error {
+	if strings.HasSuffix(name, "Sdk") {
+		name += "Version"
+	}
+	for _, a := range append(manifestValueAttrs, sdkAttrs...) {
+		if a.name != name {
+			continue
+		}
+		element := xmlNode.GetElement()
+		if a.element != "manifest" {
+			element = childElement(element, a.element)
+		}
+		attr := findAttr(element, a.namespace, a.name)
+		if attr == nil {
+			return withExitCode(exitNotFound, fmt.Errorf("the manifest has no %s", name))
+		}
+		fmt.Println(attrValue(attr))
+		return nil
+	}
+	return withExitCode(exitUsage, errors.New("unknown -get value, expected package, versionCode, versionName, minSdkVersion, targetSdkVersion, compileSdkVersion or maxSdkVersion"))
+}
+
+func printAttrs(xmlNode *XmlNode, attrs []printedAttr, asJSON bool) error {
+	root := xmlNode.GetElement()
+	values := map[string]*string{}
+	for _, a := range attrs {
+		element := root
+		if a.element != "manifest" {
+			element = childElement(root, a.element)
+		}
+		if attr := findAttr(element, a.namespace, a.name); attr != nil {
+			value := attrValue(attr)
+			values[a.name] = &value
+		} else {
+			values[a.name] = nil
+		}
+	}
+
+	if asJSON {
+		out, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("failed encoding JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for _, a := range attrs {
+		value := "unset"
+		if v := values[a.name]; v != nil {
+			value = *v
+		}
+		fmt.Printf("%s=%s\n", a.name, value)
+	}
+	return nil
+}
+
+// printNamespaces prints the namespace declarations of the root element as prefix=URI lines or as
+// a JSON object.
+func printNamespaces(xmlNode *XmlNode, asJSON bool) error {
+	decls := xmlNode.GetElement().GetNamespaceDeclaration()
+	if asJSON {
+		values := map[string]string{}
+		for _, decl := range decls {
+			values[decl.GetPrefix()] = decl.GetUri()
+		}
+		out, err := json.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("failed encoding JSON: %w", err)
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	if len(decls) == 0 {
+		fmt.Println("No namespace declarations")
+		return nil
+	}
+	for _, decl := range decls {
+		fmt.Printf("%s=%s\n", decl.GetPrefix(), decl.GetUri())
+	}
+	return nil
+}
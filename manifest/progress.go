@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// showProgress prints how far the zip copy is, set by -progress.
+var showProgress bool
+
+// progressInterval is how often -progress prints a line.
+const progressInterval = time.Second
+
+// zipProgress counts the entries and bytes written while an archive is rewritten and prints them
+// to stderr with -progress, at most once per progressInterval and once at the end.
+type zipProgress struct {
+	name    string
+	entries int
+	total   int
+	bytes   int64
+	size    int64
+	last    time.Time
+}
+
+func newZipProgress(zipPath string, files []*zip.File) *zipProgress {
+	p := &zipProgress{name: zipPath, total: len(files), last: time.Now()}
+	for _, file := range files {
+		p.size += int64(file.CompressedSize64)
+	}
+	return p
+}
+
+// entryDone counts the entry that's being written, of n compressed bytes.
+func (p *zipProgress) entryDone(n int64) {
+	p.entries++
+	p.bytes += n
+	if showProgress && time.Since(p.last) >= progressInterval {
+		p.print()
+	}
+}
+
+// finish prints the final line.
+func (p *zipProgress) finish() {
+	if showProgress {
+		p.print()
+	}
+}
+
+func (p *zipProgress) print() {
+	p.last = time.Now()
+	percent := 100
+	if p.size > 0 {
+		percent = int(min(p.bytes*100/p.size, 100))
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d/%d entries, %s of %s (%d%%)\n", p.name, p.entries, p.total, formatMiB(p.bytes), formatMiB(p.size), percent)
+}
+
+func formatMiB(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
+
+// checkCancelled fails once runCtx is cancelled, so a rewrite stops between entries instead of
+// finishing the archive.
+func checkCancelled() error {
+	if err := runCtx.Err(); err != nil {
+		return fmt.Errorf("rewrite aborted: %w", err)
+	}
+	return nil
+}
+
+// cancellableReader stops a copy within a large entry once runCtx is cancelled.
+type cancellableReader struct {
+	r io.Reader
+}
+
+func (c cancellableReader) Read(p []byte) (int, error) {
+	if err := checkCancelled(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
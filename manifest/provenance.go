@@ -0,0 +1,66 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// provenancePath is the archive entry written by -embed-provenance.
+const provenancePath = "META-INF/manifest-changer.json"
+
+// provenance records that an archive was post-processed by this tool and what it changed.
+type provenance struct {
+	Tool    string   `json:"tool"`
+	Version string   `json:"version"`
+	Commit  string   `json:"commit,omitempty"`
+	Date    string   `json:"date"`
+	Changes []change `json:"changes"`
+}
+
+func provenanceJSON(changes []change) ([]byte, error) {
+	if changes == nil {
+		changes = []change{}
+	}
+	date, err := buildTime()
+	if err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(provenance{
+		Tool:    "androidmanifest-changer",
+		Version: version,
+		Commit:  commit,
+		Date:    date.Format(time.RFC3339),
+		Changes: changes,
+	}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding provenance: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+// reproducible is set by -reproducible: without SOURCE_DATE_EPOCH, buildTime is reproducibleTime
+// instead of the current time.
+var reproducible bool
+
+// reproducibleTime is the timestamp the Android build tools, e.g. zipflinger, give the entries of
+// reproducible archives.
+var reproducibleTime = time.Date(1981, 1, 1, 1, 1, 2, 0, time.UTC)
+
+// buildTime is the date of provenance entries and of the entries added to archives. It honors
+// SOURCE_DATE_EPOCH, so reproducible builds stay reproducible.
+func buildTime() (time.Time, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		seconds, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
+		}
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	if reproducible {
+		return reproducibleTime, nil
+	}
+	return time.Now().UTC(), nil
+}
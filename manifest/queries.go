@@ -0,0 +1,180 @@
+package manifest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// mimeTypeAttrID is the resource ID of android:mimeType.
+const mimeTypeAttrID = 0x01010026
+
+// queryIntent is an -add-query-intent <intent> below <queries>, which makes the apps handling it
+// visible to the app on Android 11+.
+type queryIntent struct {
+	action     string
+	categories []string
+	scheme     string
+	host       string
+	mimeType   string
+}
+
+// parseQueryIntent parses ACTION[;category=NAME][;scheme=S][;host=H][;mimeType=T], e.g.
+// android.intent.action.VIEW;category=android.intent.category.BROWSABLE;scheme=https. category can
+// be repeated.
+func parseQueryIntent(s string) (queryIntent, error) {
+	parts := strings.Split(s, ";")
+	q := queryIntent{action: strings.TrimSpace(parts[0])}
+	if q.action == "" {
+		return queryIntent{}, fmt.Errorf("missing the action in %q", s)
+	}
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return queryIntent{}, fmt.Errorf("expected key=value after the action but got %q", part)
+		}
+		switch key {
+		case "category":
+			q.categories = append(q.categories, value)
+		case "scheme":
+			q.scheme = value
+		case "host":
+			q.host = value
+		case "mimeType":
+			q.mimeType = value
+		default:
+			return queryIntent{}, fmt.Errorf("unknown key %q in %q, expected category, scheme, host or mimeType", key, s)
+		}
+	}
+	if q.host != "" && q.scheme == "" {
+		return queryIntent{}, fmt.Errorf("%q: a host needs a scheme, the platform ignores it otherwise", s)
+	}
+	return q, nil
+}
+
+func (q queryIntent) String() string {
+	s := q.action
+	for _, category := range q.categories {
+		s += ";category=" + category
+	}
+	for _, d := range []struct{ key, value string }{{"scheme", q.scheme}, {"host", q.host}, {"mimeType", q.mimeType}} {
+		if d.value != "" {
+			s += ";" + d.key + "=" + d.value
+		}
+	}
+	return s
+}
+
+// intentChild is an attribute of a child element of an <intent>, e.g. <action android:name>.
+type intentChild struct {
+	element string
+	name    string
+	id      uint32
+	value   string
+}
+
+// queriesElement returns the manifest's first <queries>, adding one before <application> if
+// there's none.
+func (e *manifestEditor) queriesElement() *XmlElement {
+	if queries := childElement(e.root, "queries"); queries != nil {
+		return queries
+	}
+	queries := &XmlElement{Name: "queries"}
+	insertTopLevel(e.root, queries)
+	return queries
+}
+
+// addQueryPackage adds a <package> to <queries> for -add-query-package, unless any <queries>
+// already lists the package.
+func (e *manifestEditor) addQueryPackage(name string) error {
+	for _, child := range e.root.GetChild() {
+		if child.GetElement().GetName() != "queries" {
+			continue
+		}
+		for _, c := range child.GetElement().GetChild() {
+			if c.GetElement().GetName() == "package" && componentName(c.GetElement()) == name {
+				notef("The manifest already queries the package %s", name)
+				return nil
+			}
+		}
+	}
+	queries := e.queriesElement()
+	element := &XmlElement{Name: "package"}
+	queries.Child = append(queries.Child, &XmlNode{Node: &XmlNode_Element{Element: element}})
+	fmt.Println("Adding the package", name, "to <queries>")
+	return e.setAttr(element, namespace, "name", nameAttrID, stringAttr, name, fmt.Sprintf("queries package %s android:name", name))
+}
+
+// addQueryIntent adds an <intent> to <queries> for -add-query-intent, unless any <queries> already
+// has one with the same action, categories and data.
+func (e *manifestEditor) addQueryIntent(q queryIntent) error {
+	children := []intentChild{{"action", "name", nameAttrID, q.action}}
+	for _, category := range q.categories {
+		children = append(children, intentChild{"category", "name", nameAttrID, category})
+	}
+	children = append(children,
+		intentChild{"data", "scheme", schemeAttrID, q.scheme},
+		intentChild{"data", "host", hostAttrID, q.host},
+		intentChild{"data", "mimeType", mimeTypeAttrID, q.mimeType},
+	)
+
+	var wanted []string
+	for _, c := range children {
+		if c.value != "" {
+			wanted = append(wanted, c.element+"/"+c.name+"="+c.value)
+		}
+	}
+	sort.Strings(wanted)
+	for _, child := range e.root.GetChild() {
+		if child.GetElement().GetName() != "queries" {
+			continue
+		}
+		for _, c := range child.GetElement().GetChild() {
+			if c.GetElement().GetName() == "intent" && slices.Equal(intentSignature(c.GetElement()), wanted) {
+				notef("The manifest already queries the intent %s", q)
+				return nil
+			}
+		}
+	}
+
+	queries := e.queriesElement()
+	intent := &XmlElement{Name: "intent"}
+	queries.Child = append(queries.Child, &XmlNode{Node: &XmlNode_Element{Element: intent}})
+	fmt.Println("Adding the intent", q, "to <queries>")
+	var data *XmlElement
+	for _, c := range children {
+		if c.value == "" {
+			continue
+		}
+		element := data
+		if c.element != "data" || data == nil {
+			element = &XmlElement{Name: c.element}
+			intent.Child = append(intent.Child, &XmlNode{Node: &XmlNode_Element{Element: element}})
+		}
+		if c.element == "data" {
+			// The data attributes of a query intent go on a single <data>.
+			data = element
+		}
+		if err := e.setAttr(element, namespace, c.name, c.id, stringAttr, c.value, fmt.Sprintf("queries intent <%s android:%s>", c.element, c.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// intentSignature returns the sorted element/attribute=value lines of the intent's android
+// attributes, to compare intents regardless of their order.
+func intentSignature(intent *XmlElement) []string {
+	var lines []string
+	for _, child := range intent.GetChild() {
+		element := child.GetElement()
+		for _, attr := range element.GetAttribute() {
+			if attr.GetNamespaceUri() == namespace {
+				lines = append(lines, element.GetName()+"/"+attr.GetName()+"="+attrValue(attr))
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
@@ -0,0 +1,148 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// resourceTable resolves references by name like @string/app_name to resource IDs with the proto
+// resource table next to the manifest. The table is only read when a reference needs it.
+type resourceTable struct {
+	zipPath string
+	name    string
+	// Used if the archive has no table at name, like the base module's table for feature modules
+	// without resources of their own.
+	fallback *resourceTable
+	loaded   bool
+	table    *ResourceTable
+	err      error
+}
+
+// load reads and caches the table. It returns a nil table without an error if the archive has none.
+func (r *resourceTable) load() (*ResourceTable, error) {
+	if r.loaded {
+		return r.table, r.err
+	}
+	r.loaded = true
+	data, err := readFromZipIfExists(r.zipPath, r.name)
+	switch {
+	case err != nil:
+		r.err = err
+	case data != nil:
+		r.table = &ResourceTable{}
+		if err := r.table.UnmarshalVT(data); err != nil {
+			r.table, r.err = nil, fmt.Errorf("failed to parse %s: %w", r.name, err)
+		}
+	}
+	return r.table, r.err
+}
+
+// resolve returns the resource ID of a reference like string/app_name or com.some.app:string/app_name.
+// Framework resources like android:drawable/sym_def_app_icon aren't part of the app's table.
+func (r *resourceTable) resolve(name string) (uint32, error) {
+	pkgName, typeAndEntry, ok := strings.Cut(name, ":")
+	if !ok {
+		pkgName, typeAndEntry = "", name
+	}
+	if pkgName == "android" {
+		return 0, fmt.Errorf("@%s is a framework resource, which the app's resource table doesn't have", name)
+	}
+	typeName, entryName, _ := strings.Cut(typeAndEntry, "/")
+	if r == nil {
+		return 0, fmt.Errorf("there's no proto resource table to look up @%s", name)
+	}
+	table, err := r.load()
+	if table == nil && err == nil && r.fallback != nil {
+		return r.fallback.resolve(name)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if table == nil {
+		return 0, fmt.Errorf("the archive has no proto resource table %s", r.name)
+	}
+	typeFound := false
+	for _, pkg := range table.GetPackage() {
+		if pkgName != "" && pkg.GetPackageName() != pkgName {
+			continue
+		}
+		for _, typ := range pkg.GetType() {
+			if typ.GetName() != typeName {
+				continue
+			}
+			typeFound = true
+			for _, entry := range typ.GetEntry() {
+				if entry.GetName() == entryName {
+					return pkg.GetPackageId().GetId()<<24 | typ.GetTypeId().GetId()<<16 | entry.GetEntryId().GetId(), nil
+				}
+			}
+		}
+	}
+	if !typeFound {
+		return 0, fmt.Errorf("%s has no resources of the type %s", r.name, typeName)
+	}
+	return 0, fmt.Errorf("%s has no %s", r.name, typeAndEntry)
+}
+
+// resolveReference fills in the resource ID of attr if it's a reference by name. The compiled
+// manifest only stores IDs, so a reference that can't be resolved is a warning: the platform
+// can't load it.
+func (e *manifestEditor) resolveReference(attr *XmlAttribute, label string) {
+	ref := attr.GetCompiledItem().GetRef()
+	if ref == nil || ref.GetId() != 0 || ref.GetName() == "" || e.keepReferenceNames {
+		return
+	}
+	id, err := e.resources.resolve(ref.GetName())
+	if err != nil {
+		e.skipf("%s: @%s can't be resolved to a resource ID, the platform won't load it: %v. Pass it as @0x7f... instead.", label, ref.GetName(), err)
+		return
+	}
+	ref.Id = id
+	notef("Resolved @%s of %s to 0x%08x", ref.GetName(), label, id)
+}
+
+// resolveReferences resolves the references by name in an element added from an overlay and its
+// children.
+func (e *manifestEditor) resolveReferences(element *XmlElement) {
+	for _, attr := range element.GetAttribute() {
+		e.resolveReference(attr, fmt.Sprintf("%s/@%s", elementPath(e.root, element), qualifiedName(e.root, attr.GetNamespaceUri(), attr.GetName())))
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			e.resolveReferences(child.GetElement())
+		}
+	}
+}
+
+// entryName returns the type/entry name of a resource ID, e.g. string/app_name for 0x7f010000.
+func (r *resourceTable) entryName(id uint32) (string, error) {
+	if r == nil {
+		return "", fmt.Errorf("there's no proto resource table to look up @0x%08x", id)
+	}
+	table, err := r.load()
+	if table == nil && err == nil && r.fallback != nil {
+		return r.fallback.entryName(id)
+	}
+	if err != nil {
+		return "", err
+	}
+	if table == nil {
+		return "", fmt.Errorf("the archive has no proto resource table %s", r.name)
+	}
+	for _, pkg := range table.GetPackage() {
+		if pkg.GetPackageId().GetId() != id>>24 {
+			continue
+		}
+		for _, typ := range pkg.GetType() {
+			if typ.GetTypeId().GetId() != id>>16&0xff {
+				continue
+			}
+			for _, entry := range typ.GetEntry() {
+				if entry.GetEntryId().GetId() == id&0xffff {
+					return typ.GetName() + "/" + entry.GetName(), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("%s has no resource 0x%08x", r.name, id)
+}
@@ -0,0 +1,190 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// report is the file format of -report, one entry per processed file.
+type report struct {
+	Tool    string `json:"tool"`
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date"`
+	// The warnings printed before the first file, e.g. about the options.
+	Warnings []string     `json:"warnings,omitempty"`
+	Files    []fileReport `json:"files"`
+	// When the previous file was done, to time the next one.
+	lastDone time.Time
+	// The hashes of the files before they were edited, by their reported path.
+	inputs map[string]string
+}
+
+type fileReport struct {
+	Path string `json:"path"`
+	// "updated" or "unchanged", or with -dryRun "wouldUpdate" or "unchanged".
+	Status string `json:"status"`
+	SHA256 string `json:"sha256"`
+	// The hash of the file before the run, if it was edited.
+	OriginalSHA256 string `json:"originalSha256,omitempty"`
+	// The hash of the canonical manifest entry of an APK or AAB after the run.
+	ManifestSHA256 string   `json:"manifestSha256,omitempty"`
+	Changes        []change `json:"changes"`
+	// The warnings printed while processing the file.
+	Warnings []string `json:"warnings,omitempty"`
+	// How long the file took, in milliseconds.
+	DurationMs int64 `json:"durationMs"`
+}
+
+func newReport() (*report, error) {
+	date, err := buildTime()
+	if err != nil {
+		return nil, err
+	}
+	return &report{
+		Tool:     "androidmanifest-changer",
+		Version:  version,
+		Commit:   commit,
+		Date:     date.Format(time.RFC3339),
+		Warnings: takeWarnings(),
+		Files:    []fileReport{},
+		lastDone: time.Now(),
+		inputs:   map[string]string{},
+	}, nil
+}
+
+// hashInput records the hash of input before it's edited, for the entry of path. They differ with
+// -output. A nil report ignores it.
+func (r *report) hashInput(path string, input string) error {
+	if r == nil {
+		return nil
+	}
+	sum, err := fileSHA256(input)
+	if err != nil {
+		return err
+	}
+	r.inputs[path] = sum
+	return nil
+}
+
+// add records the result of updateFile for path. The hash is taken from the file as it is now.
+// A nil report ignores the result.
+func (r *report) add(path string, changes []change, written bool) error {
+	if r == nil {
+		return nil
+	}
+	status := "unchanged"
+	if written {
+		status = "updated"
+	}
+	if changes == nil {
+		changes = []change{}
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	manifestSum, err := manifestSHA256(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	r.Files = append(r.Files, fileReport{
+		Path:           path,
+		Status:         status,
+		SHA256:         sum,
+		OriginalSHA256: r.inputs[path],
+		ManifestSHA256: manifestSum,
+		Changes:        changes,
+		Warnings:       takeWarnings(),
+		DurationMs:     now.Sub(r.lastDone).Milliseconds(),
+	})
+	r.lastDone = now
+	return nil
+}
+
+// addDryRun records the result of a -dryRun check of path, which left the file as it is.
+func (r *report) addDryRun(path string, changes []change, changed bool) error {
+	if r == nil {
+		return nil
+	}
+	if err := r.add(path, changes, false); err != nil {
+		return err
+	}
+	if changed {
+		r.Files[len(r.Files)-1].Status = "wouldUpdate"
+	}
+	return nil
+}
+
+func (r *report) write(path string) error {
+	out, err := r.encode()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, out, 0644); err != nil {
+		return fmt.Errorf("failed writing report: %w", err)
+	}
+	return nil
+}
+
+// encode returns the report as indented JSON, followed by a newline.
+func (r *report) encode() ([]byte, error) {
+	out, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed encoding report: %w", err)
+	}
+	return append(out, '\n'), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed opening file: %w", err)
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed reading file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// manifestSHA256 returns the hash of the canonical manifest entry of an APK or AAB, or "" for other
+// files, like APK sets that have a manifest per APK.
+func manifestSHA256(path string) (string, error) {
+	name := "AndroidManifest.xml"
+	if strings.HasSuffix(path, ".aab") {
+		name = aabManifestPath
+	} else if !strings.HasSuffix(path, ".apk") && !strings.HasSuffix(path, ".aar") {
+		return "", nil
+	}
+	name, err := manifestEntryName(path, name)
+	if err != nil {
+		return "", err
+	}
+	data, err := readFromZip(path, name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkSHA256 fails if the file's hash isn't the -expect-sha256 digest, before it's modified.
+func checkSHA256(path string, want string) error {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, want) {
+		return withExitCode(exitChecksumMismatch, fmt.Errorf("refusing to modify the file, its SHA-256 is %s instead of the expected %s", sum, want))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunReportRemovals(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "AndroidManifest.xml")
+	original := protoManifest(t, patchTestManifest)
+	if err := os.WriteFile(path, original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reportPath := filepath.Join(dir, "report.json")
+	code := runMain(t, "--dry-run", "-report", reportPath,
+		"-removePermission", "android.permission.INTERNET",
+		"-strip-component", `.*\.AdActivity`,
+		"-remove-element", "manifest/application/service[.SyncService]",
+		"-versionCode", "2",
+		path)
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, original) {
+		t.Errorf("-dry-run modified the manifest (err %v)", err)
+	}
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rep report
+	if err := json.Unmarshal(data, &rep); err != nil {
+		t.Fatal(err)
+	}
+	if len(rep.Files) != 1 || rep.Files[0].Status != "wouldUpdate" {
+		t.Fatalf("got files %+v, want one that would update", rep.Files)
+	}
+	removed := map[string]string{}
+	attributes := 0
+	for _, c := range rep.Files[0].Changes {
+		switch c.Kind {
+		case removeKind:
+			if c.Old == nil {
+				t.Errorf("removal of %s lacks the removed name", c.Element)
+				continue
+			}
+			removed[*c.Old] = c.Element
+		case "":
+			attributes++
+		default:
+			t.Errorf("unexpected kind %q", c.Kind)
+		}
+	}
+	// A removal names the removed element by its path and android:name.
+	want := map[string]string{
+		"android.permission.INTERNET": "manifest/uses-permission",
+		".AdActivity":                 "manifest/application/activity[1]",
+		".SyncService":                "manifest/application/service",
+	}
+	for name, element := range want {
+		if removed[name] != element {
+			t.Errorf("removal of %s: got element %q, want %q\n%s", name, removed[name], element, data)
+		}
+	}
+	if len(removed) != len(want) || attributes != 1 {
+		t.Errorf("got %d removals and %d attribute changes, want %d and 1\n%s", len(removed), attributes, len(want), data)
+	}
+}
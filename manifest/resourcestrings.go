@@ -0,0 +1,187 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// stringSet is a -set-string assignment of a string resource in the proto resource table.
+type stringSet struct {
+	name  string
+	value string
+	// If set, only the value of this locale (a BCP-47 tag like de or pt-BR as aapt2 stores it) is
+	// changed. Otherwise every configuration of the string gets the value.
+	locale string
+	// If set, a locale the string has no value for yet gets one instead of failing.
+	add bool
+}
+
+// parseStringSet parses name=value or name[locale]=value. The name may be given as a reference
+// like @string/app_name too. An empty locale selects the default configuration.
+func parseStringSet(s string) (stringSet, error) {
+	key, value, ok := strings.Cut(s, "=")
+	key = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(key), "@"), "string/")
+	if !ok || key == "" {
+		return stringSet{}, fmt.Errorf("expected name=value or name[locale]=value but got %q", s)
+	}
+	set := stringSet{name: key, value: value}
+	if name, locale, ok := strings.Cut(key, "["); ok {
+		if !strings.HasSuffix(locale, "]") || name == "" {
+			return stringSet{}, fmt.Errorf("expected name[locale]=value but got %q", s)
+		}
+		set.name, set.locale = name, strings.TrimSuffix(locale, "]")
+		if set.locale == "" {
+			set.locale = "default"
+		}
+	}
+	return set, nil
+}
+
+func (s stringSet) String() string {
+	if s.locale != "" {
+		return fmt.Sprintf("string/%s[%s]", s.name, s.locale)
+	}
+	return "string/" + s.name
+}
+
+// resourcesPath returns the resource table next to the manifest: resources.pb at the root of a
+// proto APK and <module>/resources.pb in an AAB.
+func resourcesPath(manifestPath string) string {
+	dir := strings.TrimSuffix(manifestPath, "AndroidManifest.xml")
+	return strings.TrimSuffix(dir, "manifest/") + "resources.pb"
+}
+
+// updateStrings applies the -set-string assignments to the resource table at name in the zip file
+// and returns the new table, or nil if nothing changed. APKs only have a proto resource table
+// while they're converted with aapt2, so this doesn't work with -native-axml.
+func updateStrings(path string, name string, sets []stringSet) ([]byte, error) {
+	data, err := readFromZipIfExists(path, name)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("-set-string and -label-locale need the proto resource table %s, which the archive doesn't have", name))
+	}
+	table := &ResourceTable{}
+	if err := table.UnmarshalVT(data); err != nil {
+		return nil, withExitCode(exitParse, fmt.Errorf("failed to parse %s: %w", name, err))
+	}
+	changed := false
+	for _, set := range sets {
+		c, err := setString(table, set)
+		if err != nil {
+			return nil, err
+		}
+		changed = changed || c
+	}
+	if !changed {
+		return nil, nil
+	}
+	return table.MarshalVT()
+}
+
+// setString changes the string's values in the matching configurations. Styled strings become
+// plain strings, because their spans wouldn't match the new text.
+func setString(table *ResourceTable, set stringSet) (bool, error) {
+	var entry *Entry
+	for _, pkg := range table.GetPackage() {
+		for _, typ := range pkg.GetType() {
+			if typ.GetName() != "string" {
+				continue
+			}
+			for _, e := range typ.GetEntry() {
+				if e.GetName() == set.name {
+					entry = e
+				}
+			}
+		}
+	}
+	if entry == nil {
+		return false, withExitCode(exitNotFound, fmt.Errorf("the resource table has no string/%s", set.name))
+	}
+	changed, matched := false, false
+	for _, configValue := range entry.GetConfigValue() {
+		locale := configValue.GetConfig().GetLocale()
+		if set.locale != "" && locale != set.locale && (set.locale != "default" || locale != "") {
+			continue
+		}
+		matched = true
+		item := configValue.GetValue().GetItem()
+		if item == nil || item.GetStr() == nil && item.GetStyledStr() == nil {
+			return false, fmt.Errorf("string/%s has a value that isn't a string, e.g. a reference", set.name)
+		}
+		old := item.GetStr().GetValue()
+		if item.GetStyledStr() != nil {
+			old = item.GetStyledStr().GetValue()
+		} else if old == set.value {
+			continue
+		}
+		if locale == "" {
+			locale = "default"
+		}
+		fmt.Printf("Changing string/%s [%s] from %s to %s\n", set.name, locale, old, set.value)
+		item.Value = &Item_Str{Str: &String{Value: set.value}}
+		changed = true
+	}
+	if !matched && set.add && set.locale != "default" {
+		fmt.Printf("Adding string/%s [%s] with %s\n", set.name, set.locale, set.value)
+		entry.ConfigValue = append(entry.ConfigValue, &ConfigValue{
+			Config: &Configuration{Locale: set.locale},
+			Value:  &Value{Value: &Value_Item{Item: &Item{Value: &Item_Str{Str: &String{Value: set.value}}}}},
+		})
+		return true, nil
+	}
+	if !matched {
+		return false, withExitCode(exitNotFound, fmt.Errorf("string/%s has no value for the locale %s", set.name, set.locale))
+	}
+	return changed, nil
+}
+
+// labelLocale is a -label-locale locale=value, the app name in one locale.
+type labelLocale struct {
+	locale string
+	value  string
+}
+
+func parseLabelLocale(s string) (labelLocale, error) {
+	locale, value, ok := strings.Cut(s, "=")
+	locale = strings.TrimSpace(locale)
+	if !ok || locale == "" || value == "" {
+		return labelLocale{}, fmt.Errorf("expected locale=label like es=Mi App but got %q", s)
+	}
+	return labelLocale{locale: locale, value: value}, nil
+}
+
+// labelStringSets returns the -set-string assignments for the -label-locale values: they change
+// the string resource the edited manifest's android:label references, adding the locales it
+// doesn't have yet.
+func labelStringSets(root *XmlElement, resources *resourceTable, labels []labelLocale) ([]stringSet, error) {
+	attr := findAttr(childElement(root, "application"), namespace, "label")
+	if attr == nil {
+		return nil, withExitCode(exitNotFound, errors.New("-label-locale needs an android:label on <application>, but it has none"))
+	}
+	ref := attr.GetCompiledItem().GetRef()
+	if ref == nil {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("-label-locale needs an android:label that references a string resource, but it's the literal %q", attrValue(attr)))
+	}
+	name := ref.GetName()
+	if name == "" {
+		var err error
+		if name, err = resources.entryName(ref.GetId()); err != nil {
+			return nil, fmt.Errorf("-label-locale can't find the label's string: %w", err)
+		}
+	}
+	if _, typeAndEntry, ok := strings.Cut(name, ":"); ok {
+		name = typeAndEntry
+	}
+	entry, ok := strings.CutPrefix(name, "string/")
+	if !ok {
+		return nil, withExitCode(exitNotFound, fmt.Errorf("-label-locale needs an android:label that references a string resource, but it's @%s", name))
+	}
+	var sets []stringSet
+	for _, label := range labels {
+		sets = append(sets, stringSet{name: entry, value: label.value, locale: label.locale, add: true})
+	}
+	return sets, nil
+}
@@ -0,0 +1,132 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// apksignerPath is the apksigner binary, found like aapt2 by resolveApksignerPath.
+var apksignerPath = "apksigner"
+
+// buildToolsVersion pins the build-tools version the SDK tools are taken from, set by -build-tools.
+var buildToolsVersion string
+
+func resolveApksignerPath() {
+	if path := os.Getenv("APKSIGNER_PATH"); path != "" && buildToolsVersion == "" {
+		apksignerPath = path
+		return
+	}
+	apksignerPath = findSdkTool("apksigner")
+}
+
+// findSdkTool returns name if it's in the PATH, otherwise the tool of the newest build-tools of the
+// Android SDK at $ANDROID_HOME or $ANDROID_SDK_ROOT, e.g. on CI runners that don't add build-tools
+// to the PATH. With -build-tools only that version is used, even if the PATH has the tool. If
+// nothing has it, the plain name is returned, so the error names the tool. On Windows
+// exec.LookPath finds aapt2.exe and apksigner.bat via PATHEXT, and so does this.
+func findSdkTool(name string) string {
+	if _, err := exec.LookPath(name); err == nil && buildToolsVersion == "" {
+		return name
+	}
+	for _, sdk := range sdkRoots() {
+		dirs := []string{buildToolsVersion}
+		if buildToolsVersion == "" {
+			dirs = buildToolsVersions(sdk)
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			for _, file := range toolFileNames(name) {
+				path := filepath.Join(sdk, "build-tools", dirs[i], file)
+				if info, err := os.Stat(path); err == nil && !info.IsDir() {
+					return path
+				}
+			}
+		}
+	}
+	return name
+}
+
+// sdkRoots returns the SDK directories given by $ANDROID_HOME and $ANDROID_SDK_ROOT, in that order.
+func sdkRoots() []string {
+	var roots []string
+	for _, env := range []string{"ANDROID_HOME", "ANDROID_SDK_ROOT"} {
+		if sdk := os.Getenv(env); sdk != "" && !slices.Contains(roots, sdk) {
+			roots = append(roots, sdk)
+		}
+	}
+	return roots
+}
+
+// buildToolsVersions returns the installed build-tools versions of the SDK, oldest first.
+func buildToolsVersions(sdk string) []string {
+	entries, err := os.ReadDir(filepath.Join(sdk, "build-tools"))
+	if err != nil {
+		return nil
+	}
+	var versions []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	slices.SortFunc(versions, compareVersions)
+	return versions
+}
+
+// checkBuildTools fails if the -build-tools version isn't installed in any SDK.
+func checkBuildTools() error {
+	if buildToolsVersion == "" {
+		return nil
+	}
+	roots := sdkRoots()
+	if len(roots) == 0 {
+		return errors.New("set ANDROID_HOME or ANDROID_SDK_ROOT to the Android SDK")
+	}
+	var installed []string
+	for _, sdk := range roots {
+		versions := buildToolsVersions(sdk)
+		if slices.Contains(versions, buildToolsVersion) {
+			return nil
+		}
+		installed = append(installed, versions...)
+	}
+	if len(installed) == 0 {
+		return fmt.Errorf("%s isn't installed, %s has no build-tools", buildToolsVersion, strings.Join(roots, " and "))
+	}
+	return fmt.Errorf("%s isn't installed, the SDK has %s", buildToolsVersion, strings.Join(installed, ", "))
+}
+
+// toolFileNames returns the file names an SDK tool has on this OS. On Windows the build-tools
+// ship aapt2.exe and apksigner.bat.
+func toolFileNames(name string) []string {
+	if runtime.GOOS != "windows" {
+		return []string{name}
+	}
+	return []string{name + ".exe", name + ".bat", name + ".cmd"}
+}
+
+// compareVersions orders build-tools directories like 34.0.0 and 35.0.0-rc1 numerically, so 9.0.0
+// sorts before 10.0.0 and a release after its release candidates.
+func compareVersions(a string, b string) int {
+	return slices.Compare(versionParts(a), versionParts(b))
+}
+
+func versionParts(version string) []int {
+	release, rc, isRC := strings.Cut(version, "-rc")
+	var parts []int
+	for _, part := range strings.Split(release, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	if n, err := strconv.Atoi(rc); isRC && err == nil {
+		return append(parts, n)
+	}
+	return append(parts, math.MaxInt)
+}
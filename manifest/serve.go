@@ -0,0 +1,259 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// serveAllowedFlags are the flags a change set sent to the serve command can use: the edits and the
+// checks of the edited artifact. Everything else is rejected, i.e. the flags that read or write
+// files on the server, run commands on it, select a mode that doesn't return the edited artifact,
+// sign with the server's keys or override the server's own settings, and flags added later until
+// they're listed here.
+var serveAllowedFlags = []string{
+	"versionCode", "incrementVersionCode", "versionCode-increment", "versionName", "versionName-from-code",
+	"versionNameSuffix", "revisionCode", "minSdkVersion", "targetSdkVersion", "compileSdkVersion",
+	"compileSdkVersionCodename", "targetSandboxVersion", "installLocation", "sharedUserId",
+	"platformBuildVersionCode", "platformBuildVersionName", "sharedUserMaxSdkVersion", "package",
+	"rename-package", "requiredSplitTypes", "splitTypes", "applicationEnabled", "app-bool", "persistent",
+	"restoreAnyVersion", "extractNativeLibs", "largeHeap", "hardwareAccelerated",
+	"requestLegacyExternalStorage", "debuggable", "test-only", "allow-backup", "backupAgent", "appComponentFactory", "uses-cleartext-traffic",
+	"network-security-config", "dataExtractionRules", "fullBackupContent", "permission-max-sdk",
+	"set-permission-flags", "set-grant-uri", "set-exported", "set-task-affinity", "set-directboot",
+	"addPermission", "add-permission", "removePermission", "remove-permission", "strip-permission",
+	"strip-component", "placeholder", "label-locale", "set-string", "add-app-link", "add-query-package",
+	"add-query-intent", "meta-data",
+	"enableOnBackInvokedCallback", "back-callback-component", "maxAspectRatio", "gwpAsanMode", "label",
+	"icon", "round-icon", "memtagMode", "add-feature", "remove-feature", "set-feature-required",
+	"glEsVersion", "keep-whitespace", "removeAttr", "remove-attribute", "remove-element", "set", "only",
+	"component", "skipUnchanged", "no-reconvert", "max-report-len", "expect-sha256", "bundletool-version",
+	"uncompress-native-libs", "split-dimension", "rename-module", "verify", "verify-badging", "strict",
+	"all-manifests", "modules", "base-only", "embed-provenance", "preserve-signing-block", "reproducible",
+	"zip-creator-version", "manifestPath", "verbose", "v", "quiet", "q",
+}
+
+// server implements the serve command, which edits uploaded artifacts.
+type server struct {
+	// Limits the edits running at the same time.
+	slots chan struct{}
+	// The maximum size of a request in bytes.
+	maxUpload int64
+}
+
+// runServe implements `androidmanifest-changer serve`, an HTTP service for build farms: POST an APK
+// or AAB and a change set to /edit and get the edited artifact back.
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: androidmanifest-changer serve [flags]")
+		flags.PrintDefaults()
+	}
+	listen := flags.String("listen", "127.0.0.1:8080", "The address to listen on. The API has no authentication, so only expose it to trusted networks")
+	jobs := flags.Int("jobs", runtime.NumCPU(), "Edit up to this many artifacts at the same time, further requests wait")
+	maxUploadMB := flags.Int64("max-upload-mb", 1024, "Reject requests larger than this many MiB")
+	flags.StringVar(&aapt2Path, "aapt2", "", "The aapt2 binary to use for binary APKs (default: $AAPT2_PATH, $AAPT2, aapt2 in PATH or in the newest build-tools of $ANDROID_HOME)")
+	flags.StringVar(&buildToolsVersion, "build-tools", "", "Take aapt2 from this version of the SDK's build-tools, e.g. 34.0.0")
+	flags.BoolVar(&nativeAxml, "native-axml", false, "Convert APK manifests with the built-in binary XML codec instead of aapt2 (experimental)")
+	flags.StringVar(&tmpDir, "tmpdir", tmpDir, "The directory for the uploaded artifacts while they're edited")
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		fatalUsage("serve doesn't take files, they're uploaded to /edit")
+	}
+	if *jobs < 1 {
+		fatalUsage("-jobs must be at least 1")
+	}
+	if *maxUploadMB < 1 {
+		fatalUsage("-max-upload-mb must be at least 1")
+	}
+	if err := checkTmpDir(); err != nil {
+		fatalUsage("Invalid -tmpdir:", err)
+	}
+	if err := checkBuildTools(); err != nil {
+		fatalUsage("Invalid -build-tools:", err)
+	}
+	removeTempOnInterrupt()
+	resolveAapt2Path()
+	if !nativeAxml {
+		if err := checkAapt2(); err != nil {
+			warnf("%v. Only AABs and proto APKs can be edited.", err)
+		}
+	}
+
+	s := &server{slots: make(chan struct{}, *jobs), maxUpload: *maxUploadMB << 20}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/edit", s.handleEdit)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	log.Printf("Listening on %s", *listen)
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		log.Println(err)
+		exit(1)
+	}
+}
+
+// handleEdit edits the uploaded artifact with the change set. The request is a multipart form with
+// the artifact as "file" and the change set as "changes", a JSON object like a -config file. The
+// response is the edited artifact, with X-Manifest-Status set to updated or unchanged and
+// X-Manifest-Changes to the number of changed attributes. Errors are plain text: 400 for a bad
+// request and 422 if the edit fails, with the diagnostics of the run.
+func (s *server) handleEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST an artifact and a change set to /edit", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("missing the artifact in the form field file: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	defer r.MultipartForm.RemoveAll()
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	if ext != ".apk" && ext != ".aab" {
+		http.Error(w, fmt.Sprintf("%s isn't an .apk or .aab file", header.Filename), http.StatusBadRequest)
+		return
+	}
+	changes, err := formPart(r, "changes")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkChangeSet(changes); err != nil {
+		http.Error(w, fmt.Sprintf("invalid change set: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.slots <- struct{}{}
+	defer func() { <-s.slots }()
+	artifact, err := createTemp(tmpDir, "upload.*"+ext)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer removeTemp(artifact)
+	if _, err := io.Copy(artifact, file); err != nil {
+		http.Error(w, fmt.Sprintf("failed writing temp file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	config, err := createTemp(tmpDir, "changes.*.json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer removeTemp(config)
+	if _, err := config.Write(changes); err != nil {
+		http.Error(w, fmt.Sprintf("failed writing temp file: %v", err), http.StatusInternalServerError)
+		return
+	}
+	artifact.Close()
+	config.Close()
+
+	out, result := runEdit(r, artifact.Name(), config.Name())
+	if result.err != nil {
+		log.Printf("Editing %s failed: %v", header.Filename, result.err)
+		http.Error(w, fmt.Sprintf("%v\n%s", result.err, out), http.StatusUnprocessableEntity)
+		return
+	}
+	edited, err := os.Open(artifact.Name())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer edited.Close()
+	log.Printf("Edited %s: %s with %d changes", header.Filename, result.file.Status, len(result.file.Changes))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(header.Filename)))
+	w.Header().Set("X-Manifest-Status", result.file.Status)
+	w.Header().Set("X-Manifest-Changes", fmt.Sprint(len(result.file.Changes)))
+	io.Copy(w, edited)
+}
+
+// formPart returns the form value or uploaded file called name.
+func formPart(r *http.Request, name string) ([]byte, error) {
+	if values := r.MultipartForm.Value[name]; len(values) > 0 {
+		return []byte(values[0]), nil
+	}
+	headers := r.MultipartForm.File[name]
+	if len(headers) == 0 {
+		return nil, fmt.Errorf("missing the change set in the form field %s", name)
+	}
+	part, err := headers[0].Open()
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+	return io.ReadAll(part)
+}
+
+// checkChangeSet rejects change sets that aren't a JSON object, use a flag that isn't one of the
+// serveAllowedFlags or have a value with an {env:NAME} placeholder, which would be expanded with the
+// server's environment and return its secrets in the manifest.
+func checkChangeSet(data []byte) error {
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	for name, value := range values {
+		if !slices.Contains(serveAllowedFlags, name) {
+			return fmt.Errorf("%s can't be used with the serve command", name)
+		}
+		if readsEnv(value) {
+			return fmt.Errorf("%s can't use {env:NAME} with the serve command, it would read the server's environment", name)
+		}
+	}
+	return nil
+}
+
+// readsEnv reports whether a change set value or one of the values of a list has an {env:NAME}
+// placeholder.
+func readsEnv(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, "{env:")
+	case []any:
+		return slices.ContainsFunc(v, readsEnv)
+	}
+	return false
+}
+
+// runEdit edits the artifact in a child process of this binary, like -jobs does, because the
+// edits are configured by flags, which are global to a process. The child gets the server's aapt2
+// settings and prints its -json report to stdout and everything else to stderr.
+func runEdit(r *http.Request, artifact string, config string) ([]byte, jobResult) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, jobResult{err: fmt.Errorf("failed finding the executable: %w", err)}
+	}
+	args := []string{"-config", config, "-json", "-format=text", "-aapt2", aapt2Path, "-tmpdir", tmpDir, fmt.Sprintf("-native-axml=%t", nativeAxml), "--", artifact}
+	var stdout, stderr bytes.Buffer
+	// A cancelled request, e.g. a client that gave up, kills the edit.
+	cmd := exec.CommandContext(r.Context(), exe, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return stderr.Bytes(), jobResult{err: fmt.Errorf("failed with exit code %d", exitErr.ExitCode())}
+		}
+		return stderr.Bytes(), jobResult{err: fmt.Errorf("failed running %s: %w", exe, err)}
+	}
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil || len(rep.Files) != 1 {
+		return stderr.Bytes(), jobResult{err: errors.New("failed reading the report of the edit")}
+	}
+	return stderr.Bytes(), jobResult{written: rep.Files[0].Status == "updated", file: &rep.Files[0]}
+}
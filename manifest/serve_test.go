@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeEdit(t *testing.T) {
+	// The edit runs in a child process of the test binary, which runs Main, see TestMain.
+	t.Setenv("ANDROIDMANIFEST_CHANGER_MAIN", "1")
+	aab := buildZip(t, zipEntry{name: "BundleConfig.pb"}, zipEntry{name: "base/manifest/AndroidManifest.xml", data: string(protoManifest(t, testManifest)), method: zip.Deflate})
+	s := &server{slots: make(chan struct{}, 1), maxUpload: 1 << 20}
+	tests := []struct {
+		name    string
+		changes string
+		status  int
+		// A substring of the error message.
+		message string
+	}{
+		{"allowed flags", `{"versionCode": 42, "add-permission": ["android.permission.CAMERA"]}`, http.StatusOK, ""},
+		{"not an object", `["versionCode", 42]`, http.StatusBadRequest, "invalid change set"},
+		{"disallowed flag", `{"versionCode": 42, "merge": "/etc/passwd"}`, http.StatusBadRequest, "merge can't be used with the serve command"},
+		{"signing flag", `{"ks": "release.jks"}`, http.StatusBadRequest, "ks can't be used with the serve command"},
+		{"env placeholder", `{"versionName": "{env:HOME}"}`, http.StatusBadRequest, "versionName can't use {env:NAME}"},
+		{"env placeholder in a list", `{"addPermission": ["android.permission.CAMERA", "{env:SECRET}"]}`, http.StatusBadRequest, "addPermission can't use {env:NAME}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			file, err := form.CreateFormFile("file", "app.aab")
+			if err != nil {
+				t.Fatal(err)
+			}
+			file.Write(aab)
+			if err := form.WriteField("changes", tt.changes); err != nil {
+				t.Fatal(err)
+			}
+			if err := form.Close(); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(http.MethodPost, "/edit", &body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			w := httptest.NewRecorder()
+			s.handleEdit(w, r)
+			response, _ := io.ReadAll(w.Result().Body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, response)
+			}
+			if tt.status != http.StatusOK {
+				if !strings.Contains(string(response), tt.message) {
+					t.Errorf("got the error %q, want one with %q", response, tt.message)
+				}
+				return
+			}
+			if status := w.Header().Get("X-Manifest-Status"); status != "updated" {
+				t.Errorf("X-Manifest-Status %q, want updated", status)
+			}
+			edited := openZip(t, response)
+			manifest := readEntry(t, edited.File[1])
+			if got, _ := manifestAttr(t, []byte(manifest), "", namespace, versionCodeAttr); got != "42" {
+				t.Errorf("versionCode %q, want 42", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package manifest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Secrets are handed to apksigner through these environment variables instead of its command line,
+// which is visible to other users in the process list.
+const (
+	ksPassEnv  = "ANDROIDMANIFEST_CHANGER_KS_PASS"
+	keyPassEnv = "ANDROIDMANIFEST_CHANGER_KEY_PASS"
+)
+
+// signingConfig holds the keystore or the key and certificate for re-signing APKs with apksigner.
+type signingConfig struct {
+	keystore string
+	// A PKCS#8 private key and its X.509 certificate, used instead of keystore.
+	key      string
+	cert     string
+	keyAlias string
+	ksPass   string
+	// Empty if the key password is the same as the keystore password.
+	keyPass string
+	// Run apksigner verify on the signed APK.
+	verify bool
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// readSecret resolves a password given in apksigner's format: pass:<password>, env:<name>,
+// file:<path> (first line of the file) or stdin (first line of stdin).
+func readSecret(s string) (string, error) {
+	source, value, _ := strings.Cut(s, ":")
+	switch source {
+	case "pass":
+		warnf("Passwords given as pass:... are visible in the process list. Prefer env: or file:")
+		return value, nil
+	case "env":
+		secret, ok := os.LookupEnv(value)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", value)
+		}
+		return secret, nil
+	case "file":
+		content, err := os.ReadFile(value)
+		if err != nil {
+			return "", err
+		}
+		return firstLine(string(content)), nil
+	case "stdin":
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading password from stdin: %w", err)
+		}
+		return firstLine(line), nil
+	}
+	return "", errors.New("expected pass:<password>, env:<name>, file:<path> or stdin")
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return strings.TrimSuffix(line, "\r")
+}
+
+// signApk signs the APK in place with apksigner, which replaces any existing signatures.
+func signApk(path string, signing *signingConfig) error {
+	args := []string{"sign"}
+	env := os.Environ()
+	signer := signing.keystore
+	if signing.key != "" {
+		args = append(args, "--key", signing.key, "--cert", signing.cert)
+		signer = signing.key
+	} else {
+		args = append(args, "--ks", signing.keystore, "--ks-pass", "env:"+ksPassEnv)
+		env = append(env, ksPassEnv+"="+signing.ksPass)
+	}
+	if signing.keyAlias != "" {
+		args = append(args, "--ks-key-alias", signing.keyAlias)
+	}
+	if signing.keyPass != "" {
+		args = append(args, "--key-pass", "env:"+keyPassEnv)
+		env = append(env, keyPassEnv+"="+signing.keyPass)
+	}
+	cmd := exec.CommandContext(runCtx, apksignerPath, append(args, path)...)
+	cmd.Env = env
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed executing apksigner: %w\n%s", err, output)
+	}
+	fmt.Println("Signed the APK with", signer)
+	if signing.verify {
+		return verifyApk(path)
+	}
+	return nil
+}
+
+// signFiles implements the sign command, which re-signs APKs without editing them.
+func signFiles(paths []string, signing *signingConfig) error {
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".apk") {
+			return fmt.Errorf("%s: only APKs can be signed, sign AABs with jarsigner", path)
+		}
+		if proto, err := isProtoApk(path); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		} else if proto {
+			return fmt.Errorf("%s: proto APKs can't be signed, convert them to binary with aapt2 first", path)
+		}
+		if err := signApk(path, signing); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// verifyApk fails if apksigner doesn't accept the APK's signatures.
+func verifyApk(path string) error {
+	output, err := exec.CommandContext(runCtx, apksignerPath, "verify", "--verbose", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("signature verification failed: %w\n%s", err, output)
+	}
+	fmt.Println("Verified the APK's signature")
+	return nil
+}
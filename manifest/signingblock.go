@@ -0,0 +1,137 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The APK Signing Block (used by APK Signature Scheme v2 and later) sits between the last local
+// file entry and the central directory. It's not part of the zip structure, so any zip rewrite
+// silently drops it.
+const (
+	apkSigBlockMagic = "APK Sig Block 42"
+	eocdSignature    = 0x06054b50
+	eocdSize         = 22
+)
+
+type zipTail struct {
+	eocdOffset int64
+	cdOffset   int64
+}
+
+func readZipTail(file *os.File) (*zipTail, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	// The EOCD is followed by a comment of at most 65535 bytes.
+	bufSize := min(size, eocdSize+0xffff)
+	buf := make([]byte, bufSize)
+	if _, err := file.ReadAt(buf, size-bufSize); err != nil {
+		return nil, err
+	}
+	for i := len(buf) - eocdSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) != eocdSignature {
+			continue
+		}
+		cdOffset := binary.LittleEndian.Uint32(buf[i+16:])
+		if cdOffset == 0xffffffff {
+			return nil, errors.New("zip64 archives are not supported")
+		}
+		return &zipTail{eocdOffset: size - bufSize + int64(i), cdOffset: int64(cdOffset)}, nil
+	}
+	return nil, errors.New("end of central directory not found")
+}
+
+// readSigningBlock returns the APK Signing Block of the given APK or nil if there is none.
+func readSigningBlock(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening APK: %w", err)
+	}
+	defer file.Close()
+
+	tail, err := readZipTail(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading APK's central directory: %w", err)
+	}
+	// The block ends with its size (uint64) followed by the magic.
+	footer := make([]byte, 24)
+	if tail.cdOffset < int64(len(footer)) {
+		return nil, nil
+	}
+	if _, err := file.ReadAt(footer, tail.cdOffset-int64(len(footer))); err != nil {
+		return nil, fmt.Errorf("failed reading APK: %w", err)
+	}
+	if !bytes.Equal(footer[8:], []byte(apkSigBlockMagic)) {
+		return nil, nil
+	}
+	// The size doesn't include the leading size field itself.
+	blockSize := int64(binary.LittleEndian.Uint64(footer)) + 8
+	if blockSize > tail.cdOffset {
+		return nil, fmt.Errorf("invalid APK Signing Block size %d", blockSize)
+	}
+	block := make([]byte, blockSize)
+	if _, err := file.ReadAt(block, tail.cdOffset-blockSize); err != nil {
+		return nil, fmt.Errorf("failed reading APK Signing Block: %w", err)
+	}
+	return block, nil
+}
+
+// insertSigningBlock places the block directly in front of the central directory of the given zip
+// and updates the central directory offset accordingly.
+func insertSigningBlock(path string, block []byte) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed opening APK: %w", err)
+	}
+	defer src.Close()
+
+	tail, err := readZipTail(src)
+	if err != nil {
+		return fmt.Errorf("failed reading APK's central directory: %w", err)
+	}
+	eocd := make([]byte, eocdSize)
+	if _, err := src.ReadAt(eocd, tail.eocdOffset); err != nil {
+		return fmt.Errorf("failed reading APK: %w", err)
+	}
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(tail.cdOffset+int64(len(block))))
+
+	dst, err := createTempSibling(path)
+	if err != nil {
+		return err
+	}
+	defer removeTemp(dst)
+
+	_, err = io.Copy(dst, io.NewSectionReader(src, 0, tail.cdOffset))
+	if err == nil {
+		_, err = dst.Write(block)
+	}
+	if err == nil {
+		_, err = io.Copy(dst, io.NewSectionReader(src, tail.cdOffset, tail.eocdOffset-tail.cdOffset))
+	}
+	if err == nil {
+		_, err = dst.Write(eocd)
+	}
+	if err == nil {
+		// Copy the archive comment.
+		_, err = io.Copy(dst, io.NewSectionReader(src, tail.eocdOffset+eocdSize, 0xffff))
+	}
+	if err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("failed writing APK Signing Block: %w", err)
+	}
+	src.Close()
+	if err := renameSynced(dst.Name(), path); err != nil {
+		return fmt.Errorf("failed replacing APK: %w", err)
+	}
+	fmt.Println("Preserved APK Signing Block of", len(block), "bytes (its signatures are invalid now)")
+	return nil
+}
@@ -0,0 +1,125 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// splitName returns the split attribute of a split APK's manifest, e.g. config.arm64_v8a, or ""
+// for a base or standalone APK.
+func splitName(root *XmlElement) string {
+	if attr := findAttr(root, "", "split"); attr != nil {
+		return attrValue(attr)
+	}
+	return ""
+}
+
+// splitAPK is the part of a split APK's manifest that adb install-multiple compares with the base.
+type splitAPK struct {
+	path           string
+	split          string
+	configForSplit string
+	versionCode    string
+}
+
+// checkSplitSets reads the edited APKs of a run and fails if the splits no longer install together
+// with their base APK: a split needs a base with the same package in the run, the same versionCode,
+// and its configForSplit has to name a split of the set. The check only runs if the run has splits.
+func checkSplitSets(paths []string) error {
+	sets := map[string][]splitAPK{}
+	var packages []string
+	hasSplits := false
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".apk") {
+			continue
+		}
+		root, err := readApkManifestRoot(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		apk := splitAPK{path: path, split: splitName(root)}
+		if attr := findAttr(root, "", "configForSplit"); attr != nil {
+			apk.configForSplit = attrValue(attr)
+		}
+		if attr := findAttr(root, namespace, versionCodeAttr); attr != nil {
+			apk.versionCode = attrValue(attr)
+		}
+		hasSplits = hasSplits || apk.split != ""
+		pkg := packageName(root)
+		if _, ok := sets[pkg]; !ok {
+			packages = append(packages, pkg)
+		}
+		sets[pkg] = append(sets[pkg], apk)
+	}
+	if !hasSplits {
+		return nil
+	}
+	var problems []string
+	for _, pkg := range packages {
+		problems = append(problems, checkSplitSet(pkg, sets[pkg])...)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the split APKs won't install together: %s", strings.Join(problems, "; "))
+	}
+	fmt.Println("Split APKs are consistent with their base APKs")
+	return nil
+}
+
+// checkSplitSet returns the problems of the APKs with the package pkg.
+func checkSplitSet(pkg string, apks []splitAPK) []string {
+	baseIndex := slices.IndexFunc(apks, func(apk splitAPK) bool { return apk.split == "" })
+	var problems []string
+	if baseIndex < 0 {
+		for _, apk := range apks {
+			problems = append(problems, fmt.Sprintf("%s is a split of %s, but no base APK of the run has that package", apk.path, pkg))
+		}
+		return problems
+	}
+	base := apks[baseIndex]
+	splits := map[string]bool{}
+	for _, apk := range apks {
+		if apk.split == "" {
+			continue
+		}
+		if splits[apk.split] {
+			problems = append(problems, fmt.Sprintf("%s is the split %s of %s a second time", apk.path, apk.split, pkg))
+		}
+		splits[apk.split] = true
+	}
+	for _, apk := range apks {
+		if apk.split == "" {
+			if apk.path != base.path {
+				problems = append(problems, fmt.Sprintf("%s and %s are both base APKs of %s", base.path, apk.path, pkg))
+			}
+			continue
+		}
+		if apk.versionCode != base.versionCode {
+			problems = append(problems, fmt.Sprintf("%s has the versionCode %s, but its base %s has %s", apk.path, apk.versionCode, base.path, base.versionCode))
+		}
+		if apk.configForSplit != "" && !splits[apk.configForSplit] {
+			problems = append(problems, fmt.Sprintf("%s is a config split for %s, which isn't part of the set", apk.path, apk.configForSplit))
+		}
+	}
+	return problems
+}
+
+// readApkManifestRoot returns the root element of an APK's manifest, decoding binary XML with the
+// built-in codec, so no aapt2 run is needed for the attributes of the root.
+func readApkManifestRoot(path string) (*XmlElement, error) {
+	data, err := readFromZip(path, "AndroidManifest.xml")
+	if err != nil {
+		return nil, err
+	}
+	var xmlNode *XmlNode
+	if bytes.HasPrefix(data, binaryXMLHeader) {
+		xmlNode, err = decodeBinaryXML(data)
+	} else {
+		xmlNode, err = parseManifest(data)
+	}
+	if err != nil {
+		return nil, withExitCode(exitParse, fmt.Errorf("failed to parse manifest: %w", err))
+	}
+	return xmlNode.GetElement(), nil
+}
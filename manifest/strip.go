@@ -0,0 +1,91 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// stripPattern is a -strip-permission or -strip-component regular expression, which has to match
+// the whole name.
+type stripPattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+func parseStripPattern(s string) (stripPattern, error) {
+	if _, err := regexp.Compile(s); err != nil {
+		return stripPattern{}, err
+	}
+	return stripPattern{source: s, re: regexp.MustCompile(`^(?:` + s + `)$`)}, nil
+}
+
+// stripPermissions removes the <uses-permission> and <uses-permission-sdk-23> elements whose
+// permission matches one of the patterns. A pattern that doesn't match anything is a warning.
+func (e *manifestEditor) stripPermissions(patterns []stripPattern) {
+	matched := make([]bool, len(patterns))
+	e.removeChildren(e.root, func(element *XmlElement) bool {
+		if element.GetName() != "uses-permission" && element.GetName() != "uses-permission-sdk-23" {
+			return false
+		}
+		i := matchPattern(patterns, componentName(element))
+		if i < 0 {
+			return false
+		}
+		matched[i] = true
+		fmt.Println("Removing", element.GetName(), componentName(element))
+		return true
+	})
+	e.warnUnmatched(patterns, matched, "permission")
+}
+
+// stripComponents removes the components below <application> whose fully qualified class name
+// matches one of the patterns, e.g. the activities and services of an advertising SDK. Activity
+// aliases pointing to a removed activity are removed too, because the platform rejects them.
+func (e *manifestEditor) stripComponents(patterns []stripPattern) {
+	application := childElement(e.root, "application")
+	pkg := e.inputPackage
+	matched := make([]bool, len(patterns))
+	var removed []string
+	e.removeChildren(application, func(element *XmlElement) bool {
+		if !isComponentType(element.GetName()) {
+			return false
+		}
+		name := resolveClassName(pkg, componentName(element))
+		i := matchPattern(patterns, name)
+		if i < 0 {
+			return false
+		}
+		matched[i] = true
+		removed = append(removed, name)
+		fmt.Println("Removing", element.GetName(), name)
+		return true
+	})
+	e.removeChildren(application, func(element *XmlElement) bool {
+		target := findAttr(element, namespace, "targetActivity")
+		if element.GetName() != "activity-alias" || target == nil || !slices.Contains(removed, resolveClassName(pkg, attrValue(target))) {
+			return false
+		}
+		fmt.Println("Removing activity-alias", resolveClassName(pkg, componentName(element)), "of the removed", resolveClassName(pkg, attrValue(target)))
+		return true
+	})
+	e.warnUnmatched(patterns, matched, "component")
+}
+
+// matchPattern returns the index of the first pattern matching name, or -1.
+func matchPattern(patterns []stripPattern, name string) int {
+	for i, pattern := range patterns {
+		if pattern.re.MatchString(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *manifestEditor) warnUnmatched(patterns []stripPattern, matched []bool, what string) {
+	for i, pattern := range patterns {
+		if !matched[i] {
+			e.skipf("No %s matches the pattern %s", what, pattern.source)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// textSpan is where an element of a text XML manifest is in the file: the start tag is at
+// [start, startEnd) and the end tag at [end, endEnd), both equal to startEnd for <name/>. The
+// content before the element since its previous sibling starts at leading, and the content after
+// its last child element at childrenEnd.
+type textSpan struct {
+	element                  *XmlElement
+	parent                   *textSpan
+	children                 []*textSpan
+	leading, start, startEnd int
+	childrenEnd, end, endEnd int
+}
+
+// textPos identifies an element by the source position of its node, which the edits keep.
+type textPos struct {
+	line, column uint32
+}
+
+// isTextXMLFile reports whether the file at path looks like a text XML file.
+func isTextXMLFile(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(data, utf8BOM)), []byte("<"))
+}
+
+// updateTextManifest edits a text XML manifest, like the ones in AARs and source trees. Only the
+// attributes and elements that changed are rewritten, everything else, like comments,
+// whitespace and the order of attributes, stays as it was. It's only written if something
+// changed. References by name are kept, aapt2 resolves them when it compiles the manifest.
+func updateTextManifest(path string, config *editConfig) ([]change, bool, error) {
+	in, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading file: %w", err)
+	}
+	data := bytes.TrimPrefix(in, utf8BOM)
+	spans := map[textPos]*textSpan{}
+	xmlNode, err := decodeTextManifest(data, spans)
+	if err != nil {
+		return nil, false, withExitCode(exitParse, fmt.Errorf("failed to parse text XML manifest: %w", err))
+	}
+	if root := xmlNode.GetElement(); root.GetName() != "manifest" || root.GetNamespaceUri() != "" {
+		return nil, false, withExitCode(exitParse, fmt.Errorf("failed to parse text XML manifest: expected a <manifest> root element but got <%s>", root.GetName()))
+	}
+	textConfig := *config
+	textConfig.textXML = true
+	changes, edited, err := editDecodedManifest(xmlNode, &textConfig)
+	if err != nil || edited == nil {
+		return changes, false, err
+	}
+	w := &textWriter{src: data, spans: spans, used: map[*textSpan]bool{}}
+	w.out.Write(in[:len(in)-len(data)])
+	span := spans[textPos{}]
+	w.out.Write(data[:span.start])
+	w.writeElement(span, edited.GetElement(), map[string]string{}, map[string]string{})
+	w.out.Write(data[span.endEnd:])
+	if err := replaceFile(path, w.out.Bytes()); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// updateAar edits the text XML manifest of an Android library (.aar). Libraries aren't signed and
+// have no compiled resources, so only the manifest entry is replaced.
+func updateAar(path string, config *editConfig) ([]change, bool, error) {
+	if config.signing != nil {
+		warnf("Not signing %s, AARs aren't signed", path)
+	}
+	if len(config.stringSets) > 0 || len(config.labelLocales) > 0 {
+		warnf("Not changing string resources, %s has no compiled resource table", path)
+	}
+	if config.embedProvenance {
+		warnf("-embed-provenance only applies to APKs and AABs")
+	}
+	manifest, err := createTemp(tmpDir, "AndroidManifest.*.xml")
+	if err != nil {
+		return nil, false, err
+	}
+	defer removeTemp(manifest)
+	if err := extractFromZip(path, "AndroidManifest.xml", manifest); err != nil {
+		return nil, false, err
+	}
+	if err := manifest.Close(); err != nil {
+		return nil, false, fmt.Errorf("failed writing temp file: %w", err)
+	}
+	changes, written, err := updateTextManifest(manifest.Name(), config)
+	if err != nil || !written {
+		return changes, false, err
+	}
+	source, err := os.Open(manifest.Name())
+	if err != nil {
+		return nil, false, fmt.Errorf("failed reading temp file: %w", err)
+	}
+	defer source.Close()
+	if err := addToZipNative(path, "AndroidManifest.xml", source, nil, nil); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// textWriter writes an edited text XML manifest by copying the original file where the edits
+// didn't change anything.
+type textWriter struct {
+	src   []byte
+	spans map[textPos]*textSpan
+	// The spans already written, so an element cloned with its source position is only
+	// copied once.
+	used map[*textSpan]bool
+	out  bytes.Buffer
+}
+
+// span returns where the original of the edited node is, or nil for an added element.
+func (w *textWriter) span(node *XmlNode) *textSpan {
+	source := node.GetSource()
+	if source == nil {
+		return nil
+	}
+	span := w.spans[textPos{source.GetLineNumber(), source.GetColumnNumber()}]
+	if span == nil || w.used[span] {
+		return nil
+	}
+	w.used[span] = true
+	return span
+}
+
+// writeElement writes the edited element whose original is at span. uris maps the prefixes the
+// original file declares to their namespace URI, prefixes the namespace URIs of the edited
+// manifest to their prefix.
+func (w *textWriter) writeElement(span *textSpan, element *XmlElement, uris map[string]string, prefixes map[string]string) {
+	uris, prefixes = scopeNamespaces(uris, prefixes, span.element, element)
+	tag := w.startTag(span, element, uris, prefixes)
+	selfClosing := span.startEnd == span.endEnd
+	hasChildren := false
+	for _, child := range element.GetChild() {
+		hasChildren = hasChildren || child.GetElement() != nil
+	}
+	if selfClosing && !hasChildren {
+		w.out.WriteString(tag)
+		return
+	}
+	if selfClosing {
+		tag = strings.TrimRight(strings.TrimSuffix(tag, "/>"), " \t\r\n") + ">"
+	}
+	w.out.WriteString(tag)
+
+	indent := w.indent(span.start)
+	childIndent := indent + "    "
+	if len(span.children) > 0 {
+		childIndent = w.indent(span.children[0].start)
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() == nil {
+			continue
+		}
+		if childSpan := w.span(child); childSpan != nil && childSpan.parent == span {
+			w.out.Write(w.src[childSpan.leading:childSpan.start])
+			w.writeElement(childSpan, child.GetElement(), uris, prefixes)
+			continue
+		}
+		var added bytes.Buffer
+		writeXMLElement(&added, child.GetElement(), prefixes, 0)
+		w.out.WriteString("\n" + childIndent)
+		w.out.WriteString(strings.ReplaceAll(strings.TrimSuffix(added.String(), "\n"), "\n", "\n"+childIndent))
+	}
+	trailing := ""
+	if !selfClosing {
+		trailing = string(w.src[span.childrenEnd:span.end])
+	}
+	if selfClosing || hasChildren && span.childrenEnd == span.startEnd && strings.TrimSpace(trailing) == "" {
+		trailing = "\n" + indent
+	}
+	w.out.WriteString(trailing)
+	if selfClosing {
+		w.out.WriteString("</" + tag[1:tagNameEnd(tag)] + ">")
+	} else {
+		w.out.Write(w.src[span.end:span.endEnd])
+	}
+}
+
+// indent returns the whitespace the line of offset starts with.
+func (w *textWriter) indent(offset int) string {
+	line := w.src[:offset]
+	if i := bytes.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+	if len(bytes.TrimLeft(line, " \t")) > 0 {
+		return ""
+	}
+	return string(line)
+}
+
+// scopeNamespaces adds the namespace declarations of the original and the edited element to the
+// maps of their ancestors.
+func scopeNamespaces(uris map[string]string, prefixes map[string]string, original *XmlElement, edited *XmlElement) (map[string]string, map[string]string) {
+	if len(original.GetNamespaceDeclaration()) > 0 {
+		scoped := map[string]string{}
+		for prefix, uri := range uris {
+			scoped[prefix] = uri
+		}
+		for _, decl := range original.GetNamespaceDeclaration() {
+			scoped[decl.GetPrefix()] = decl.GetUri()
+		}
+		uris = scoped
+	}
+	if len(edited.GetNamespaceDeclaration()) > 0 {
+		scoped := map[string]string{}
+		for uri, prefix := range prefixes {
+			scoped[uri] = prefix
+		}
+		for _, decl := range edited.GetNamespaceDeclaration() {
+			scoped[decl.GetUri()] = decl.GetPrefix()
+		}
+		prefixes = scoped
+	}
+	return uris, prefixes
+}
+
+// startTag returns the original start tag with the attribute changes of element: changed values
+// are replaced in place, removed attributes are cut out and added ones go after the last
+// attribute, separated like it.
+func (w *textWriter) startTag(span *textSpan, element *XmlElement, uris map[string]string, prefixes map[string]string) string {
+	tag := string(w.src[span.start:span.startEnd])
+	attrs := scanStartTag(tag)
+	var b strings.Builder
+	cursor := 0
+	written := map[string]bool{}
+	declared := map[string]bool{}
+	for _, a := range attrs {
+		if a.name == "xmlns" || strings.HasPrefix(a.name, "xmlns:") {
+			_, prefix, _ := strings.Cut(a.name, ":")
+			declared[prefix] = true
+			if !hasNamespacePrefix(element, prefix) && prefix != "" {
+				b.WriteString(tag[cursor:a.start])
+				cursor = a.end
+			}
+			continue
+		}
+		uri, name := resolveTextName(uris, a.name)
+		written[uri+" "+name] = true
+		old, attr := findAttr(span.element, uri, name), findAttr(element, uri, name)
+		switch {
+		case attr == nil:
+			b.WriteString(tag[cursor:a.start])
+			cursor = a.end
+		case old == nil || attrValue(old) != attrValue(attr):
+			b.WriteString(tag[cursor:a.valueStart])
+			b.WriteString(escapeXML(attrValue(attr)))
+			cursor = a.valueEnd
+		}
+	}
+	insertAt, sep := tagNameEnd(tag), " "
+	if len(attrs) > 0 {
+		last := attrs[len(attrs)-1]
+		insertAt, sep = last.end, tag[last.start:last.nameStart]
+	}
+	b.WriteString(tag[cursor:insertAt])
+	for _, decl := range element.GetNamespaceDeclaration() {
+		if !declared[decl.GetPrefix()] {
+			fmt.Fprintf(&b, "%sxmlns:%s=\"%s\"", sep, decl.GetPrefix(), escapeXML(decl.GetUri()))
+		}
+	}
+	for _, attr := range element.GetAttribute() {
+		if written[attr.GetNamespaceUri()+" "+attr.GetName()] {
+			continue
+		}
+		name := attr.GetName()
+		if uri := attr.GetNamespaceUri(); uri != "" {
+			prefix, ok := prefixes[uri]
+			if !ok && uri == namespace {
+				prefix = "android"
+			} else if !ok {
+				prefix = uri
+			}
+			name = prefix + ":" + name
+		}
+		fmt.Fprintf(&b, "%s%s=\"%s\"", sep, name, escapeXML(attrValue(attr)))
+	}
+	b.WriteString(tag[insertAt:])
+	return b.String()
+}
+
+func hasNamespacePrefix(element *XmlElement, prefix string) bool {
+	for _, decl := range element.GetNamespaceDeclaration() {
+		if decl.GetPrefix() == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveTextName returns the namespace URI and local name of an attribute name as written in the
+// file. An undeclared android: prefix is the android namespace, like for -merge overlays.
+func resolveTextName(uris map[string]string, qualified string) (string, string) {
+	prefix, name, ok := strings.Cut(qualified, ":")
+	if !ok {
+		return "", qualified
+	}
+	if uri, ok := uris[prefix]; ok {
+		return uri, name
+	}
+	if prefix == "android" {
+		return namespace, name
+	}
+	return prefix, name
+}
+
+// tagAttr is where an attribute is in a start tag: the whitespace before it starts at start, its
+// value without the quotes is at [valueStart, valueEnd) and the closing quote ends at end.
+type tagAttr struct {
+	name                                        string
+	start, nameStart, valueStart, valueEnd, end int
+}
+
+// scanStartTag returns the attributes of a start tag like <name a="1" b='2'/>. The tag was parsed
+// by encoding/xml already, so it's well-formed.
+func scanStartTag(tag string) []tagAttr {
+	var attrs []tagAttr
+	i := tagNameEnd(tag)
+	for {
+		a := tagAttr{start: i}
+		for i < len(tag) && isXMLSpace(tag[i]) {
+			i++
+		}
+		if i >= len(tag) || tag[i] == '/' || tag[i] == '>' {
+			return attrs
+		}
+		a.nameStart = i
+		for tag[i] != '=' && !isXMLSpace(tag[i]) {
+			i++
+		}
+		a.name = tag[a.nameStart:i]
+		for tag[i] != '"' && tag[i] != '\'' {
+			i++
+		}
+		a.valueStart = i + 1
+		a.valueEnd = a.valueStart + strings.IndexByte(tag[a.valueStart:], tag[i])
+		a.end = a.valueEnd + 1
+		i = a.end
+		attrs = append(attrs, a)
+	}
+}
+
+// tagNameEnd returns where the element name of a start tag ends.
+func tagNameEnd(tag string) int {
+	i := 1
+	for i < len(tag) && !isXMLSpace(tag[i]) && tag[i] != '/' && tag[i] != '>' {
+		i++
+	}
+	return i
+}
+
+func isXMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
@@ -0,0 +1,83 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// timeoutExitCode is the exit code when -timeout expires, the same as GNU timeout's.
+const timeoutExitCode = 124
+
+// interruptExitCode is the exit code after SIGINT or SIGTERM, the shell's 128 + SIGINT.
+const interruptExitCode = 130
+
+// runCtx is cancelled when -timeout expires. All subprocesses are started with it.
+var runCtx = context.Background()
+
+// tempFiles tracks the temp files that still exist, so they can be removed when the run is aborted.
+var tempFiles = struct {
+	sync.Mutex
+	paths map[string]bool
+}{paths: map[string]bool{}}
+
+// createTemp is like os.CreateTemp, but registers the file for cleanup by exit.
+func createTemp(dir string, pattern string) (*os.File, error) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating temp file: %w", err)
+	}
+	tempFiles.paths[file.Name()] = true
+	return file, nil
+}
+
+// removeTemp removes a file created by createTemp unless it was renamed already. It's closed
+// first, because Windows can't remove open files.
+func removeTemp(file *os.File) {
+	tempFiles.Lock()
+	defer tempFiles.Unlock()
+	file.Close()
+	os.Remove(file.Name())
+	delete(tempFiles.paths, file.Name())
+}
+
+// startTimeout aborts the run after d: running subprocesses are killed, temp files are removed
+// and the process exits with timeoutExitCode. Files are only ever replaced by renaming a complete
+// temp file, so the input is either fully updated or untouched.
+func startTimeout(d time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runCtx = ctx
+	time.AfterFunc(d, func() {
+		cancel()
+		fmt.Fprintln(os.Stderr, "Timed out after", d)
+		exit(timeoutExitCode)
+	})
+}
+
+// removeTempOnInterrupt makes SIGINT and SIGTERM remove the temp files before exiting. The input
+// files are safe anyway, because they're only replaced by renaming.
+func removeTempOnInterrupt() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		fmt.Fprintln(os.Stderr, "Aborted by", sig)
+		exit(interruptExitCode)
+	}()
+}
+
+// exit is os.Exit, which skips the deferred removals, after removing the remaining temp files.
+func exit(code int) {
+	// Keep the lock, so no new temp files are created while exiting.
+	tempFiles.Lock()
+	for path := range tempFiles.paths {
+		os.Remove(path)
+	}
+	os.Exit(code)
+}
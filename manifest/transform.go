@@ -0,0 +1,127 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Transformer is a custom rewrite of the whole manifest, applied after the built-in edits. Rewrites
+// that don't fit a flag implement it, like -script does with an external program.
+type Transformer interface {
+	Transform(*XmlNode) error
+}
+
+// scriptTransformer runs a -script command, which reads the manifest as text XML from stdin and
+// writes the rewritten manifest to stdout. Its stderr is passed through.
+type scriptTransformer struct {
+	command string
+}
+
+func parseScript(command string) (scriptTransformer, error) {
+	if len(strings.Fields(command)) == 0 {
+		return scriptTransformer{}, errors.New("the command is empty")
+	}
+	return scriptTransformer{command: command}, nil
+}
+
+func (t scriptTransformer) Transform(xmlNode *XmlNode) error {
+	var in bytes.Buffer
+	fmt.Fprintln(&in, `<?xml version="1.0" encoding="utf-8"?>`)
+	writeXMLElement(&in, xmlNode.GetElement(), map[string]string{}, 0)
+	args := strings.Fields(t.command)
+	var out bytes.Buffer
+	cmd := exec.CommandContext(runCtx, args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = &in, &out, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("-script %s failed: %w", t.command, err)
+	}
+	edited, err := parseTextManifest(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("-script %s printed an invalid manifest: %w", t.command, err)
+	}
+	if edited.GetName() != "manifest" || edited.GetNamespaceUri() != "" {
+		return fmt.Errorf("-script %s printed <%s> instead of a <manifest>", t.command, edited.GetName())
+	}
+	original := xmlNode.GetElement()
+	restoreCompiled(original, edited)
+	diffs := diffElement(original, edited, original, edited, original.GetName())
+	for _, d := range diffs {
+		switch d.Kind {
+		case "added":
+			fmt.Printf("Script %s: adding %s%s\n", t.command, d.Path, valueSuffix(d.New))
+		case "removed":
+			fmt.Printf("Script %s: removing %s%s\n", t.command, d.Path, valueSuffix(d.Old))
+		default:
+			fmt.Printf("Script %s: changing %s from %s to %s\n", t.command, d.Path, d.Old, d.New)
+		}
+	}
+	if len(diffs) == 0 {
+		notef("-script %s didn't change the manifest", t.command)
+		return nil
+	}
+	xmlNode.Node = &XmlNode_Element{Element: edited}
+	return nil
+}
+
+// restoreCompiled carries the compiled values, resource IDs and source positions of the original
+// manifest over to the text XML the script printed, in which the attributes the built-in tables
+// don't know are plain strings. Unchanged attributes are copied as they were. Changed ones keep the
+// resource ID of the original, and its type if the tables don't know it. Children are matched like
+// the diff command does.
+func restoreCompiled(original *XmlElement, edited *XmlElement) {
+	for i, attr := range edited.GetAttribute() {
+		old := findAttr(original, attr.GetNamespaceUri(), attr.GetName())
+		if old == nil {
+			continue
+		}
+		if attrValue(old) == attr.GetValue() || attrValue(old) == attrValue(attr) {
+			edited.Attribute[i] = proto.Clone(old).(*XmlAttribute)
+			continue
+		}
+		if attr.GetResourceId() == 0 {
+			attr.ResourceId = old.GetResourceId()
+		}
+		if attr.GetCompiledItem() == nil && old.GetCompiledItem() != nil && !isKnownAttr(attr) {
+			// A value that doesn't fit the original type stays a string.
+			typed := proto.Clone(attr).(*XmlAttribute)
+			typed.CompiledItem = old.GetCompiledItem()
+			if setAttrValue(typed, inferAttrType(old, untypedAttr), attr.GetValue()) == nil {
+				edited.Attribute[i] = typed
+			}
+		}
+	}
+	originalChildren, _ := diffChildren(original)
+	editedChildren, keys := diffChildren(edited)
+	for _, key := range keys {
+		if old, ok := originalChildren[key]; ok {
+			restoreCompiled(old, editedChildren[key])
+			childNode(edited, editedChildren[key]).Source = childNode(original, old).GetSource()
+		}
+	}
+}
+
+// childNode returns the node of the child element of parent.
+func childNode(parent *XmlElement, element *XmlElement) *XmlNode {
+	for _, child := range parent.GetChild() {
+		if child.GetElement() == element {
+			return child
+		}
+	}
+	return nil
+}
+
+// isKnownAttr reports whether parseTextManifest compiles the attribute with a known type.
+func isKnownAttr(attr *XmlAttribute) bool {
+	if attr.GetNamespaceUri() != namespace {
+		return false
+	}
+	_, known := androidAttrs[attr.GetName()]
+	_, overlay := overlayAttrs[attr.GetName()]
+	return known || overlay
+}
@@ -0,0 +1,100 @@
+package manifest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// assertion is a read-only check of -validate-only. check returns whether the manifest passes and
+// the actual value for the report.
+type assertion struct {
+	desc  string
+	check func(root *XmlElement) (bool, string)
+}
+
+// parseAssertion parses an -assert expression: package=NAME, versionCode>=N, minSdkVersion>=N,
+// targetSdkVersion>=N, not-debuggable or has-launcher.
+func parseAssertion(s string) (assertion, error) {
+	switch s {
+	case "not-debuggable":
+		return assertion{desc: s, check: func(root *XmlElement) (bool, string) {
+			attr := findAttr(childElement(root, "application"), namespace, "debuggable")
+			if attr == nil {
+				return true, "unset"
+			}
+			return attrValue(attr) != "true", attrValue(attr)
+		}}, nil
+	case "has-launcher":
+		return assertion{desc: s, check: func(root *XmlElement) (bool, string) {
+			for _, child := range childElement(root, "application").GetChild() {
+				element := child.GetElement()
+				if (element.GetName() == "activity" || element.GetName() == "activity-alias") && isLauncher(element) {
+					return true, componentName(element)
+				}
+			}
+			return false, "no launcher activity"
+		}}, nil
+	}
+	if name, value, ok := strings.Cut(s, ">="); ok {
+		limit, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return assertion{}, fmt.Errorf("invalid assertion %q: %q is not an integer", s, value)
+		}
+		element := ""
+		switch name {
+		case "versionCode":
+			element = "manifest"
+		case "minSdkVersion", "targetSdkVersion":
+			element = "uses-sdk"
+		default:
+			return assertion{}, fmt.Errorf("invalid assertion %q: only versionCode, minSdkVersion and targetSdkVersion can be compared", s)
+		}
+		return assertion{desc: s, check: func(root *XmlElement) (bool, string) {
+			target := root
+			if element != "manifest" {
+				target = childElement(root, element)
+			}
+			attr := findAttr(target, namespace, name)
+			if attr == nil {
+				return false, "unset"
+			}
+			v, err := strconv.ParseInt(attrValue(attr), 10, 32)
+			return err == nil && v >= limit, attrValue(attr)
+		}}, nil
+	}
+	if name, value, ok := strings.Cut(s, "="); ok && name == "package" {
+		return assertion{desc: s, check: func(root *XmlElement) (bool, string) {
+			return packageName(root) == value, packageName(root)
+		}}, nil
+	}
+	return assertion{}, fmt.Errorf("invalid assertion %q: expected package=NAME, versionCode>=N, minSdkVersion>=N, targetSdkVersion>=N, not-debuggable or has-launcher", s)
+}
+
+// validate runs the assertions against the manifests of the given files without modifying them
+// and fails if any of them doesn't pass.
+func validate(paths []string, assertions []assertion) error {
+	failed, total := 0, 0
+	for _, path := range paths {
+		xmlNode, err := readManifest(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Println("Validating", path)
+		for _, a := range assertions {
+			ok, actual := a.check(xmlNode.GetElement())
+			total++
+			if ok {
+				fmt.Printf("  pass: %s (%s)\n", a.desc, actual)
+			} else {
+				failed++
+				fmt.Printf("  FAIL: %s (got %s)\n", a.desc, actual)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d assertions failed", failed, total)
+	}
+	fmt.Printf("All %d assertions passed\n", total)
+	return nil
+}
@@ -0,0 +1,131 @@
+package manifest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// verifyManifest re-parses the marshalled manifest for -verify and checks what the platform and
+// bundletool need: a valid package, a versionCode above 0, a non-empty versionName and namespaces
+// that are declared where they're used. Secondary manifests only need a versionCode and
+// versionName if they have one.
+func verifyManifest(data []byte, secondary bool) error {
+	xmlNode, err := parseManifest(data)
+	if err != nil {
+		return fmt.Errorf("the manifest can't be parsed: %w", err)
+	}
+	root := xmlNode.GetElement()
+	var problems []string
+	if root.GetName() != "manifest" || root.GetNamespaceUri() != "" {
+		problems = append(problems, fmt.Sprintf("the root element is <%s> instead of <manifest>", qualifiedName(root, root.GetNamespaceUri(), root.GetName())))
+	}
+	if err := checkPackageName(packageName(root)); err != nil {
+		problems = append(problems, fmt.Sprintf("invalid package: %v", err))
+	}
+	if attr := findAttr(root, namespace, versionCodeAttr); attr != nil || !secondary {
+		if v, err := strconv.ParseInt(attrValue(attr), 0, 32); err != nil || v <= 0 || attr.GetCompiledItem().GetPrim() == nil {
+			problems = append(problems, fmt.Sprintf("the versionCode must be a compiled integer above 0, but it's %q", attrValue(attr)))
+		}
+	}
+	if attr := findAttr(root, namespace, versionNameAttr); attr != nil || !secondary {
+		if attrValue(attr) == "" {
+			problems = append(problems, "the versionName is missing or empty")
+		}
+	}
+	problems = append(problems, checkNamespaces(root, root, map[string]string{})...)
+	if len(problems) > 0 {
+		return fmt.Errorf("verification of the manifest failed:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// verifyFiles implements the verify command: it checks the manifests like -verify without
+// modifying anything and then runs the assertions, if any. APKs can also be checked with aapt2
+// dump badging and apksigner verify.
+func verifyFiles(paths []string, assertions []assertion, badging bool, signature bool) error {
+	for _, path := range paths {
+		data, err := readManifestData(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := verifyManifest(data, false); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Println("Verified the manifest of", path)
+		apk := strings.HasSuffix(path, ".apk")
+		if badging && apk {
+			if err := verifyBadging(path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		} else if badging {
+			warnf("aapt2 dump badging only reads APKs, so %s only gets the manifest checks", path)
+		}
+		if signature && apk {
+			if err := verifyApk(path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		} else if signature {
+			warnf("apksigner only verifies APKs, not checking the signature of %s", path)
+		}
+	}
+	if len(assertions) > 0 {
+		return validate(paths, assertions)
+	}
+	return nil
+}
+
+// checkNamespaces reports the namespace URIs of elements and attributes that no enclosing element
+// declares, and android prefixes that aren't bound to the android namespace. declared maps the
+// URIs in scope to their prefix.
+func checkNamespaces(root *XmlElement, element *XmlElement, declared map[string]string) []string {
+	var problems []string
+	if decls := element.GetNamespaceDeclaration(); len(decls) > 0 {
+		scoped := map[string]string{}
+		for uri, prefix := range declared {
+			scoped[uri] = prefix
+		}
+		for _, decl := range decls {
+			if decl.GetPrefix() == "android" && decl.GetUri() != namespace {
+				problems = append(problems, fmt.Sprintf("%s binds the android prefix to %s instead of %s", elementPath(root, element), decl.GetUri(), namespace))
+			}
+			scoped[decl.GetUri()] = decl.GetPrefix()
+		}
+		declared = scoped
+	}
+	check := func(uri string, what string) {
+		if _, ok := declared[uri]; uri != "" && !ok {
+			problems = append(problems, fmt.Sprintf("%s uses the undeclared namespace %s", what, uri))
+		}
+	}
+	check(element.GetNamespaceUri(), elementPath(root, element))
+	for _, attr := range element.GetAttribute() {
+		check(attr.GetNamespaceUri(), fmt.Sprintf("%s/@%s", elementPath(root, element), attr.GetName()))
+	}
+	for _, child := range element.GetChild() {
+		if child.GetElement() != nil {
+			problems = append(problems, checkNamespaces(root, child.GetElement(), declared)...)
+		}
+	}
+	return problems
+}
+
+// verifyBadging runs aapt2 dump badging on the edited APK for -verify-badging, which fails if
+// Android's tooling can't read its manifest.
+func verifyBadging(path string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, aapt2Path, "dump", "badging", path)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return withExitCode(exitAapt2Missing, fmt.Errorf("-verify-badging needs aapt2, but %s can't be executed: %w", aapt2Path, err))
+		}
+		return fmt.Errorf("aapt2 dump badging can't read the edited APK: %w\n%s", err, stderr.String())
+	}
+	fmt.Println("Verified the APK with aapt2 dump badging")
+	return nil
+}
@@ -0,0 +1,141 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// versionPattern derives a versionName from a versionCode. Each run of # in the pattern is a
+// group of that many decimal digits of the code, counted from the right. The leftmost group also
+// takes all remaining digits. Everything else is copied literally. Leading zeros of groups are
+// dropped, so "#.##.##" turns 10203 into 1.2.3.
+type versionPattern struct {
+	// Alternating literal text and group widths: literals[i] precedes widths[i].
+	literals []string
+	widths   []int
+	suffix   string
+}
+
+func parseVersionPattern(s string) (*versionPattern, error) {
+	p := &versionPattern{}
+	var literal strings.Builder
+	for i := 0; i < len(s); {
+		if s[i] != '#' {
+			literal.WriteByte(s[i])
+			i++
+			continue
+		}
+		width := 0
+		for i < len(s) && s[i] == '#' {
+			width++
+			i++
+		}
+		p.literals = append(p.literals, literal.String())
+		p.widths = append(p.widths, width)
+		literal.Reset()
+	}
+	p.suffix = literal.String()
+	if len(p.widths) == 0 {
+		return nil, errors.New("invalid versionName pattern: it needs at least one # digit group, e.g. #.##.##")
+	}
+	return p, nil
+}
+
+func (p *versionPattern) format(code int32) (string, error) {
+	if code < 0 {
+		return "", fmt.Errorf("can't derive a versionName from the negative versionCode %d", code)
+	}
+	digits := strconv.Itoa(int(code))
+	groups := make([]string, len(p.widths))
+	for i := len(p.widths) - 1; i > 0; i-- {
+		width := min(p.widths[i], len(digits))
+		groups[i] = digits[len(digits)-width:]
+		digits = digits[:len(digits)-width]
+	}
+	groups[0] = digits
+	var b strings.Builder
+	for i, group := range groups {
+		b.WriteString(p.literals[i])
+		group = strings.TrimLeft(group, "0")
+		if group == "" {
+			group = "0"
+		}
+		b.WriteString(group)
+	}
+	b.WriteString(p.suffix)
+	return b.String(), nil
+}
+
+// versionTemplate is a -versionName with placeholders: {current} is the manifest's versionName,
+// {versionCode} the versionCode set by this run or else the manifest's and {env:NAME} the
+// environment variable NAME. {{ and }} stand for literal braces.
+type versionTemplate struct {
+	// Alternating literal text and placeholder names: literals[i] precedes placeholders[i].
+	literals     []string
+	placeholders []string
+	suffix       string
+}
+
+// parseVersionTemplate parses the template and substitutes the environment variables right away.
+func parseVersionTemplate(s string) (*versionTemplate, error) {
+	t := &versionTemplate{}
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			literal.WriteByte(s[i])
+			i++
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated placeholder in %q, use {{ for a literal {", s)
+			}
+			name := s[i+1 : i+end]
+			i += end
+			if env, ok := strings.CutPrefix(name, "env:"); ok {
+				value, ok := os.LookupEnv(env)
+				if !ok {
+					return nil, fmt.Errorf("the environment variable %s of {%s} isn't set", env, name)
+				}
+				literal.WriteString(value)
+				continue
+			}
+			if name != "current" && name != "versionCode" {
+				return nil, fmt.Errorf("unknown placeholder {%s}, expected {current}, {versionCode} or {env:NAME}", name)
+			}
+			t.literals = append(t.literals, literal.String())
+			t.placeholders = append(t.placeholders, name)
+			literal.Reset()
+		default:
+			literal.WriteByte(s[i])
+		}
+	}
+	t.suffix = literal.String()
+	return t, nil
+}
+
+func (t *versionTemplate) format(root *XmlElement, config *editConfig) (string, error) {
+	var b strings.Builder
+	for i, name := range t.placeholders {
+		b.WriteString(t.literals[i])
+		switch name {
+		case "current":
+			attr := findAttr(root, namespace, versionNameAttr)
+			if attr == nil {
+				return "", withExitCode(exitNotFound, errors.New("{current} in -versionName needs a versionName, but the manifest has none"))
+			}
+			b.WriteString(attrValue(attr))
+		case "versionCode":
+			code, err := newVersionCode(root, config, "{versionCode} in -versionName")
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(strconv.Itoa(int(code)))
+		}
+	}
+	b.WriteString(t.suffix)
+	return b.String(), nil
+}
@@ -0,0 +1,120 @@
+package manifest
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+)
+
+// alignmentExtraID is the extra field apksigner and zipalign use to pad entries to an alignment.
+const alignmentExtraID = 0xd935
+
+// zip64ExtraID is the extra field with the 64-bit sizes and offset of an entry.
+const zip64ExtraID = 0x0001
+
+// offsetWriter counts the bytes written so far, which is the offset within the zip file once the
+// zip.Writer has been flushed.
+type offsetWriter struct {
+	w io.Writer
+	n int64
+	// The size of the data descriptor of the last entry, which zip.Writer only writes once the
+	// next entry is created.
+	descriptor int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// entryAlignment returns the alignment of the stored entry's data in the output, or 0 if it's
+// compressed. Like with zipalign -p, native libraries in lib/ are page aligned, so they can be
+// loaded from the APK with extractNativeLibs=false, and everything else is 4-byte aligned. A
+// library that was only aligned to 4 KiB pages in the source archive keeps that alignment.
+func entryAlignment(file *zip.File) int64 {
+	if file.Method != zip.Store {
+		return 0
+	}
+	alignment := storedAlignment(file.Name)
+	if alignment == 16384 {
+		if offset, err := file.DataOffset(); err == nil && offset%16384 != 0 && offset%4096 == 0 {
+			return 4096
+		}
+	}
+	return alignment
+}
+
+// storedAlignment returns the alignment zipalign -p uses for a stored entry of the given name.
+func storedAlignment(name string) int64 {
+	if strings.HasPrefix(name, "lib/") && strings.HasSuffix(name, ".so") {
+		return 16384
+	}
+	return 4
+}
+
+// alignHeader pads the header's extra field so that the data of the entry written next starts at
+// a multiple of alignment.
+func alignHeader(zipWriter *zip.Writer, offset *offsetWriter, header *zip.FileHeader, alignment int64) error {
+	if err := zipWriter.Flush(); err != nil {
+		return fmt.Errorf("failed writing zip file: %w", err)
+	}
+	// The local file header has a fixed size of 30 bytes followed by the name and the extra field.
+	header.Extra = alignExtra(header.Extra, offset.n+offset.descriptor+30+int64(len(header.Name)), alignment)
+	return nil
+}
+
+// alignExtra pads extra so that the entry's data, which starts right after extra, begins at a
+// multiple of alignment. extraOffset is the offset of extra within the zip file.
+func alignExtra(extra []byte, extraOffset int64, alignment int64) []byte {
+	if (extraOffset+int64(len(extra)))%alignment == 0 {
+		return extra
+	}
+	extra = stripAlignment(extra)
+	// The padding field consists of its 4 byte header, the alignment (uint16) and the padding bytes.
+	padding := (alignment - (extraOffset+int64(len(extra))+6)%alignment) % alignment
+	field := make([]byte, 6+padding)
+	binary.LittleEndian.PutUint16(field, alignmentExtraID)
+	binary.LittleEndian.PutUint16(field[2:], uint16(2+padding))
+	binary.LittleEndian.PutUint16(field[4:], uint16(alignment))
+	return append(extra, field...)
+}
+
+// stripAlignment removes previous alignment fields and trailing padding bytes that don't form a
+// valid extra field, as written by older zipalign versions.
+func stripAlignment(extra []byte) []byte {
+	return stripExtraFields(extra, alignmentExtraID)
+}
+
+// stripExtraFields removes the extra fields with the given IDs and trailing bytes that don't form
+// a valid extra field.
+func stripExtraFields(extra []byte, ids ...uint16) []byte {
+	var result []byte
+	for len(extra) >= 4 {
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+		if !slices.Contains(ids, binary.LittleEndian.Uint16(extra)) {
+			result = append(result, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+	return result
+}
+
+// dataDescriptorSize returns the size of the data descriptor zip.Writer writes after a raw entry
+// with this header, including its signature.
+func dataDescriptorSize(header *zip.FileHeader) int64 {
+	switch {
+	case header.Flags&0x8 == 0:
+		return 0
+	case header.CompressedSize64 >= math.MaxUint32 || header.UncompressedSize64 >= math.MaxUint32:
+		return 24
+	}
+	return 16
+}
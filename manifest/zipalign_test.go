@@ -0,0 +1,42 @@
+package manifest
+
+import (
+	"archive/zip"
+	"bytes"
+	"slices"
+	"testing"
+)
+
+func TestRewriteZipKeepsOrderAndAlignment(t *testing.T) {
+	// Not sorted and with stored entries at odd offsets, like an APK built by other tools.
+	input := buildZip(t,
+		zipEntry{name: "AndroidManifest.xml", data: "old", method: zip.Deflate},
+		zipEntry{name: "res/raw/a.txt", data: "abc"},
+		zipEntry{name: "classes.dex", data: "dex", method: zip.Deflate},
+		zipEntry{name: "lib/arm64-v8a/libfoo.so", data: "elf"},
+		zipEntry{name: "resources.arsc", data: "table"},
+		zipEntry{name: "META-INF/MANIFEST.MF", data: "mf", method: zip.Deflate},
+	)
+	before := openZip(t, input)
+	var out bytes.Buffer
+	if err := rewriteZip(before, &out, "test.apk", "AndroidManifest.xml", bytes.NewReader([]byte("a new manifest")), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	after := openZip(t, out.Bytes())
+	if got, want := entryNames(after), entryNames(before); !slices.Equal(got, want) {
+		t.Errorf("entries %v, want %v", got, want)
+	}
+	for _, f := range after.File {
+		alignment := entryAlignment(f)
+		if alignment == 0 {
+			continue
+		}
+		offset, err := f.DataOffset()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset%alignment != 0 {
+			t.Errorf("%s starts at %d, want a multiple of %d", f.Name, offset, alignment)
+		}
+	}
+}